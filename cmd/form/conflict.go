@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"pandora/pkg/config"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/container"
+	"fyne.io/fyne/widget"
+)
+
+// askConflict 保存先に既にファイルがある場合の対応を尋ねるウィンドウを表示し、選ばれた対応を標準出力に書き出す
+// トレイのプロセスが on_conflict: ask の場合に `form conflict <path> <owned>` として起動する
+// 選ばずにウィンドウを閉じた場合は何も書き出さず、トレイ側で両方残す
+func askConflict(pandora fyne.App, path string, owned bool) {
+	window := pandora.NewWindow("PandorA - File Conflict")
+
+	choose := func(action string) func() {
+		return func() {
+			fmt.Println(action)
+			pandora.Quit()
+		}
+	}
+
+	message := widget.NewLabel(path + "\nalready exists.")
+	buttons := container.NewHBox()
+	if owned {
+		buttons.Add(widget.NewButton("Overwrite", choose(config.ConflictOverwrite)))
+	} else {
+		// ユーザーが作成もしくは変更したファイルは上書きさせない
+		message.SetText(path + "\nalready exists and was created or edited by you.")
+	}
+	buttons.Add(widget.NewButton("Keep both", choose(config.ConflictKeepBoth)))
+	buttons.Add(widget.NewButton("Skip", choose(config.ConflictSkip)))
+
+	window.SetContent(container.NewVBox(message, container.NewCenter(buttons)))
+	window.Resize(fyne.NewSize(400, 120))
+	window.ShowAndRun()
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"bufio"
+	"os"
+	"strings"
+
+	"pandora/pkg/account"
+	"pandora/pkg/secret"
+
 	"fyne.io/fyne"
 	"fyne.io/fyne/app"
 	"fyne.io/fyne/theme"
@@ -10,6 +17,26 @@ func main() {
 	// アカウント情報を入力するウィンドウを作成
 	pandora := app.New()
 	pandora.Settings().SetTheme(theme.DarkTheme())
+
+	// トレイのプロセスから既にあるファイルの扱いを尋ねられた場合
+	if len(os.Args) == 4 && os.Args[1] == "conflict" {
+		askConflict(pandora, os.Args[2], os.Args[3] == "true")
+		return
+	}
+	// トレイのプロセスから認証情報のパスフレーズを尋ねられた場合
+	if len(os.Args) == 2 && os.Args[1] == "passphrase" {
+		askPassphrase(pandora)
+		return
+	}
+
+	// トレイのプロセスで入力済みのパスフレーズは標準入力で受け取る
+	if len(os.Args) == 2 && os.Args[1] == "--passphrase-stdin" {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if pass := strings.TrimRight(line, "\r\n"); pass != "" {
+			account.SetPassphrase(secret.String(pass))
+		}
+	}
+
 	window := pandora.NewWindow("PandorA")
 	object := makeForm(window)
 	window.Resize(fyne.NewSize(400, 200))
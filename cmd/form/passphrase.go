@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/container"
+	"fyne.io/fyne/widget"
+)
+
+// askPassphrase 認証情報の暗号化に用いるパスフレーズを入力させるウィンドウを表示し、入力されたものを標準出力に書き出す
+// トレイのプロセスが暗号化したファイルを読み書きする際に `form passphrase` として起動する
+// 入力せずにウィンドウを閉じた場合は何も書き出さない
+func askPassphrase(pandora fyne.App) {
+	window := pandora.NewWindow("PandorA - Passphrase")
+
+	entry := widget.NewPasswordEntry()
+	ok := widget.NewButton("OK", func() {
+		if entry.Text == "" {
+			return
+		}
+		fmt.Println(entry.Text)
+		pandora.Quit()
+	})
+
+	message := widget.NewLabel("Enter the passphrase for your account information.")
+	window.SetContent(container.NewVBox(message, entry, container.NewCenter(ok)))
+	window.Resize(fyne.NewSize(400, 120))
+	window.ShowAndRun()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"pandora/pkg/config"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+	"pandora/pkg/secret"
+
+	"fyne.io/fyne"
+	"fyne.io/fyne/container"
+	"fyne.io/fyne/dialog"
+	"fyne.io/fyne/widget"
+)
+
+// showPlan ダウンロードの計画を立ててダイアログに表示する
+// 初回のダウンロードのように量が多い場合に、実行前に内容を確認できるようにする
+func showPlan(ecsID string, password secret.String, rejectable *resource.RejectableType, parent fyne.Window) {
+	prog := dialog.NewProgressInfinite("Planning", "Checking resources in PandA", parent)
+	prog.Show()
+
+	lic, err := pandaapi.NewLoggedInClient(ecsID, password)
+	if err != nil {
+		prog.Hide()
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		prog.Hide()
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	plan, err := resource.MakePlan(lic, rejectable, resource.NewOptions(cfg, nil))
+	prog.Hide()
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	detail := widget.NewLabel(describePlan(plan))
+	scroll := container.NewVScroll(detail)
+	scroll.SetMinSize(fyne.NewSize(480, 320))
+
+	content := container.NewBorder(widget.NewLabel(plan.Summary()), nil, nil, nil, scroll)
+	dialog.ShowCustom("Download Plan", "Close", content, parent)
+}
+
+// describePlan 計画の内容を一覧にした文字列を返す
+func describePlan(plan *resource.Plan) string {
+	var b strings.Builder
+
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s (%d)\n", title, len(lines))
+		for _, line := range lines {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+		b.WriteString("\n")
+	}
+
+	lines := make([]string, 0, len(plan.New))
+	for _, res := range plan.New {
+		lines = append(lines, fmt.Sprintf("%s / %s (%s)", res.LessonSite().Title, res.Path(), resource.FormatSize(res.Size)))
+	}
+	section("New", lines)
+
+	lines = make([]string, 0, len(plan.Updated))
+	for _, res := range plan.Updated {
+		lines = append(lines, fmt.Sprintf("%s / %s (%s)", res.LessonSite().Title, res.Path(), resource.FormatSize(res.Size)))
+	}
+	section("Updated", lines)
+
+	lines = make([]string, 0, len(plan.Skipped))
+	for _, s := range plan.Skipped {
+		lines = append(lines, fmt.Sprintf("%s / %s [%s]", s.LessonSite().Title, s.Path(), s.Reason))
+	}
+	section("Skipped", lines)
+
+	lines = make([]string, 0, len(plan.Removed))
+	for _, r := range plan.Removed {
+		lines = append(lines, fmt.Sprintf("%s / %s", r.Site.Title, r.Title))
+	}
+	section("Removed on server", lines)
+
+	if b.Len() == 0 {
+		return "Everything is up to date."
+	}
+
+	return b.String()
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"image/color"
 	"pandora/pkg/account"
+	"pandora/pkg/ipc"
 	pandaapi "pandora/pkg/pandaAPI"
 	"pandora/pkg/resource"
+	"pandora/pkg/secret"
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/canvas"
@@ -19,6 +21,9 @@ func makeForm(parent fyne.Window) fyne.CanvasObject {
 
 	ecsIDentry := widget.NewEntry()
 	passwordEntry := widget.NewPasswordEntry()
+	// 空の場合はキーリング(Secret Service)に保存する
+	passphraseEntry := widget.NewPasswordEntry()
+	passphraseEntry.PlaceHolder = "optional (keyring if empty)"
 
 	videoCheck := widget.NewCheck("Video", func(_ bool) {})
 	audioCheck := widget.NewCheck("Audio", func(_ bool) {})
@@ -29,7 +34,7 @@ func makeForm(parent fyne.Window) fyne.CanvasObject {
 	if err == nil {
 		// 既にアカウント情報が存在する場合はアカウントの情報を表示する
 		ecsIDentry.Text = ecsID
-		passwordEntry.Text = password
+		passwordEntry.Text = password.Reveal()
 		videoCheck.Checked = rejectable.Video
 		audioCheck.Checked = rejectable.Audio
 		excelCheck.Checked = rejectable.Excel
@@ -51,23 +56,31 @@ func makeForm(parent fyne.Window) fyne.CanvasObject {
 		ecsIDentry,
 		canvas.NewText("Password", color.White),
 		passwordEntry,
+		canvas.NewText("Passphrase", color.White),
+		passphraseEntry,
 	)
 
+	// チェックボックスの状態から除外するファイル形式を作成する
+	checkedRejectable := func() *resource.RejectableType {
+		rejectable := new(resource.RejectableType)
+		rejectable.Video = videoCheck.Checked
+		rejectable.Audio = audioCheck.Checked
+		rejectable.Excel = excelCheck.Checked
+		rejectable.PowerPoint = powerPointCheck.Checked
+		rejectable.Word = wordCheck.Checked
+		return rejectable
+	}
+
 	save := widget.NewButton("Save", func() {
 		// 入力された内容をファイルに保存してウィンドウを閉じる
 		id := ecsIDentry.Text
-		pass := passwordEntry.Text
+		pass := secret.String(passwordEntry.Text)
 
-		if id == "" || pass == "" {
+		if id == "" || pass.IsEmpty() {
 			return
 		}
 
-		rejectable := new(resource.RejectableType)
-		rejectable.Video = videoCheck.Checked
-		rejectable.Audio = audioCheck.Checked
-		rejectable.Excel = excelCheck.Checked
-		rejectable.PowerPoint = powerPointCheck.Checked
-		rejectable.Word = wordCheck.Checked
+		rejectable := checkedRejectable()
 
 		// 入力されたアカウント情報でログインできるかを確認する
 		prog := dialog.NewProgressInfinite("Confirming", "Confirming Account Info", parent)
@@ -79,16 +92,34 @@ func makeForm(parent fyne.Window) fyne.CanvasObject {
 		}
 		prog.Hide()
 
+		// パスフレーズが入力された場合は、それから導出した鍵で暗号化してファイルに保存する
+		if passphraseEntry.Text != "" {
+			account.SetPassphrase(secret.String(passphraseEntry.Text))
+		}
 		if err := account.WriteAccountInfo(id, pass, rejectable); err != nil {
-			dialog.NewError(err, parent)
+			dialog.ShowError(err, parent)
 			return
 		}
+		// 常駐しているPandorAがあれば保存した内容を読み込み直させる
+		reloadDaemon()
 
 		info := dialog.NewInformation("Info", "Completed! Login sucseeded", parent)
 		info.SetOnClosed(parent.Close)
 		info.Show()
 	})
 
+	preview := widget.NewButton("Preview", func() {
+		// 入力された内容でダウンロードを行った場合の計画を表示する
+		id := ecsIDentry.Text
+		pass := secret.String(passwordEntry.Text)
+
+		if id == "" || pass.IsEmpty() {
+			return
+		}
+
+		showPlan(id, pass, checkedRejectable(), parent)
+	})
+
 	cancel := widget.NewButton("Cancel", func() {
 		// 入力された内容を消去する
 		ecsIDentry.SetText("")
@@ -99,6 +130,7 @@ func makeForm(parent fyne.Window) fyne.CanvasObject {
 		layout.NewHBoxLayout(),
 		layout.NewSpacer(),
 		save,
+		preview,
 		cancel,
 		layout.NewSpacer(),
 	)
@@ -124,3 +156,15 @@ func makeForm(parent fyne.Window) fyne.CanvasObject {
 
 	return base
 }
+
+// reloadDaemon 常駐しているPandorAに設定を読み込み直させる 起動していない場合は何もしない
+func reloadDaemon() {
+	c, err := ipc.Dial()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	// 設定に誤りがある場合、常駐しているPandorAは以前の設定のまま動き続ける
+	c.Reload()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"pandora/pkg/account"
+	"pandora/pkg/config"
+	"pandora/pkg/dir"
+)
+
+// 設定ファイルではなくアカウント情報に保存される設定項目
+const ecsIDKey = "ecsid"
+
+// stringList 複数回指定できるフラグの値
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+var (
+	// --configで指定された設定ファイルのパス
+	configPath string
+	// --setで指定された上書きする設定値
+	configOverrides stringList
+)
+
+// loadConfig 設定ファイルを読み込み、環境変数とフラグによる上書きを適用する
+func loadConfig() (*config.Config, error) {
+	config.SetPath(configPath)
+	config.SetOverrides(configOverrides)
+
+	c, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	dir.SetDownloadRoot(c.DownloadRoot())
+	return c, nil
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return usageError("config requires an action: get, set or path")
+	}
+
+	fs := newFlagSet("config " + args[0])
+	if err := fs.Parse(args[1:]); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+
+	switch args[0] {
+	case "get":
+		if fs.NArg() > 1 {
+			return usageError("config get takes at most one key")
+		}
+		return configGet(fs.Arg(0))
+	case "set":
+		if fs.NArg() != 2 {
+			return usageError("config set requires a key and a value")
+		}
+		return configSet(fs.Arg(0), fs.Arg(1))
+	case "path":
+		config.SetPath(configPath)
+		if jsonOutput {
+			printJSON(map[string]string{"path": config.Path()})
+		} else {
+			fmt.Println(config.Path())
+		}
+		return nil
+	}
+
+	return usageError("unknown config action: %s", args[0])
+}
+
+// configGet 上書きを適用した後の設定値を表示する
+func configGet(key string) error {
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	keys := append([]string{ecsIDKey}, config.Keys()...)
+	if key != "" {
+		keys = []string{key}
+	}
+
+	values := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if k == ecsIDKey {
+			ecsID, _, _, err := account.ReadAccountInfo()
+			if err != nil && key == ecsIDKey {
+				return err
+			}
+			values[k] = ecsID
+			continue
+		}
+
+		v, err := c.Get(k)
+		if err != nil {
+			return usageError("unknown config key: %s", k)
+		}
+		values[k] = v
+	}
+
+	if jsonOutput {
+		printJSON(values)
+		return nil
+	}
+
+	if key != "" {
+		fmt.Println(values[key])
+		return nil
+	}
+	for _, k := range keys {
+		fmt.Printf("%s = %s\n", k, values[k])
+	}
+
+	return nil
+}
+
+// configSet 設定値を変更して保存する 環境変数などによる上書きは保存しない
+func configSet(key, value string) error {
+	if key == ecsIDKey {
+		return setECSID(value)
+	}
+
+	config.SetPath(configPath)
+	c, err := config.LoadFile()
+	if err != nil {
+		return err
+	}
+
+	if err := c.Set(key, value); err != nil {
+		if ve, ok := err.(*config.ValidationError); ok && ve.Message == "unknown key" {
+			return usageError("unknown config key: %s", key)
+		}
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Save(); err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		v, _ := c.Get(key)
+		printJSON(map[string]string{key: v})
+	}
+
+	return nil
+}
+
+// setECSID 保存されているアカウント情報のECS-IDを変更する
+func setECSID(value string) error {
+	if value == "" {
+		return usageError("ecsid must not be empty")
+	}
+
+	_, password, rejectable, err := loadAccount()
+	if err != nil {
+		return err
+	}
+
+	if err := account.WriteAccountInfo(value, password, rejectable); err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		printJSON(map[string]string{ecsIDKey: value})
+	}
+
+	return nil
+}
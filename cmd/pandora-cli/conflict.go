@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"pandora/pkg/config"
+	"pandora/pkg/resource"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// newAskFunc 保存先に既にファイルがある場合の対応を端末で尋ねる関数を返す
+// 端末から実行されていない場合はnilを返し、両方残す
+func newAskFunc() resource.AskFunc {
+	if jsonOutput || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	return func(c resource.Conflict) string {
+		prompt := "[k]eep both, [s]kip"
+		if c.Owned {
+			prompt = "[o]verwrite, " + prompt
+		} else {
+			fmt.Fprintf(os.Stderr, "%s has been created or edited locally.\n", c.Path)
+		}
+
+		for {
+			fmt.Fprintf(os.Stderr, "%s already exists: %s? ", c.Path, prompt)
+			line, err := readLine(stdin)
+			if err != nil {
+				return config.ConflictKeepBoth
+			}
+
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "o", "overwrite":
+				if c.Owned {
+					return config.ConflictOverwrite
+				}
+			case "k", "keep", "", "keep both":
+				return config.ConflictKeepBoth
+			case "s", "skip":
+				return config.ConflictSkip
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"pandora/pkg/ipc"
+)
+
+func runDaemon(args []string) error {
+	if len(args) == 0 {
+		return usageError("daemon requires an action: sync, reload, status or quit")
+	}
+
+	action := args[0]
+	fs := newFlagSet("daemon " + action)
+	if err := fs.Parse(args[1:]); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("daemon %s takes no arguments", action)
+	}
+
+	switch action {
+	case "sync", "reload", "status", "quit":
+	default:
+		return usageError("unknown daemon action: %s", action)
+	}
+
+	c, err := ipc.Dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	switch action {
+	case "sync":
+		err = c.Sync()
+	case "reload":
+		err = c.Reload()
+	case "quit":
+		err = c.Quit()
+	case "status":
+		var s ipc.Status
+		if s, err = c.Status(); err == nil {
+			if jsonOutput {
+				printJSON(s)
+			} else {
+				printDaemonStatus(s)
+			}
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		printJSON(map[string]string{"action": action, "result": "ok"})
+	}
+
+	return nil
+}
+
+// printDaemonStatus 起動中のPandorAの状態を人が読みやすい形式で出力する
+func printDaemonStatus(s ipc.Status) {
+	state := "idle"
+	switch {
+	case s.Running:
+		state = "downloading"
+	case s.Queued:
+		state = "waiting for PandA to be reachable"
+	case !s.PausedUntil.IsZero():
+		state = "paused until " + s.PausedUntil.Local().Format("2006-01-02 15:04")
+	}
+
+	next := "off"
+	if !s.NextRun.IsZero() {
+		next = s.NextRun.Local().Format("2006-01-02 15:04")
+	}
+
+	fmt.Printf("PID:       %d\n", s.PID)
+	fmt.Printf("State:     %s\n", state)
+	fmt.Printf("Next sync: %s\n", next)
+	if !s.LastRun.LastStart.IsZero() {
+		fmt.Printf("Last sync: %s (%s, %d new, %d updated, took %s)\n",
+			s.LastRun.LastStart.Local().Format("2006-01-02 15:04"), s.LastRun.Result,
+			s.LastRun.New, s.LastRun.Updated, s.LastRun.Duration.Round(time.Second))
+	}
+}
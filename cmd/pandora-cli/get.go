@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+)
+
+func runGet(args []string) error {
+	fs := newFlagSet("get")
+	output := fs.String("o", "", "write to FILE instead of the PandorA Box (\"-\" for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 2 {
+		return usageError("get requires a site and a path")
+	}
+
+	// PandorA Boxに保存する場合はダウンロードの記録も更新する
+	if *output == "" {
+		lock, err := lockState()
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	lic, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	s, err := findSite(lic, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	resources, err := resource.SiteResources(lic, s)
+	if err != nil {
+		return err
+	}
+
+	target, ok := findResource(resources, fs.Arg(1))
+	if !ok {
+		return fmt.Errorf("file not found in %s: %s", s.Title, fs.Arg(1))
+	}
+
+	saved := *output
+	switch *output {
+	case "":
+		opts := resource.NewOptions(c, nil)
+		opts.Ask = newAskFunc()
+		saved, err = resource.Save(lic, target, opts)
+	case "-":
+		err = resource.Get(lic, target, os.Stdout)
+	default:
+		err = saveAs(lic, target, *output)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return nil
+	}
+
+	if jsonOutput {
+		printJSON(toFileEntries([]resource.Resource{target})[0])
+	} else {
+		fmt.Printf("Downloaded %s (%s) to %s\n", target.Path(), resource.FormatSize(target.Size), saved)
+	}
+
+	return nil
+}
+
+// findResource パスもしくは資料名が一致するリソースを探す
+func findResource(resources []resource.Resource, path string) (resource.Resource, bool) {
+	for _, res := range resources {
+		if res.Path() == path {
+			return res, true
+		}
+	}
+
+	for _, res := range resources {
+		if res.Title == path {
+			return res, true
+		}
+	}
+
+	return resource.Resource{}, false
+}
+
+// saveAs リソースを指定されたファイルにダウンロードする
+func saveAs(lic *pandaapi.LoggedInClient, res resource.Resource, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := resource.Get(lic, res, file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pandora/pkg/account"
+	"pandora/pkg/config"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+	"pandora/pkg/secret"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func runLogin(args []string) error {
+	fs := newFlagSet("login")
+	ecsID := fs.String("id", "", "ECS-ID")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin")
+	withTOTP := fs.Bool("totp", false, "also read the TOTP secret for two-factor login (auth.method: cas-totp)")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("login takes no arguments")
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	interactive := terminal.IsTerminal(int(os.Stdin.Fd()))
+
+	if *ecsID == "" {
+		if *passwordStdin || !interactive {
+			// 標準入力はパスワードに使うため、ECS-IDは引数で受け取る
+			return usageError("--id is required when the password is read from stdin")
+		}
+
+		fmt.Fprint(os.Stderr, "ECS-ID: ")
+		line, err := readLine(stdin)
+		if err != nil {
+			return err
+		}
+		*ecsID = line
+	}
+
+	password, err := readSecret(stdin, "Password: ", *passwordStdin || !interactive)
+	if err != nil {
+		return err
+	}
+
+	if *ecsID == "" || password.IsEmpty() {
+		return &cliError{code: exitAuth, err: errors.New("ECS-ID and password must not be empty")}
+	}
+	secret.Register(password.Reveal())
+
+	cred := &account.Credential{ECSID: *ecsID, Password: password}
+	if *withTOTP {
+		totp, err := readSecret(stdin, "TOTP secret: ", *passwordStdin || !interactive)
+		if err != nil {
+			return err
+		}
+		secret.Register(totp.Reveal())
+		cred.TOTPSecret = totp
+	} else if old, err := account.ReadCredential(); err == nil && old.ECSID == *ecsID {
+		cred.TOTPSecret = old.TOTPSecret
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// 入力されたアカウント情報でログインできるかを確認する
+	if _, err := pandaapi.NewClient(account.NewAuthenticator(c, cred)); err != nil {
+		return err
+	}
+
+	// 既に設定されている除外するファイル形式は引き継ぐ
+	_, _, rejectable, err := account.ReadAccountInfo()
+	if err != nil || rejectable == nil {
+		rejectable = defaultRejectable()
+	}
+
+	if err := account.WriteAccountInfo(*ecsID, password, rejectable); err != nil {
+		return err
+	}
+	if *withTOTP {
+		if err := account.WriteCredential(cred); err != nil {
+			return err
+		}
+	}
+
+	if jsonOutput {
+		printJSON(map[string]interface{}{"ecsID": *ecsID, "loggedIn": true})
+	} else {
+		fmt.Println("Login succeeded. Account information is saved.")
+	}
+
+	return nil
+}
+
+// readSecret パスワードなどの秘密の値を読み込む
+// fromStdinがtrueの場合は標準入力から一行読み込み、そうでなければ端末に表示せずに入力させる
+func readSecret(stdin *bufio.Reader, prompt string, fromStdin bool) (secret.String, error) {
+	if fromStdin {
+		line, err := readLine(stdin)
+		return secret.String(line), err
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+
+	return secret.String(b), err
+}
+
+// newPassphrasePrompt 認証情報の暗号化に用いるパスフレーズを端末で尋ねる関数を返す
+// 端末から実行されていない場合はnilを返し、環境変数PANDORA_PASSPHRASEで与えさせる
+func newPassphrasePrompt() func() (secret.String, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	return func() (secret.String, error) {
+		return readSecret(nil, "Passphrase for the account information: ", false)
+	}
+}
+
+// readLine 改行を除いた一行を読み込む
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// defaultRejectable 設定フォームの初期値と同じく全てのファイル形式を除外する
+func defaultRejectable() *resource.RejectableType {
+	return &resource.RejectableType{
+		Video:      true,
+		Audio:      true,
+		Excel:      true,
+		PowerPoint: true,
+		Word:       true,
+	}
+}
+
+// loadAccount 保存されているアカウント情報を読み出す
+func loadAccount() (ecsID string, password secret.String, rejectable *resource.RejectableType, err error) {
+	// 設定ファイルの誤りはアカウント情報が未設定であるとは扱わない
+	if _, err := loadConfig(); err != nil {
+		return "", "", nil, err
+	}
+
+	ecsID, password, rejectable, err = account.ReadAccountInfo()
+	if account.NeedsPassphrase(err) {
+		return "", "", nil, &cliError{code: exitAuth, err: err}
+	}
+	if err != nil || ecsID == "" {
+		return "", "", nil, &cliError{
+			code: exitAuth,
+			err:  errors.New("account information is not set. Run `pandora-cli login` first"),
+		}
+	}
+
+	return
+}
+
+// newAuthenticator 設定されたログイン方法と保存されている認証情報からAuthenticatorを作成する
+// Cookieを読み込む場合は認証情報を必要としない
+func newAuthenticator(c *config.Config) (pandaapi.Authenticator, error) {
+	if c.Auth.Method == config.AuthCookies {
+		return account.NewAuthenticator(c, &account.Credential{}), nil
+	}
+
+	cred, err := account.ReadCredential()
+	if account.NeedsPassphrase(err) {
+		return nil, &cliError{code: exitAuth, err: err}
+	}
+	if err != nil || cred.ECSID == "" {
+		return nil, &cliError{
+			code: exitAuth,
+			err:  errors.New("account information is not set. Run `pandora-cli login` first"),
+		}
+	}
+
+	return account.NewAuthenticator(c, cred), nil
+}
+
+// newClient 設定されたログイン方法でログインしたクライアントを返す
+func newClient() (*pandaapi.LoggedInClient, *resource.RejectableType, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth, err := newAuthenticator(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lic, err := pandaapi.NewClient(auth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return lic, configRejectable(c), nil
+}
+
+// configRejectable 設定ファイルからダウンロードしないファイル形式を読み出す
+func configRejectable(c *config.Config) *resource.RejectableType {
+	r := resource.RejectableType(c.Filters.Reject)
+	return &r
+}
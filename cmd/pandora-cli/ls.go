@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+)
+
+// fileEntry JSON出力用のリソースの情報
+type fileEntry struct {
+	SiteID       string `json:"siteID"`
+	SiteTitle    string `json:"siteTitle"`
+	Path         string `json:"path"`
+	Title        string `json:"title"`
+	Type         string `json:"type"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"lastModified"`
+	URL          string `json:"url"`
+}
+
+func toFileEntries(resources []resource.Resource) []fileEntry {
+	entries := make([]fileEntry, 0, len(resources))
+	for _, res := range resources {
+		s := res.LessonSite()
+		entries = append(entries, fileEntry{
+			SiteID:       s.ID,
+			SiteTitle:    s.Title,
+			Path:         res.Path(),
+			Title:        res.Title,
+			Type:         res.Type,
+			Size:         res.Size,
+			LastModified: res.LastModified,
+			URL:          res.URL,
+		})
+	}
+
+	return entries
+}
+
+func runLs(args []string) error {
+	if len(args) == 0 {
+		return usageError("ls requires a target: sites or files")
+	}
+
+	switch args[0] {
+	case "sites":
+		return runLsSites(args[1:])
+	case "files":
+		return runLsFiles(args[1:])
+	}
+
+	return usageError("unknown ls target: %s", args[0])
+}
+
+func runLsSites(args []string) error {
+	fs := newFlagSet("ls sites")
+	all := fs.Bool("all", false, "include sites of past semesters")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+
+	lic, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	sites, err := resource.Sites(lic, *all)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		printJSON(sites)
+		return nil
+	}
+
+	for _, s := range sites {
+		fmt.Printf("%s\t%s\n", s.ID, s.Title)
+	}
+
+	return nil
+}
+
+func runLsFiles(args []string) error {
+	fs := newFlagSet("ls files")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 1 {
+		return usageError("ls files requires exactly one site")
+	}
+
+	lic, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	s, err := findSite(lic, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	resources, err := resource.SiteResources(lic, s)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		printJSON(toFileEntries(resources))
+		return nil
+	}
+
+	for _, res := range resources {
+		fmt.Printf("%s\t%s\t%s\n", res.Path(), resource.FormatSize(res.Size), res.LastModified)
+	}
+
+	return nil
+}
+
+// findSite IDもしくはタイトルから授業サイトを探す
+// IDかタイトルが完全一致するものを優先し、なければタイトルの一部が一致する唯一のサイトを返す
+func findSite(lic *pandaapi.LoggedInClient, query string) (resource.Site, error) {
+	sites, err := resource.Sites(lic, true)
+	if err != nil {
+		return resource.Site{}, err
+	}
+
+	for _, s := range sites {
+		if s.ID == query || s.Title == query {
+			return s, nil
+		}
+	}
+
+	matched := make([]resource.Site, 0)
+	for _, s := range sites {
+		if strings.Contains(s.Title, query) {
+			matched = append(matched, s)
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return resource.Site{}, fmt.Errorf("site not found: %s", query)
+	case 1:
+		return matched[0], nil
+	}
+
+	titles := make([]string, 0, len(matched))
+	for _, s := range matched {
+		titles = append(titles, s.Title)
+	}
+	return resource.Site{}, usageError("%q matches several sites:\n  %s", query, strings.Join(titles, "\n  "))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"pandora/pkg/account"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/secret"
+)
+
+// 終了コード
+const (
+	// 正常終了
+	exitOK = 0
+	// 分類されないエラー
+	exitFailure = 1
+	// コマンドの使い方の誤り
+	exitUsage = 2
+	// ログインの失敗もしくはアカウント情報が未設定
+	exitAuth = 3
+	// ネットワークもしくはPandAの障害
+	exitNetwork = 4
+	// 一部の資料のダウンロードに失敗
+	exitPartial = 5
+)
+
+const usage = `Usage: pandora-cli [--json] [--config FILE] [--set key=value]... <command> [arguments]
+
+Commands:
+  login [--id ECSID] [--password-stdin] [--totp]
+                                          アカウント情報を入力してログインを確認する
+  sync [--dry-run]                        未取得の資料をダウンロードする
+  status                                  アカウントとダウンロード状況を表示する
+  ls sites [--all]                        授業サイトの一覧を表示する
+  ls files <site>                         授業サイトの資料の一覧を表示する
+  get [-o FILE] <site> <path>             資料を一つダウンロードする
+  config get [key]                        設定値を表示する
+  config set <key> <value>                設定値を変更する
+  config path                             設定ファイルのパスを表示する
+  state prune [--dry-run]                 不要になったダウンロード記録を削除する
+  relocate [--dry-run] [--root DIR] [--template T]
+                                          ダウンロード済みの資料を新しい保存先へ移動する
+  daemon <sync|reload|status|quit>        常駐しているPandorAに操作を依頼する
+
+<site> には授業サイトのIDかタイトル(の一部)を指定できます。
+設定値は環境変数 PANDORA_<KEY> (例: PANDORA_DOWNLOAD_CONCURRENCY) や
+--set download.concurrency=2 のように一時的に上書きできます。
+`
+
+// コマンドを表す関数 args にはコマンド名以降の引数が渡される
+type command func(args []string) error
+
+var (
+	// JSON形式で結果を出力するかどうか
+	jsonOutput bool
+
+	commands = map[string]command{
+		"login":    runLogin,
+		"sync":     runSync,
+		"status":   runStatus,
+		"ls":       runLs,
+		"get":      runGet,
+		"config":   runConfig,
+		"state":    runState,
+		"relocate": runRelocate,
+		"daemon":   runDaemon,
+	}
+)
+
+// cliError 終了コードを伴うエラー
+type cliError struct {
+	code int
+	err  error
+	// 結果を出力済みのためエラーメッセージを表示しない
+	quiet bool
+}
+
+func (c *cliError) Error() string {
+	return c.err.Error()
+}
+
+// usageError コマンドの使い方の誤りを表すエラーを返す
+func usageError(format string, a ...interface{}) error {
+	return &cliError{code: exitUsage, err: fmt.Errorf(format, a...)}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := newFlagSet("pandora-cli")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	name := fs.Arg(0)
+	if name == "help" {
+		fmt.Print(usage)
+		return exitOK
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", name, usage)
+		return exitUsage
+	}
+
+	account.SetPrompt(newPassphrasePrompt())
+
+	if err := cmd(fs.Args()[1:]); err != nil {
+		code := exitCode(err)
+		if code == exitUsage {
+			fmt.Fprintf(os.Stderr, "%s\n\n%s", err, usage)
+			return code
+		}
+
+		if ce, ok := err.(*cliError); ok && ce.quiet {
+			return code
+		}
+
+		if jsonOutput {
+			printJSON(map[string]interface{}{"error": secret.Redact(err.Error()), "code": code})
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", secret.Redact(err.Error()))
+		}
+		return code
+	}
+
+	return exitOK
+}
+
+// newFlagSet 全てのコマンドで共通のフラグを登録したFlagSetを返す
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&jsonOutput, "json", jsonOutput, "output in JSON format")
+	fs.StringVar(&configPath, "config", configPath, "path to the config file")
+	fs.Var(&configOverrides, "set", "override a config value (key=value)")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+
+	return fs
+}
+
+// exitCode エラーの種類に応じた終了コードを返す
+func exitCode(err error) int {
+	var ce *cliError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+
+	switch pandaapi.ClassOf(err) {
+	case pandaapi.ClassAuth:
+		return exitAuth
+	case pandaapi.ClassUnknown, pandaapi.ClassParse:
+	default:
+		return exitNetwork
+	}
+
+	return exitFailure
+}
+
+// printJSON 値をJSON形式で標準出力に書き出す
+func printJSON(v interface{}) {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	e.Encode(v)
+}
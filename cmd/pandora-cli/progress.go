@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"pandora/pkg/resource"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// プログレスバーの幅(文字数)
+	barWidth = 30
+	// プログレスバーの後ろに表示するファイル名の最大の長さ(文字数)
+	nameWidth = 30
+)
+
+// progressBar ダウンロードの進捗を端末にプログレスバーとして表示する
+type progressBar struct {
+	w io.Writer
+}
+
+// newProgressFunc 標準エラー出力が端末の場合にプログレスバーを表示する関数を返す
+// JSON出力の場合や端末でない場合はnilを返す
+func newProgressFunc() resource.ProgressFunc {
+	if jsonOutput || !terminal.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+
+	bar := &progressBar{w: os.Stderr}
+	return bar.update
+}
+
+func (p *progressBar) update(e resource.ProgressEvent) {
+	t := e.Totals
+
+	if e.Kind == resource.Finished {
+		if t.Files > 0 {
+			// プログレスバーを残して改行する
+			fmt.Fprintln(p.w)
+		}
+		return
+	}
+
+	if e.Kind == resource.FileFailed {
+		// 失敗したファイルはプログレスバーの上に表示する
+		fmt.Fprintf(p.w, "\r\033[K%s/%s: %s\n", e.Resource.LessonSite().Title, e.Resource.Title, e.Err)
+	}
+
+	ratio := 0.0
+	if t.Bytes > 0 {
+		ratio = float64(t.Transferred) / float64(t.Bytes)
+	} else if t.Files > 0 {
+		ratio = float64(t.Done()) / float64(t.Files)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * barWidth)
+
+	fmt.Fprintf(
+		p.w,
+		"\r\033[K[%s%s] %d/%d %s / %s %s",
+		strings.Repeat("#", filled),
+		strings.Repeat(".", barWidth-filled),
+		t.Done(),
+		t.Files,
+		resource.FormatSize(t.Transferred),
+		resource.FormatSize(t.Bytes),
+		truncate(e.Resource.Title, nameWidth),
+	)
+}
+
+// truncate 文字列がn文字を超える場合は末尾を省略する
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n-1]) + "…"
+}
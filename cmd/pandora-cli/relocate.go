@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"pandora/pkg/config"
+	"pandora/pkg/dir"
+	"pandora/pkg/layout"
+	"pandora/pkg/resource"
+)
+
+func runRelocate(args []string) error {
+	fs := newFlagSet("relocate")
+	dryRun := fs.Bool("dry-run", false, "show where files would be moved without moving them")
+	root := fs.String("root", "", "new download folder (default: download.root in the config file)")
+	template := fs.String("template", "", "new path template (default: download.template in the config file)")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("relocate takes no arguments")
+	}
+
+	// 常駐しているPandorAは移動前の保存先と記録を使い続けるため、終了させてから移動する
+	if !*dryRun {
+		lock, err := lockState()
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	if _, err := loadConfig(); err != nil {
+		return err
+	}
+	oldRoot := dir.PandorAPath()
+
+	// 環境変数などによる上書きを保存しないよう設定ファイルの内容だけを読み込む
+	c, err := config.LoadFile()
+	if err != nil {
+		return err
+	}
+	if *root != "" {
+		c.Download.Root = *root
+	}
+	if *template != "" {
+		c.Download.Template = *template
+	}
+	if err := c.Validate(); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+
+	newRoot := dir.ResolveDownloadRoot(c.DownloadRoot())
+	result, err := resource.Relocate(oldRoot, newRoot, layout.MustParse(c.Download.Template), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		if err := c.Save(); err != nil {
+			return err
+		}
+	}
+
+	if jsonOutput {
+		printJSON(result)
+	} else {
+		printRelocate(result, *dryRun)
+	}
+
+	if n := result.Failed(); n > 0 {
+		return &cliError{code: exitPartial, err: fmt.Errorf("%d file(s) could not be moved", n), quiet: jsonOutput}
+	}
+
+	return nil
+}
+
+// printRelocate relocateコマンドの結果を人が読みやすい形式で出力する
+func printRelocate(result *resource.RelocateResult, dryRun bool) {
+	for _, m := range result.Moves {
+		if m.Error != "" {
+			fmt.Printf("failed   %s -> %s: %s\n", m.From, m.To, m.Error)
+		} else {
+			fmt.Printf("move     %s -> %s\n", m.From, m.To)
+		}
+	}
+
+	verb := "Moved"
+	if dryRun {
+		verb = "Would move"
+	}
+	fmt.Printf("%s %d file(s), %d already in place, %d missing, %d without a recorded location.\n",
+		verb, len(result.Moves)-result.Failed(), result.Unchanged, result.Missing, result.Unknown)
+}
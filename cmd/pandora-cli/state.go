@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"pandora/pkg/resource"
+)
+
+func runState(args []string) error {
+	if len(args) == 0 || args[0] != "prune" {
+		return usageError("state requires an action: prune")
+	}
+
+	fs := newFlagSet("state prune")
+	dryRun := fs.Bool("dry-run", false, "count entries without removing them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("state prune takes no arguments")
+	}
+
+	if !*dryRun {
+		lock, err := lockState()
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	lic, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := resource.Prune(lic, resource.NewOptions(c, nil), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		printJSON(result)
+		return nil
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d site(s) and %d file record(s).\n", verb, result.Sites, result.Resources)
+
+	return nil
+}
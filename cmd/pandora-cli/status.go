@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"pandora/pkg/account"
+	"pandora/pkg/dir"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+)
+
+// statusInfo statusコマンドの出力内容
+type statusInfo struct {
+	ECSID          string `json:"ecsID"`
+	AccountSet     bool   `json:"accountSet"`
+	PandAReachable bool   `json:"pandaReachable"`
+	PandAError     string `json:"pandaError,omitempty"`
+	DownloadFolder string `json:"downloadFolder"`
+	TrackedSites   int    `json:"trackedSites"`
+	TrackedFiles   int    `json:"trackedFiles"`
+	ConfigFolder   string `json:"configFolder"`
+	StateFolder    string `json:"stateFolder"`
+	LogFolder      string `json:"logFolder"`
+	Portable       bool   `json:"portable"`
+}
+
+func runStatus(args []string) error {
+	fs := newFlagSet("status")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("status takes no arguments")
+	}
+
+	if _, err := loadConfig(); err != nil {
+		return err
+	}
+
+	var info statusInfo
+	if ecsID, _, _, err := account.ReadAccountInfo(); err == nil && ecsID != "" {
+		info.ECSID = ecsID
+		info.AccountSet = true
+	}
+
+	if err := pandaapi.CheckPandaStatus(); err != nil {
+		info.PandAError = err.Error()
+	} else {
+		info.PandAReachable = true
+	}
+
+	info.DownloadFolder = dir.PandorAPath()
+	info.ConfigFolder = dir.ConfigDir()
+	info.StateFolder = dir.StateDir()
+	info.LogFolder = dir.LogDir()
+	info.Portable = dir.Portable()
+	info.TrackedSites, info.TrackedFiles = resource.TrackedCount()
+
+	if jsonOutput {
+		printJSON(info)
+	} else {
+		printStatus(info)
+	}
+
+	if !info.AccountSet {
+		return &cliError{code: exitAuth, err: fmt.Errorf("account information is not set"), quiet: jsonOutput}
+	}
+
+	return nil
+}
+
+// printStatus statusコマンドの結果を人が読みやすい形式で出力する
+func printStatus(info statusInfo) {
+	ecsID := "(not set)"
+	if info.AccountSet {
+		ecsID = info.ECSID
+	}
+	panda := "reachable"
+	if !info.PandAReachable {
+		panda = "unreachable: " + info.PandAError
+	}
+
+	fmt.Printf("Account:         %s\n", ecsID)
+	fmt.Printf("PandA:           %s\n", panda)
+	fmt.Printf("Download folder: %s\n", info.DownloadFolder)
+	if info.Portable {
+		fmt.Printf("Portable mode:   %s\n", info.ConfigFolder)
+	} else {
+		fmt.Printf("Config folder:   %s\n", info.ConfigFolder)
+		fmt.Printf("State folder:    %s\n", info.StateFolder)
+		fmt.Printf("Log folder:      %s\n", info.LogFolder)
+	}
+	fmt.Printf("Tracked files:   %d in %d site(s)\n", info.TrackedFiles, info.TrackedSites)
+}
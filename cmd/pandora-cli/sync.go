@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"pandora/pkg/dir"
+	"pandora/pkg/ipc"
+	"pandora/pkg/resource"
+	"pandora/pkg/secret"
+)
+
+func runSync(args []string) error {
+	fs := newFlagSet("sync")
+	dryRun := fs.Bool("dry-run", false, "show what would be downloaded without downloading")
+	if err := fs.Parse(args); err != nil {
+		return &cliError{code: exitUsage, err: err}
+	}
+	if fs.NArg() != 0 {
+		return usageError("sync takes no arguments")
+	}
+
+	if *dryRun {
+		return runDryRun()
+	}
+
+	// 常駐しているPandorAがあればダウンロードを任せる 同時にダウンロードすると記録が壊れるため
+	if d, err := ipc.Dial(); err == nil {
+		defer d.Close()
+		return syncDaemon(d)
+	}
+
+	lock, err := lockState()
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	auth, err := newAuthenticator(c)
+	if err != nil {
+		return err
+	}
+
+	opts := resource.NewOptions(c, newProgressFunc())
+	opts.Ask = newAskFunc()
+
+	report, err := resource.Sync(auth, configRejectable(c), opts)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := report.Save(dir.StateDir()); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to save the report:", err)
+	}
+
+	return showReport(report)
+}
+
+// lockState 常駐しているPandorAが起動したり、他のコマンドがダウンロードしたりしないようロックを取得する
+// ダウンロードの記録を書き換えるコマンドは、記録が壊れないようこのロックを持って実行する
+func lockState() (*ipc.Lock, error) {
+	lock, err := ipc.Acquire()
+	if err != ipc.ErrAlreadyRunning {
+		return lock, err
+	}
+
+	if d, err := ipc.Dial(); err == nil {
+		d.Close()
+		return nil, errors.New("PandorA is running; quit it from the menu or with `pandora-cli daemon quit` and try again")
+	}
+
+	return nil, errors.New("another PandorA is downloading; try again after it finishes")
+}
+
+// syncDaemon 常駐しているPandorAにダウンロードを行わせ、終了を待って結果を出力する
+// 実行中やクールダウン中で開始されなかった場合はその理由をエラーとして返す
+func syncDaemon(d *ipc.Client) error {
+	if !jsonOutput {
+		fmt.Fprintln(os.Stderr, "PandorA is running; downloading there. Progress is shown by the running PandorA.")
+	}
+
+	report, err := d.SyncWait()
+	if err != nil {
+		return err
+	}
+
+	return showReport(report)
+}
+
+// showReport ダウンロードの結果を出力し、失敗したファイルがある場合はエラーを返す
+func showReport(report *resource.SyncReport) error {
+	if jsonOutput {
+		printJSON(report)
+	} else {
+		printReport(report)
+	}
+
+	if report.HasErrors() {
+		return &cliError{
+			code:  exitPartial,
+			err:   fmt.Errorf("download finished with errors (%d file(s) failed)", report.Failed),
+			quiet: jsonOutput,
+		}
+	}
+
+	return nil
+}
+
+// printReport ダウンロードの結果を人が読みやすい形式で出力する
+func printReport(report *resource.SyncReport) {
+	for _, f := range report.Files {
+		mark := "new     "
+		if f.Updated {
+			mark = "updated "
+		}
+		fmt.Printf("%s %s/%s (%s)\n", mark, f.SiteTitle, f.Path, resource.FormatSize(f.Size))
+	}
+
+	for _, c := range report.Conflicts {
+		switch {
+		case c.IsEditConflict() && c.Saved != "":
+			fmt.Printf("edited   %s (updated on the server, new version saved as %s)\n", c.Existing, c.Saved)
+		case c.Saved == "":
+			fmt.Printf("kept     %s (skipped)\n", c.Existing)
+		default:
+			fmt.Printf("kept     %s (new version saved as %s)\n", c.Existing, c.Saved)
+		}
+	}
+
+	for _, g := range report.Errors {
+		fmt.Printf("error    [%s] x%d: %s\n", g.Kind, g.Count, strings.TrimSpace(g.Message))
+		for _, file := range g.Files {
+			fmt.Printf("           %s\n", file)
+		}
+	}
+
+	fmt.Println(report.Summary())
+}
+
+func runDryRun() error {
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	lic, rejectable, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	plan, err := resource.MakePlan(lic, rejectable, resource.NewOptions(c, nil))
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		printJSON(toPlanJSON(plan))
+	} else {
+		printPlan(plan)
+	}
+
+	return nil
+}
+
+// planJSON JSON出力用のダウンロード計画
+type planJSON struct {
+	New        []fileEntry      `json:"new"`
+	Updated    []fileEntry      `json:"updated"`
+	Skipped    []skippedEntry   `json:"skipped"`
+	Removed    []removedEntry   `json:"removed"`
+	Collisions []collisionEntry `json:"collisions"`
+	SiteErrors []siteErrorEntry `json:"siteErrors"`
+	Unchanged  int              `json:"unchanged"`
+	TotalBytes int64            `json:"totalBytes"`
+}
+
+// skippedEntry JSON出力用の除外されたリソースの情報
+type skippedEntry struct {
+	fileEntry
+	Reason string `json:"reason"`
+}
+
+// removedEntry JSON出力用のサーバー上から削除されたリソースの情報
+type removedEntry struct {
+	SiteID       string `json:"siteID"`
+	SiteTitle    string `json:"siteTitle"`
+	Title        string `json:"title"`
+	LastModified string `json:"lastModified"`
+}
+
+// siteErrorEntry JSON出力用の資料の一覧を取得できなかった授業サイトの情報
+type siteErrorEntry struct {
+	SiteID    string `json:"siteID"`
+	SiteTitle string `json:"siteTitle"`
+	Error     string `json:"error"`
+}
+
+// collisionEntry JSON出力用の保存先が重なったリソースの情報
+type collisionEntry struct {
+	fileEntry
+	Collided string `json:"collided"`
+	Renamed  string `json:"renamed"`
+}
+
+func toPlanJSON(plan *resource.Plan) planJSON {
+	p := planJSON{
+		New:        toFileEntries(plan.New),
+		Updated:    toFileEntries(plan.Updated),
+		Skipped:    make([]skippedEntry, 0, len(plan.Skipped)),
+		Removed:    make([]removedEntry, 0, len(plan.Removed)),
+		Collisions: make([]collisionEntry, 0, len(plan.Collisions)),
+		SiteErrors: make([]siteErrorEntry, 0, len(plan.SiteErrors)),
+		Unchanged:  plan.Unchanged,
+		TotalBytes: plan.TotalBytes,
+	}
+
+	for _, s := range plan.Skipped {
+		p.Skipped = append(p.Skipped, skippedEntry{
+			fileEntry: toFileEntries([]resource.Resource{s.Resource})[0],
+			Reason:    s.Reason,
+		})
+	}
+
+	for _, r := range plan.Removed {
+		p.Removed = append(p.Removed, removedEntry{
+			SiteID:       r.Site.ID,
+			SiteTitle:    r.Site.Title,
+			Title:        r.Title,
+			LastModified: r.LastModified,
+		})
+	}
+
+	for _, c := range plan.Collisions {
+		p.Collisions = append(p.Collisions, collisionEntry{
+			fileEntry: toFileEntries([]resource.Resource{c.Resource})[0],
+			Collided:  c.Path,
+			Renamed:   c.Renamed,
+		})
+	}
+
+	for _, e := range plan.SiteErrors {
+		p.SiteErrors = append(p.SiteErrors, siteErrorEntry{
+			SiteID:    e.Site.ID,
+			SiteTitle: e.Site.Title,
+			Error:     secret.Redact(e.Err.Error()),
+		})
+	}
+
+	return p
+}
+
+// printPlan ダウンロード計画を人が読みやすい形式で出力する
+func printPlan(plan *resource.Plan) {
+	for _, res := range plan.New {
+		fmt.Printf("new      %s/%s (%s)\n", res.LessonSite().Title, res.Path(), resource.FormatSize(res.Size))
+	}
+	for _, res := range plan.Updated {
+		fmt.Printf("update   %s/%s (%s)\n", res.LessonSite().Title, res.Path(), resource.FormatSize(res.Size))
+	}
+	for _, s := range plan.Skipped {
+		fmt.Printf("skip     %s/%s [%s]\n", s.LessonSite().Title, s.Path(), s.Reason)
+	}
+	for _, r := range plan.Removed {
+		fmt.Printf("removed  %s/%s\n", r.Site.Title, r.Title)
+	}
+	for _, c := range plan.Collisions {
+		fmt.Printf("rename   %s/%s -> %s (%s is taken)\n", c.Resource.LessonSite().Title, c.Resource.Path(), c.Renamed, c.Path)
+	}
+	for _, e := range plan.SiteErrors {
+		fmt.Printf("error    %s: %s\n", e.Site.Title, secret.Redact(e.Err.Error()))
+	}
+
+	fmt.Println(plan.Summary())
+}
@@ -1,15 +1,21 @@
 package main
 
-import "github.com/gen2brain/beeep"
+import (
+	"pandora/pkg/secret"
+
+	"github.com/gen2brain/beeep"
+)
 
 const (
 	pathToAppIcon = "icon/PandorAmicro.png"
 )
 
+// alert エラーを知らせる 秘密情報が表示されないよう伏せ字にしてから表示する
 func alert(text string) error {
-	return beeep.Alert("PandorA Error", text, pathToAppIcon)
+	return beeep.Alert("PandorA Error", secret.Redact(text), pathToAppIcon)
 }
 
+// notify 通知を表示する 秘密情報が表示されないよう伏せ字にしてから表示する
 func notify(text string) error {
-	return beeep.Notify("PandorA", text, pathToAppIcon)
+	return beeep.Notify("PandorA", secret.Redact(text), pathToAppIcon)
 }
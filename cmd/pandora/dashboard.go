@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"pandora/pkg/account"
+	"pandora/pkg/config"
+	"pandora/pkg/dashboard"
+	pandaapi "pandora/pkg/pandaAPI"
+)
+
+// board ブラウザから状態を確認するダッシュボード 無効にされている場合や起動できなかった場合はnil
+var board *dashboard.Server
+
+var _ dashboard.Backend = daemon{}
+
+// startDashboard 設定で有効にされていればダッシュボードを起動する
+func startDashboard(cfg *config.Config) {
+	if !cfg.Dashboard.Enabled {
+		return
+	}
+
+	token, err := dashboard.Token()
+	if err != nil {
+		log.Println("dashboard token error:", err)
+		return
+	}
+
+	s := dashboard.New(daemon{}, token)
+	if err := s.Start(cfg.Dashboard.Port); err != nil {
+		log.Println("dashboard listen error:", err)
+		return
+	}
+	board = s
+}
+
+// openDashboard ダッシュボードをブラウザで開く
+func openDashboard() {
+	if board == nil {
+		alert("The dashboard is disabled. Set dashboard.enabled to true and restart PandorA.")
+		return
+	}
+
+	if err := openFile(board.URL()); err != nil {
+		log.Println("open dashboard error:", err)
+		alert(err.Error())
+	}
+}
+
+func (daemon) Assignments(ctx context.Context) ([]pandaapi.Assignment, error) {
+	ecsID, password, _, err := account.ReadAccountInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _ := download.settings()
+	lic, err := pandaapi.NewClient(authenticator(cfg, ecsID, password))
+	if err != nil {
+		return nil, err
+	}
+
+	return lic.Assignments(ctx)
+}
+
+func (daemon) OpenFile(path string) error {
+	return openFile(path)
+}
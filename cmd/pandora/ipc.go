@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	"pandora/pkg/config"
+	"pandora/pkg/dir"
+	"pandora/pkg/ipc"
+	"pandora/pkg/resource"
+	"pandora/pkg/schedule"
+	"pandora/pkg/state"
+
+	"github.com/getlantern/systray"
+)
+
+// reloaded 設定が読み込み直されたことをメニューに知らせ、自動実行をやり直させる
+var reloaded = make(chan struct{}, 1)
+
+// daemon フォームやコマンドライン、二つ目に起動されたPandorAからの要求を処理する
+type daemon struct{}
+
+var _ ipc.Handler = daemon{}
+
+func (daemon) SyncNow() error {
+	// 開始できない理由は要求した側で表示させる
+	cfg, sched := download.settings()
+	if err := download.begin(cfg, true); err != nil {
+		return err
+	}
+
+	go func() {
+		defer download.end()
+		download.run(window, cfg, sched, true)
+	}()
+
+	return nil
+}
+
+func (daemon) SyncWait() (*resource.SyncReport, error) {
+	cfg, sched := download.settings()
+	if err := download.begin(cfg, true); err != nil {
+		return nil, err
+	}
+	defer download.end()
+
+	return download.run(window, cfg, sched, true)
+}
+
+func (daemon) Reload() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	dir.SetDownloadRoot(cfg.DownloadRoot())
+
+	// 読み込み直しただけで起動時の実行を行わないようにする
+	spec := cfg.ScheduleSpec()
+	spec.OnStartup = false
+	download.setSettings(cfg, schedule.New(spec, dir.StatePath(scheduleFile)))
+
+	select {
+	case reloaded <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (daemon) Status() ipc.Status {
+	_, sched := download.settings()
+	running, queued := download.status()
+	pausedUntil, _ := download.paused(time.Now())
+	last, _ := state.LastRun()
+
+	return ipc.Status{Running: running, Queued: queued, NextRun: sched.Next(), PausedUntil: pausedUntil, LastRun: last}
+}
+
+func (daemon) Quit() {
+	go systray.Quit()
+}
@@ -1,17 +1,29 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
-	"path/filepath"
 	"time"
 
 	"pandora/cmd/pandora/icon"
+	"pandora/pkg/account"
+	"pandora/pkg/config"
 	"pandora/pkg/dir"
+	"pandora/pkg/ipc"
+	"pandora/pkg/schedule"
+	"pandora/pkg/secret"
 
 	"github.com/getlantern/systray"
 )
 
+const (
+	// 次の自動実行の時刻を保存するファイルの名前
+	scheduleFile = "schedule.json"
+	// ログを書き込むファイルの名前
+	logFile = "pandoraError.log"
+)
+
 var (
 	window   *windowManager
 	download *downloadManager
@@ -25,7 +37,7 @@ func init() {
 func main() {
 	// ログ出力を設定
 	logfile, err := os.OpenFile(
-		filepath.Join(dir.WorkingDirecory, "pandoraError.log"),
+		dir.LogPath(logFile),
 		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
 		0666,
 	)
@@ -34,36 +46,151 @@ func main() {
 	}
 	defer logfile.Close()
 
-	log.SetOutput(logfile)
+	// ログにパスワードなどの秘密情報が残らないよう伏せ字にしてから書き込む
+	log.SetOutput(secret.NewRedactor(logfile))
 	log.SetFlags(log.Ldate | log.Ltime)
 
+	// 既に起動している場合は、起動中のPandorAにダウンロードを依頼して終了する
+	// ロックを持たずに起動すると他のPandorAと同時にダウンロードして記録が壊れるため、取得できない場合も終了する
+	lock, err := ipc.Acquire()
+	if err == ipc.ErrAlreadyRunning {
+		syncRunning()
+		return
+	}
+	if err != nil {
+		log.Println("ipc lock error:", err)
+		alert("PandorA cannot start: " + err.Error())
+		return
+	}
+
+	// 暗号化したファイルに保存する場合は、必要になった際にパスフレーズを尋ねる
+	account.SetPrompt(window.askPassphrase)
+
+	// 設定を読み込む 誤りがある場合は通知して既定の設定で起動する
+	cfg, err := config.Load()
+	if err != nil {
+		log.Println("load config error:", err)
+		alert(err.Error() + "\nPandorA starts with the default settings.")
+		cfg = config.Default()
+	}
+	dir.SetDownloadRoot(cfg.DownloadRoot())
+	download.setSettings(cfg, schedule.New(cfg.ScheduleSpec(), dir.StatePath(scheduleFile)))
+
+	// ポート番号の変更は再起動後に反映する
+	startDashboard(cfg)
+	if board != nil {
+		defer board.Close()
+	}
+
+	// 設定やスケジュールを用意してから要求を受け付ける 閉じるとロックも解放される
+	server, err := lock.Listen(daemon{})
+	if err != nil {
+		log.Println("ipc listen error:", err)
+		alert("PandorA cannot start: " + err.Error())
+		lock.Release()
+		return
+	}
+	defer server.Close()
+
 	systray.Run(menuReady, menuExit)
 }
 
 // menuReady メニューを初期化する
 func menuReady() {
 	// メニューバーにタブを設定
-	systray.SetTitle("PandorA")
+	systray.SetTitle(appTitle)
 	systray.SetIcon(icon.Data)
 	downloadButton := systray.AddMenuItem("Download", "Download resources in PandA")
+	pauseMenu := systray.AddMenuItem("Pause syncing", "Pause automatic downloads")
+	pauseHourButton := pauseMenu.AddSubMenuItem("For 1 hour", "Pause automatic downloads for 1 hour")
+	pauseTomorrowButton := pauseMenu.AddSubMenuItem("Until tomorrow", "Pause automatic downloads until tomorrow")
+	resumeButton := pauseMenu.AddSubMenuItem("Resume", "Resume automatic downloads")
+	recentMenu := systray.AddMenuItem("Recent", "Recently downloaded files")
+	coursesMenu := systray.AddMenuItem("Courses", "Open the folder of a course")
+	boxButton := systray.AddMenuItem("Open PandorA Box", "Open the download folder")
+	systray.AddSeparator()
+	reportButton := systray.AddMenuItem("Last Report", "Open the report of the last download")
+	dashboardButton := systray.AddMenuItem("Dashboard", "Open the dashboard in the browser")
+	logButton := systray.AddMenuItem("Open log", "Open the error log")
 	settingsButton := systray.AddMenuItem("Settings", "Settings")
+	systray.AddSeparator()
+	lastRunItem := systray.AddMenuItem("Last sync: -", "Result of the last download")
+	lastRunItem.Disable()
+	nextRunItem := systray.AddMenuItem("Next sync: -", "Time of the next automatic download")
+	nextRunItem.Disable()
 	quitButton := systray.AddMenuItem("Quit", "Quit PandorA")
 
-	// 4時間おきにダウンロードを実行
-	ticker := time.NewTicker(4 * time.Hour)
+	openMissing := func(path string) {
+		openPath(path, "The file no longer exists.")
+	}
+	menu := &trayMenu{
+		recent:  newSubmenu(recentMenu, "No files yet", openMissing),
+		courses: newSubmenu(coursesMenu, "No courses yet", openMissing),
+		pause:   pauseMenu,
+		resume:  resumeButton,
+		lastRun: lastRunItem,
+		nextRun: nextRunItem,
+	}
+	menu.refresh(time.Now())
+
+	// 設定された間隔もしくは時刻にダウンロードを実行し、次の実行時刻をメニューに表示する
+	// 設定が読み込み直された場合は新しいスケジュールでやり直す
+	startSchedule := func() context.CancelFunc {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, sched := download.settings()
+		go sched.Run(ctx, func() {
+			go download.scheduled(window)
+		}, func(time.Time) {
+			refreshMenu()
+		})
+		return cancel
+	}
+	stopSchedule := startSchedule()
+	defer func() { stopSchedule() }()
+
+	// 一時停止の終了や日付の変化を表示に反映する
+	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			go download.excute(window, false)
-
 		case <-downloadButton.ClickedCh:
 			go download.excute(window, true)
 
+		case <-pauseHourButton.ClickedCh:
+			download.pause(time.Now().Add(time.Hour))
+
+		case <-pauseTomorrowButton.ClickedCh:
+			download.pause(tomorrow(time.Now()))
+
+		case <-resumeButton.ClickedCh:
+			download.pause(time.Time{})
+
+		case <-boxButton.ClickedCh:
+			go openPath(dir.PandorAPath(), "There is no PandorA Box yet. Please download first.")
+
+		case <-reportButton.ClickedCh:
+			go openReport()
+
+		case <-dashboardButton.ClickedCh:
+			go openDashboard()
+
+		case <-logButton.ClickedCh:
+			go openPath(dir.LogPath(logFile), "There is no log yet.")
+
 		case <-settingsButton.ClickedCh:
 			go window.show()
 
+		case <-menuRefresh:
+			menu.refresh(time.Now())
+
+		case <-ticker.C:
+			menu.refreshStatus(time.Now())
+
+		case <-reloaded:
+			stopSchedule()
+			stopSchedule = startSchedule()
+
 		case <-quitButton.ClickedCh:
 			systray.Quit()
 			return
@@ -71,6 +198,32 @@ func menuReady() {
 	}
 }
 
+// formatNextRun 次の実行時刻をメニューに表示する形式にする 今日の場合は時刻のみ
+func formatNextRun(next, now time.Time) string {
+	if next.IsZero() {
+		return "off"
+	}
+
+	return formatTime(next, now)
+}
+
+// syncRunning 起動中のPandorAにダウンロードを依頼する 開始されなかった場合は理由を知らせる
+func syncRunning() {
+	c, err := ipc.Dial()
+	if err != nil {
+		// 応答がない場合はpandora-cliがダウンロード中
+		log.Println("ipc error:", err)
+		alert("Another PandorA is downloading. Start PandorA again after it finishes.")
+		return
+	}
+	defer c.Close()
+
+	if err := c.Sync(); err != nil {
+		// 実行中やクールダウン中の場合は、起動中のPandorAが設定された言語で理由を返す
+		alert(err.Error())
+	}
+}
+
 // menuExit メニューを終了する
 func menuExit() {
 	window.quit()
@@ -1,87 +1,323 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os/exec"
 	"pandora/pkg/account"
+	"pandora/pkg/config"
 	"pandora/pkg/dir"
+	"pandora/pkg/netwatch"
 	pandaapi "pandora/pkg/pandaAPI"
 	"pandora/pkg/resource"
+	"pandora/pkg/schedule"
+	"pandora/pkg/secret"
+	"pandora/pkg/state"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// オフラインの間に待機している自動実行が、接続状態を調べ直す間隔
+const offlinePollInterval = time.Minute
+
 // downloadManager ダウンロード実行中に並列して実行されたり、短いタイムスパンでダウンロードが実行されないように制御する
 type downloadManager struct {
-	isRunning        bool
-	lastExecutedTime time.Time
-	mu               sync.Mutex
-	wg               sync.WaitGroup
+	config    *config.Config
+	schedule  *schedule.Scheduler
+	isRunning bool
+	// オフラインのため、接続されるまで待機している自動実行がある
+	queued bool
+	// 自動実行を一時停止している場合は再開する時刻
+	pausedUntil time.Time
+	mu          sync.Mutex
+	wg          sync.WaitGroup
 }
 
-func (d *downloadManager) excute(window *windowManager, clicked bool) {
-	defer func() {
-		d.isRunning = false
-	}()
+// settings 現在の設定と自動実行のスケジューラーを返す
+func (d *downloadManager) settings() (*config.Config, *schedule.Scheduler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
+	return d.config, d.schedule
+}
+
+// setSettings 読み込み直した設定と、それに基づくスケジューラーに差し替える
+func (d *downloadManager) setSettings(cfg *config.Config, s *schedule.Scheduler) {
 	d.mu.Lock()
-	if !d.isRunning {
-		d.isRunning = true
-		d.wg.Add(1)
-		d.mu.Unlock()
+	defer d.mu.Unlock()
+
+	d.config, d.schedule = cfg, s
+}
+
+// status 実行中かどうかと、オフラインのため待機している自動実行があるかを返す
+func (d *downloadManager) status() (running, queued bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.isRunning, d.queued
+}
+
+// pause untilまで自動実行を行わない ゼロ値を渡すと再開する
+func (d *downloadManager) pause(until time.Time) {
+	d.mu.Lock()
+	d.pausedUntil = until
+	d.mu.Unlock()
 
-		if min := time.Now().Sub(d.lastExecutedTime).Minutes(); min < 10 && clicked {
-			// 前のダウンロードからの経過時間が10分以内にユーザーによる再度の実行の要求があれば警告を出して終了する
-			alert(fmt.Sprintf("PandorA needs cool time. Please try after %d minute(s) later at least.", uint(10-min)))
+	refreshMenu()
+}
+
+// paused 自動実行を一時停止している場合は再開する時刻を返す
+func (d *downloadManager) paused(now time.Time) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Before(d.pausedUntil) {
+		return d.pausedUntil, true
+	}
+
+	return time.Time{}, false
+}
+
+// scheduled 自動実行を行う PandAに接続できない場合は通知せずに待機し、接続されてから一度だけ実行する
+func (d *downloadManager) scheduled(window *windowManager) {
+	if until, ok := d.paused(time.Now()); ok {
+		log.Printf("scheduled download is skipped; paused until %s", until.Format("2006-01-02 15:04"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if c := pandaapi.CheckConnectivity(ctx); c != pandaapi.Online {
+		d.mu.Lock()
+		if d.queued {
+			// 既に待機している実行がある場合はそれに任せる
+			d.mu.Unlock()
 			return
 		}
+		d.queued = true
+		d.mu.Unlock()
 
-		ecsID, password, rejectable, err := account.ReadAccountInfo()
-		if err != nil {
-			log.Println("read account error 1:", err)
-			// アカウント情報を入力させる
-			window.show()
-			window.wg.Wait() // アカウント情報の入力を待つ
-		}
-		ecsID, password, rejectable, err = account.ReadAccountInfo()
-		if err != nil {
-			log.Println("read account error 2:", err)
-			// 2回目にエラーが出た場合はエラーを表示して終了する
-			alert(err.Error())
-			return
+		log.Printf("scheduled download is queued until PandA is reachable (%s)", c)
+		netwatch.WaitOnline(ctx, func(ctx context.Context) bool {
+			return pandaapi.CheckConnectivity(ctx) == pandaapi.Online
+		}, netwatch.Changes(ctx), offlinePollInterval)
+
+		d.mu.Lock()
+		d.queued = false
+		d.mu.Unlock()
+		log.Println("PandA is reachable again; running the queued download")
+	}
+
+	d.excute(window, false)
+}
+
+// busyError 既にダウンロード中のため開始しなかったことを表す
+type busyError struct {
+	lang string
+}
+
+func (e busyError) Error() string {
+	return localize(e.lang, "既にダウンロード中です。", "PandorA is already downloading.")
+}
+
+// begin 実行を開始できるか確かめ、開始できる場合は実行中にする
+// 実行中の場合や、手動の実行で前回の開始からクールダウンが経過していない場合は、その理由を設定された言語で返す
+func (d *downloadManager) begin(cfg *config.Config, clicked bool) error {
+	lang := cfg.Notifications.Language
+
+	d.mu.Lock()
+	if d.isRunning {
+		d.mu.Unlock()
+		return busyError{lang: lang}
+	}
+
+	// 再起動しても回避できないよう、保存された最後の実行の記録からクールダウンを数える
+	last, err := state.LastRun()
+	if err != nil {
+		log.Println("read last run error:", err)
+	}
+	if wait := last.CooldownRemaining(time.Now(), time.Duration(cfg.Schedule.Cooldown)); clicked && wait > 0 {
+		d.mu.Unlock()
+		return errors.New(cooldownMessage(lang, last.LastStart, wait))
+	}
+
+	d.isRunning = true
+	d.wg.Add(1)
+	d.mu.Unlock()
+	refreshMenu()
+
+	return nil
+}
+
+// end 実行中の状態を解除する
+func (d *downloadManager) end() {
+	d.mu.Lock()
+	d.isRunning = false
+	d.mu.Unlock()
+	// 保存された記録から最近の資料や前回の結果をメニューに表示し直す
+	refreshMenu()
+	// wg.Waitを使えばここでダウンロードが終了することを待つことができる
+	d.wg.Done()
+}
+
+func (d *downloadManager) excute(window *windowManager, clicked bool) {
+	// 実行中に設定が読み込み直されても、開始時の設定を使い続ける
+	cfg, sched := d.settings()
+	if err := d.begin(cfg, clicked); err != nil {
+		if clicked {
+			refuse(err)
 		}
+		return
+	}
+	defer d.end()
 
+	d.run(window, cfg, sched, clicked)
+}
+
+// refuse 手動の実行を開始しなかった理由を知らせる 実行中の場合は通知のみにする
+func refuse(err error) {
+	if _, ok := err.(busyError); ok {
+		notify(err.Error())
+		return
+	}
+
+	alert(err.Error())
+}
+
+// run beginで実行中にした後でダウンロードを行い、結果を返す 結果は通知とレポートでも知らせる
+func (d *downloadManager) run(window *windowManager, cfg *config.Config, sched *schedule.Scheduler, clicked bool) (*resource.SyncReport, error) {
+	ecsID, password, rejectable, err := account.ReadAccountInfo()
+	// パスフレーズが誤っていた場合は、フォームではなくもう一度パスフレーズを尋ねる
+	if err != nil && !account.NeedsPassphrase(err) {
+		log.Println("read account error 1:", err)
+		// アカウント情報を入力させる
+		window.show()
+		window.wg.Wait() // アカウント情報の入力を待つ
+	}
+	ecsID, password, rejectable, err = account.ReadAccountInfo()
+	if err != nil {
+		log.Println("read account error 2:", err)
+		// 2回目にエラーが出た場合はエラーを表示して終了する
+		alert(err.Error())
+		return nil, err
+	}
+
+	notifications := cfg.Notifications
+	if !clicked && sched.Quiet(time.Now()) {
+		// 通知しない時間帯の自動実行は結果をログとレポートにのみ残す
+		notifications.OnSuccess = false
+		notifications.OnError = false
+	}
+	if notifications.OnSuccess {
 		notify("NOW DOWNLOADING")
+	}
+
+	run := state.Run{LastStart: time.Now(), Result: state.ResultRunning, Manual: clicked}
+	if last, err := state.LastRun(); err == nil {
+		run.LastSuccess = last.LastSuccess
+	}
+	d.saveRun(run)
+
+	opts := resource.NewOptions(cfg, showProgress)
+	// on_conflict: ask の場合はフォームのウィンドウで尋ねる
+	opts.Ask = window.askConflict
+	report, err := resource.Sync(authenticator(cfg, ecsID, password), rejectable, opts)
+	run.Duration = time.Since(run.LastStart)
+	if err != nil {
+		log.Println("Download error:", err)
+		run.Result = state.ResultFailed
+		run.Error = err.Error()
+		d.saveRun(run)
 
-		d.lastExecutedTime = time.Now()
-		if errors := resource.Download(ecsID, password, rejectable); len(errors) > 0 {
-			for _, err := range errors {
-				log.Println("Download error:", err)
-
-				switch err.(type) {
-				case *pandaapi.NetworkError:
-					alert("Network Error: something wrong with connecting the Internet")
-				case *pandaapi.DeadPandAError:
-					alert(err.Error())
-				case *pandaapi.FailedLoginError:
-					alert(err.Error())
-					go window.show()
-				default:
-					alert("System Error: " + err.Error())
-				}
-			}
-		} else {
-			notify("Download succeeded!")
+		var failed *pandaapi.FailedLoginError
+		if errors.As(err, &failed) {
+			go window.show()
 		}
-		// wg.Waitを使えばここでダウンロードが終了することを待つことができる
-		d.wg.Done()
-	} else {
-		d.mu.Unlock()
+
+		// 自動実行で接続できなかった場合は通知しない
+		if notifications.OnError && (clicked || !pandaapi.IsNetworkError(err)) {
+			// 原因に応じたメッセージを設定された言語で知らせる
+			alert(pandaapi.Message(err, notifications.Language))
+		}
+		return nil, err
+	}
+
+	run.LastSuccess = time.Now()
+	run.New, run.Updated = report.New, report.Updated
+	run.Result = state.ResultSuccess
+	if report.HasErrors() {
+		run.Result = state.ResultPartial
+		run.Error = report.Errors[0].Message
+	}
+	d.saveRun(run)
+
+	if _, _, err := report.Save(dir.StateDir()); err != nil {
+		log.Println("save report error:", err)
+	}
+
+	// エラーは一つの通知にまとめ、詳細はレポートに記録する
+	for _, g := range report.Errors {
+		log.Printf("Download error: %s x%d: %s", g.Kind, g.Count, g.Message)
 	}
+	if report.HasErrors() {
+		if notifications.OnError {
+			alert(report.Summary() + "\nSee \"Last Report\" for details.")
+		}
+	} else if notifications.OnSuccess {
+		notify(report.Summary())
+	}
+
+	return report, nil
 }
 
+// authenticator 二段階認証の秘密鍵も含めた認証情報で、設定されたログイン方法を用いるAuthenticatorを返す
+func authenticator(cfg *config.Config, ecsID string, password secret.String) pandaapi.Authenticator {
+	cred := &account.Credential{ECSID: ecsID, Password: password}
+	if stored, err := account.ReadCredential(); err == nil && stored.ECSID == ecsID {
+		cred = stored
+	}
+
+	return account.NewAuthenticator(cfg, cred)
+}
+
+// saveRun 実行の記録を保存する
+func (d *downloadManager) saveRun(run state.Run) {
+	if err := state.SaveRun(run); err != nil {
+		log.Println("save last run error:", err)
+	}
+}
+
+// cooldownMessage クールダウン中に手動で実行された場合に表示するメッセージ
+func cooldownMessage(lang string, lastStart time.Time, wait time.Duration) string {
+	minutes := uint(math.Ceil(wait.Minutes()))
+	at := time.Now().Add(wait).Format("15:04")
+	last := lastStart.Local().Format("15:04")
+
+	return localize(lang,
+		fmt.Sprintf("PandAの負荷を抑えるため、前回のダウンロード(%s開始)から間もない間は実行できません。%s以降(あと%d分)にもう一度お試しください。", last, at, minutes),
+		fmt.Sprintf("PandorA last downloaded at %s and needs a break to keep the load on PandA low. Please try again after %s (in %d minute(s)).", last, at, minutes),
+	)
+}
+
+// localize 設定された言語に応じてjaかenを返す
+func localize(lang, ja, en string) string {
+	if lang == config.LanguageJapanese {
+		return ja
+	}
+
+	return en
+}
+
+// フォームにパスフレーズを標準入力から読み込ませる引数
+const passphraseStdinArg = "--passphrase-stdin"
+
 // windowManager ウィンドウが画面に一つだけ表示されるよう管理する
 type windowManager struct {
 	cmd       *exec.Cmd
@@ -104,8 +340,13 @@ func (w *windowManager) show() {
 		w.wg.Add(1)
 		w.mu.Unlock()
 
-		// UIを起動
+		// UIを起動 入力済みのパスフレーズがあれば、保存されているアカウント情報を表示できるよう標準入力で渡す
+		// 環境変数で渡すと同じユーザーの他のプロセスから読めてしまう
 		w.cmd = exec.Command(w.path)
+		if pass := account.Passphrase(); !pass.IsEmpty() {
+			w.cmd = exec.Command(w.path, passphraseStdinArg)
+			w.cmd.Stdin = strings.NewReader(pass.Reveal() + "\n")
+		}
 		if err := w.cmd.Run(); err != nil {
 			log.Println("show error:", err)
 			alert(err.Error())
@@ -119,6 +360,39 @@ func (w *windowManager) show() {
 	}
 }
 
+// askConflict 保存先に既にファイルがある場合の対応をフォームのウィンドウで尋ねる
+// ウィンドウを表示できない場合や選ばずに閉じられた場合は両方残す
+func (w *windowManager) askConflict(c resource.Conflict) string {
+	out, err := exec.Command(w.path, "conflict", c.Path, strconv.FormatBool(c.Owned)).Output()
+	if err != nil {
+		log.Println("ask conflict error:", err)
+		return config.ConflictKeepBoth
+	}
+
+	switch action := strings.TrimSpace(string(out)); action {
+	case config.ConflictOverwrite, config.ConflictKeepBoth, config.ConflictSkip:
+		return action
+	}
+
+	log.Println("conflict is not answered, keeping both:", c.Path)
+	return config.ConflictKeepBoth
+}
+
+// askPassphrase 認証情報の暗号化に用いるパスフレーズをフォームのウィンドウで尋ねる
+func (w *windowManager) askPassphrase() (secret.String, error) {
+	out, err := exec.Command(w.path, "passphrase").Output()
+	if err != nil {
+		return "", err
+	}
+
+	pass := secret.String(strings.TrimRight(string(out), "\r\n"))
+	if pass.IsEmpty() {
+		return "", account.ErrPassphraseRequired
+	}
+
+	return pass, nil
+}
+
 // ウィンドウを終了する
 func (w *windowManager) quit() {
 	if w.cmd != nil {
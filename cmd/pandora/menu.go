@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pandora/pkg/dir"
+	"pandora/pkg/state"
+
+	"github.com/getlantern/systray"
+)
+
+// Recentに表示する資料の数
+const recentFiles = 10
+
+// menuRefresh メニューの表示を作り直す要求
+var menuRefresh = make(chan struct{}, 1)
+
+// refreshMenu ダウンロードの記録や実行の状態が変わったことをメニューに知らせる
+func refreshMenu() {
+	select {
+	case menuRefresh <- struct{}{}:
+	default:
+	}
+}
+
+// entry サブメニューの項目 選ぶとtargetを開く
+type entry struct {
+	title, tooltip, target string
+}
+
+// submenu 開く対象を差し替えられるサブメニュー
+// systrayでは項目を削除できないため、足りなければ追加し、余った項目は隠す
+type submenu struct {
+	parent *systray.MenuItem
+	// 項目がない場合に表示する項目
+	empty *systray.MenuItem
+	open  func(target string)
+
+	mu      sync.Mutex
+	items   []*systray.MenuItem
+	targets []string
+}
+
+func newSubmenu(parent *systray.MenuItem, emptyTitle string, open func(target string)) *submenu {
+	s := &submenu{parent: parent, open: open}
+	s.empty = parent.AddSubMenuItem(emptyTitle, "")
+	s.empty.Disable()
+
+	return s
+}
+
+// set 項目をentriesに置き換える
+func (s *submenu) set(entries []entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.items) < len(entries) {
+		item := s.parent.AddSubMenuItem("", "")
+		s.items = append(s.items, item)
+		s.targets = append(s.targets, "")
+		go s.watch(len(s.items)-1, item)
+	}
+
+	for i, item := range s.items {
+		if i >= len(entries) {
+			s.targets[i] = ""
+			item.Hide()
+			continue
+		}
+		item.SetTitle(entries[i].title)
+		item.SetTooltip(entries[i].tooltip)
+		s.targets[i] = entries[i].target
+		item.Show()
+	}
+
+	if len(entries) == 0 {
+		s.empty.Show()
+	} else {
+		s.empty.Hide()
+	}
+}
+
+// watch i番目の項目が選ばれるたびに、その時点の対象を開く
+func (s *submenu) watch(i int, item *systray.MenuItem) {
+	for range item.ClickedCh {
+		s.mu.Lock()
+		target := s.targets[i]
+		s.mu.Unlock()
+
+		if target != "" {
+			s.open(target)
+		}
+	}
+}
+
+// trayMenu ダウンロードの記録から作り直すメニューの項目
+type trayMenu struct {
+	recent  *submenu
+	courses *submenu
+	pause   *systray.MenuItem
+	resume  *systray.MenuItem
+	lastRun *systray.MenuItem
+	nextRun *systray.MenuItem
+}
+
+// refresh 保存された記録と現在の状態からメニューの表示を作り直す
+func (m *trayMenu) refresh(now time.Time) {
+	if store, err := state.Default(); err != nil {
+		log.Println("read state error:", err)
+	} else {
+		m.recent.set(recentEntries(store))
+		m.courses.set(courseEntries(store))
+	}
+
+	m.refreshStatus(now)
+}
+
+// refreshStatus 前回と次回の実行、一時停止の表示を更新する
+func (m *trayMenu) refreshStatus(now time.Time) {
+	running, _ := download.status()
+	last, err := state.LastRun()
+	if err != nil {
+		log.Println("read last run error:", err)
+	}
+	if running {
+		m.lastRun.SetTitle("Syncing...")
+	} else {
+		m.lastRun.SetTitle("Last sync: " + formatLastRun(last, now))
+	}
+
+	_, sched := download.settings()
+	if until, ok := download.paused(now); ok {
+		m.pause.SetTitle("Paused until " + formatTime(until, now))
+		m.resume.Enable()
+		m.nextRun.SetTitle("Next sync: paused")
+	} else {
+		m.pause.SetTitle("Pause syncing")
+		m.resume.Disable()
+		m.nextRun.SetTitle("Next sync: " + formatNextRun(sched.Next(), now))
+	}
+}
+
+// recentEntries 最近ダウンロードした資料の項目を返す 削除されたファイルは除く
+func recentEntries(store *state.Store) []entry {
+	entries := make([]entry, 0, recentFiles)
+	for _, r := range store.Recent(recentFiles) {
+		if !dir.Exists(r.Path) {
+			continue
+		}
+		title := filepath.Base(r.Path)
+		if r.SiteTitle != "" {
+			title += " (" + r.SiteTitle + ")"
+		}
+		entries = append(entries, entry{title: title, tooltip: r.Path, target: r.Path})
+	}
+
+	return entries
+}
+
+// courseEntries 資料を保存した授業サイトのフォルダの項目を返す
+func courseEntries(store *state.Store) []entry {
+	entries := make([]entry, 0)
+	for _, s := range store.Sites() {
+		if s.Folder == "" || !dir.Exists(s.Folder) {
+			continue
+		}
+		entries = append(entries, entry{title: s.Title, tooltip: s.Folder, target: s.Folder})
+	}
+
+	return entries
+}
+
+// formatLastRun 前回の実行の結果をメニューに表示する形式にする (例: 12:04 (3 new))
+func formatLastRun(r state.Run, now time.Time) string {
+	if r.LastStart.IsZero() {
+		return "-"
+	}
+
+	at := formatTime(r.LastStart, now)
+	switch r.Result {
+	case state.ResultFailed:
+		return at + " (failed)"
+	case state.ResultRunning:
+		// 実行中に終了した場合
+		return at + " (interrupted)"
+	}
+
+	result := fmt.Sprintf("%d new", r.New)
+	if r.Updated > 0 {
+		result += fmt.Sprintf(", %d updated", r.Updated)
+	}
+	if r.Result == state.ResultPartial {
+		result += ", with errors"
+	}
+
+	return at + " (" + result + ")"
+}
+
+// formatTime メニューに表示する時刻の形式にする 今日の場合は時刻のみ
+func formatTime(t, now time.Time) string {
+	t = t.Local()
+	if y, m, d := t.Date(); y == now.Year() && m == now.Month() && d == now.Day() {
+		return t.Format("15:04")
+	}
+
+	return t.Format("Mon 15:04")
+}
+
+// tomorrow 翌日の0時を返す
+func tomorrow(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
+
+// openPath ファイルやフォルダを開く 存在しない場合はmissingを知らせる
+func openPath(path, missing string) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		alert(missing)
+		return
+	}
+
+	if err := openFile(path); err != nil {
+		log.Println("open error:", err)
+		alert(err.Error())
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"pandora/pkg/dir"
+	"pandora/pkg/resource"
+	"runtime"
+)
+
+// openFile ファイルやフォルダをOSの既定のアプリケーションで開く
+func openFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// 終了は待たないが、ゾンビプロセスが残らないよう回収する
+	go cmd.Wait()
+	return nil
+}
+
+// openReport 最後のダウンロードのレポートを開く
+func openReport() {
+	path := resource.ReportPath(dir.StateDir())
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		alert("There is no report yet. Please download first.")
+		return
+	}
+
+	if err := openFile(path); err != nil {
+		log.Println("open report error:", err)
+		alert(err.Error())
+	}
+}
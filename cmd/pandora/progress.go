@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"pandora/pkg/resource"
+
+	"github.com/getlantern/systray"
+)
+
+const (
+	// メニューバーに表示するアプリケーション名
+	appTitle = "PandorA"
+)
+
+// showProgress ダウンロードの進捗をメニューバーのタイトルとツールチップに表示する
+func showProgress(e resource.ProgressEvent) {
+	if e.Kind == resource.Finished {
+		systray.SetTitle(appTitle)
+		systray.SetTooltip(appTitle)
+		return
+	}
+
+	systray.SetTitle(fmt.Sprintf(
+		"%s %d/%d · %s",
+		appTitle,
+		e.Totals.Done(),
+		e.Totals.Files,
+		resource.FormatSize(e.Totals.Transferred),
+	))
+	systray.SetTooltip(fmt.Sprintf(
+		"Downloading %s / %s (%s of %s)",
+		e.Resource.LessonSite().Title,
+		e.Resource.Title,
+		resource.FormatSize(e.Totals.Transferred),
+		resource.FormatSize(e.Totals.Bytes),
+	))
+}
@@ -1,64 +1,155 @@
 package account
 
 import (
-	"encoding/binary"
 	"errors"
 	"io/ioutil"
+	"os"
+	"pandora/pkg/config"
+	"pandora/pkg/crypt"
 	"pandora/pkg/dir"
 	"pandora/pkg/resource"
+	"pandora/pkg/secret"
 	"strconv"
 	"strings"
 )
 
 const (
-	// アカウント情報を記録するファイルの名前
-	accountFile = "account.dat"
+	// 旧形式(rot47で難読化したもの)のアカウント情報を記録するファイルの名前
+	legacyAccountFile = "account.dat"
 )
 
 // WriteAccountInfo アカウント情報を書き込む
-func WriteAccountInfo(ecsID, password string, rejectable *resource.RejectableType) error {
-	rejectNum := rejectable.Encode()
-	data := []byte(ecsID + ":" + password + ":" + rejectNum)
+// 同じECS-IDのワンタイムパスワードの秘密鍵が保存されていれば引き継ぐ
+func WriteAccountInfo(ecsID string, password secret.String, rejectable *resource.RejectableType) error {
+	cred := &Credential{ECSID: ecsID, Password: password}
+	if old, err := ReadCredential(); err == nil && old.ECSID == ecsID {
+		cred.TOTPSecret = old.TOTPSecret
+	}
 
-	file, err := dir.FetchSettingsFile(accountFile)
-	if err != nil {
+	if err := WriteCredential(cred); err != nil {
 		return err
 	}
 
-	if err := binary.Write(file, binary.LittleEndian, rot47(data)); err != nil {
+	return writeRejectable(rejectable)
+}
+
+// WriteCredential 認証情報を保存する
+func WriteCredential(cred *Credential) error {
+	store, err := DefaultStore()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return store.Save(cred)
 }
 
 // ReadAccountInfo アカウント情報の読み出しを行う
-func ReadAccountInfo() (ecsID, password string, rejectable *resource.RejectableType, err error) {
-	file, err := dir.FetchSettingsFile(accountFile)
+func ReadAccountInfo() (ecsID string, password secret.String, rejectable *resource.RejectableType, err error) {
+	cred, err := ReadCredential()
 	if err != nil {
 		return "", "", nil, err
 	}
 
-	content, err := ioutil.ReadAll(file)
+	rejectable, err = readRejectable()
 	if err != nil {
-		return "", "", nil, err
+		return cred.ECSID, cred.Password, nil, err
+	}
+
+	return cred.ECSID, cred.Password, rejectable, nil
+}
+
+// ReadCredential 認証情報の読み出しを行う
+// 旧形式のaccount.datが残っている場合は認証情報の保存先へ移行する
+func ReadCredential() (*Credential, error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := store.Load()
+	if err == crypt.ErrDecrypt {
+		// 誤ったパスフレーズを使い続けないよう、次は尋ね直す
+		forgetPassphrase()
+	}
+	if err == ErrNotFound {
+		var rejectable *resource.RejectableType
+		cred, rejectable, err = MigrateLegacyFile(dir.ConfigPath(legacyAccountFile), store)
+		if err == nil {
+			err = writeRejectable(rejectable)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cred, nil
+}
+
+// readRejectable ダウンロードしないファイル形式の設定を設定ファイルから読み出す
+func readRejectable() (*resource.RejectableType, error) {
+	c, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	r := resource.RejectableType(c.Filters.Reject)
+	return &r, nil
+}
+
+// writeRejectable ダウンロードしないファイル形式の設定を設定ファイルに書き込む
+// 環境変数などによる上書きは保存しないよう、設定ファイルの内容のみを読み込んで書き換える
+func writeRejectable(rejectable *resource.RejectableType) error {
+	c, err := config.LoadFile()
+	if err != nil {
+		return err
+	}
+
+	c.Filters.Reject = config.Reject(*rejectable)
+	return c.Save()
+}
+
+// MigrateLegacyFile 旧形式のアカウント情報のファイルを読み出して認証情報をstoreへ保存し、旧ファイルを削除する
+// 旧ファイルが存在しない場合はErrNotFoundを返す
+func MigrateLegacyFile(path string, store Store) (*Credential, *resource.RejectableType, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(content) == 0 {
+		// 旧バージョンは読み出しの際に空のファイルを作成していた
+		os.Remove(path)
+		return nil, nil, ErrNotFound
 	}
 
 	text := strings.SplitN(string(rot47(content)), ":", 3)
 	if len(text) != 3 {
-		err = errors.New("Invalid format")
-		return
+		return nil, nil, errors.New("Invalid format")
 	}
 
-	var rejectNum string
-	ecsID, password, rejectNum = text[0], text[1], text[2]
-	num, err := strconv.Atoi(rejectNum)
+	num, err := strconv.Atoi(text[2])
 	if err != nil {
-		return ecsID, password, nil, err
+		return nil, nil, err
 	}
-	rejectable = resource.DecodeRejectableType(uint(num))
 
-	return
+	secret.Register(text[1])
+	cred := &Credential{ECSID: text[0], Password: secret.String(text[1])}
+	if err := store.Save(cred); err != nil {
+		return nil, nil, err
+	}
+
+	// パスワードが復元できる形で残らないよう上書きしてから削除する
+	if err := ioutil.WriteFile(path, make([]byte, len(content)), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, nil, err
+	}
+
+	return cred, resource.DecodeRejectableType(uint(num)), nil
 }
 
 // ASCIIコードで33(!)-126(~)をrotする
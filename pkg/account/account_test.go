@@ -0,0 +1,137 @@
+package account_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"pandora/pkg/account"
+	"pandora/pkg/secret"
+)
+
+func TestFileStore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "credentials.dat")
+	store := account.NewFileStore(path, []byte("passphrase"))
+
+	if _, err := store.Load(); err != account.ErrNotFound {
+		t.Fatalf("empty store: got %v", err)
+	}
+
+	want := account.Credential{ECSID: "a0123456", Password: "p@ss:word", TOTPSecret: "JBSWY3DPEHPK3PXP"}
+	if err := store.Save(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), want.Password.Reveal()) {
+		t.Error("password is stored in plain text")
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("permission is %o, want 600", perm)
+		}
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+
+	if _, err := account.NewFileStore(path, []byte("wrong")).Load(); err == nil {
+		t.Error("loaded with a wrong passphrase")
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err != account.ErrNotFound {
+		t.Errorf("deleted store: got %v", err)
+	}
+}
+
+func TestMigrateLegacyFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// "a0123456:p@ssword:14" をrot47で難読化したもの
+	legacy := filepath.Join(tmp, "account.dat")
+	if err := ioutil.WriteFile(legacy, []byte("2_`abcdeiAoDDH@C5i`c"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	store := account.NewFileStore(filepath.Join(tmp, "credentials.dat"), []byte("passphrase"))
+	cred, rejectable, err := account.MigrateLegacyFile(legacy, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cred.ECSID != "a0123456" || cred.Password != "p@ssword" {
+		t.Errorf("unexpected credential: %+v", cred)
+	}
+	if rejectable.Encode() != "14" {
+		t.Errorf("unexpected reject code: %s", rejectable.Encode())
+	}
+
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("legacy file is not removed")
+	}
+
+	if stored, err := store.Load(); err != nil || *stored != *cred {
+		t.Errorf("credential is not saved to the store: %+v, %v", stored, err)
+	}
+
+	if _, _, err := account.MigrateLegacyFile(legacy, store); err != account.ErrNotFound {
+		t.Errorf("second migration: got %v", err)
+	}
+}
+
+// パスフレーズが与えられていなければ鍵を生成せずにエラーを返す
+func TestPassphraseRequired(t *testing.T) {
+	os.Setenv("PANDORA_CREDENTIAL_STORE", account.StoreFile)
+	os.Unsetenv(account.PassphraseEnv)
+	defer os.Unsetenv("PANDORA_CREDENTIAL_STORE")
+
+	if _, err := account.DefaultStore(); err != account.ErrPassphraseRequired || !account.NeedsPassphrase(err) {
+		t.Fatalf("got %v, want ErrPassphraseRequired", err)
+	}
+
+	asked := 0
+	account.SetPrompt(func() (secret.String, error) {
+		asked++
+		return "passphrase", nil
+	})
+	defer account.SetPrompt(nil)
+	defer account.SetPassphrase("")
+
+	for i := 0; i < 2; i++ {
+		if _, err := account.DefaultStore(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if asked != 1 {
+		t.Errorf("asked %d times", asked)
+	}
+}
@@ -0,0 +1,20 @@
+package account
+
+import (
+	"pandora/pkg/config"
+	pandaapi "pandora/pkg/pandaAPI"
+)
+
+// NewAuthenticator 設定されたログイン方法で認証情報を用いてログインするAuthenticatorを返す
+func NewAuthenticator(c *config.Config, cred *Credential) pandaapi.Authenticator {
+	switch c.Auth.Method {
+	case config.AuthCASTOTP:
+		return &pandaapi.CASTOTP{ECSID: cred.ECSID, Password: cred.Password, Secret: cred.TOTPSecret}
+	case config.AuthSAML:
+		return &pandaapi.SAMLPost{ECSID: cred.ECSID, Password: cred.Password, LoginURL: c.Auth.SAMLLoginURL}
+	case config.AuthCookies:
+		return &pandaapi.CookieFile{Path: c.CookieFile()}
+	}
+
+	return &pandaapi.CASForm{ECSID: cred.ECSID, Password: cred.Password}
+}
@@ -0,0 +1,176 @@
+package account
+
+import (
+	"errors"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// freedesktop Secret Service APIの名前
+// https://specifications.freedesktop.org/secret-service/
+const (
+	secretServiceName   = "org.freedesktop.secrets"
+	secretServicePath   = dbus.ObjectPath("/org/freedesktop/secrets")
+	defaultCollection   = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	serviceInterface    = "org.freedesktop.Secret.Service"
+	collectionInterface = "org.freedesktop.Secret.Collection"
+	itemInterface       = "org.freedesktop.Secret.Item"
+	sessionInterface    = "org.freedesktop.Secret.Session"
+
+	itemLabel      = "org.freedesktop.Secret.Item.Label"
+	itemAttributes = "org.freedesktop.Secret.Item.Attributes"
+
+	// プロンプトが不要な場合に返されるオブジェクトパス
+	noPrompt = dbus.ObjectPath("/")
+)
+
+var (
+	// ErrLocked キーリングがロックされており、ユーザーによる解除が必要な場合のエラー
+	ErrLocked = errors.New("secret service: the keyring is locked")
+
+	// PandorAの認証情報を識別するための属性
+	secretAttributes = map[string]string{"application": "pandora"}
+)
+
+// Secret Secret Serviceでやり取りされる秘密情報 (D-Busの型は(oayays))
+type Secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretServiceStore 認証情報をfreedesktop Secret Serviceに保存する
+// セッションは平文("plain")で開くため、秘密情報はローカルのD-Bus上では暗号化されずにやり取りされる
+type SecretServiceStore struct {
+	conn *dbus.Conn
+}
+
+// secretServiceAvailable connで接続しているバス上でSecret Serviceが動いているかどうか
+func secretServiceAvailable(conn *dbus.Conn) bool {
+	var ok bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, secretServiceName).Store(&ok)
+	return err == nil && ok
+}
+
+// NewSecretServiceStore connで接続しているバス上のSecret Serviceを用いるSecretServiceStoreを返す
+func NewSecretServiceStore(conn *dbus.Conn) *SecretServiceStore {
+	return &SecretServiceStore{conn: conn}
+}
+
+// Load 保存されている認証情報を読み出す
+func (s *SecretServiceStore) Load() (*Credential, error) {
+	item, err := s.find()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.openSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.closeSession(session)
+
+	var secret Secret
+	if err := s.conn.Object(secretServiceName, item).Call(itemInterface+".GetSecret", 0, session).Store(&secret); err != nil {
+		return nil, err
+	}
+
+	return decodeCredential(secret.Value)
+}
+
+// Save 認証情報をデフォルトのコレクションに保存する
+func (s *SecretServiceStore) Save(cred *Credential) error {
+	data, err := encodeCredential(cred)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer s.closeSession(session)
+
+	properties := map[string]dbus.Variant{
+		itemLabel:      dbus.MakeVariant("PandorA account (" + cred.ECSID + ")"),
+		itemAttributes: dbus.MakeVariant(secretAttributes),
+	}
+	secret := Secret{Session: session, Parameters: []byte{}, Value: data, ContentType: "application/json"}
+
+	var item, prompt dbus.ObjectPath
+	err = s.conn.Object(secretServiceName, defaultCollection).
+		Call(collectionInterface+".CreateItem", 0, properties, secret, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	if prompt != noPrompt {
+		return ErrLocked
+	}
+
+	return nil
+}
+
+// Delete 保存されている認証情報を削除する
+func (s *SecretServiceStore) Delete() error {
+	item, err := s.find()
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var prompt dbus.ObjectPath
+	if err := s.conn.Object(secretServiceName, item).Call(itemInterface+".Delete", 0).Store(&prompt); err != nil {
+		return err
+	}
+	if prompt != noPrompt {
+		return ErrLocked
+	}
+
+	return nil
+}
+
+// find PandorAの認証情報を表すアイテムを探す ロックされている場合は解除を試みる
+func (s *SecretServiceStore) find() (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.service().Call(serviceInterface+".SearchItems", 0, secretAttributes).Store(&unlocked, &locked)
+	if err != nil {
+		return "", err
+	}
+
+	if len(unlocked) > 0 {
+		return unlocked[0], nil
+	}
+	if len(locked) == 0 {
+		return "", ErrNotFound
+	}
+
+	var prompt dbus.ObjectPath
+	if err := s.service().Call(serviceInterface+".Unlock", 0, locked[:1]).Store(&unlocked, &prompt); err != nil {
+		return "", err
+	}
+	if len(unlocked) == 0 || prompt != noPrompt {
+		return "", ErrLocked
+	}
+
+	return unlocked[0], nil
+}
+
+func (s *SecretServiceStore) openSession() (dbus.ObjectPath, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := s.service().Call(serviceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+
+	return session, err
+}
+
+func (s *SecretServiceStore) closeSession(session dbus.ObjectPath) {
+	s.conn.Object(secretServiceName, session).Call(sessionInterface+".Close", 0)
+}
+
+func (s *SecretServiceStore) service() dbus.BusObject {
+	return s.conn.Object(secretServiceName, secretServicePath)
+}
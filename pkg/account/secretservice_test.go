@@ -0,0 +1,212 @@
+package account_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"pandora/pkg/account"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startBus テスト用のD-Busデーモンを起動してアドレスを返す dbus-daemonがない場合はテストをスキップする
+func startBus(t *testing.T) (address string, stop func()) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "pandora-dbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--session", "--nofork", "--print-address=1", "--address=unix:dir="+tmp)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skip("cannot start dbus-daemon:", err)
+	}
+
+	address, err = bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+
+	return strings.TrimSpace(address), func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(tmp)
+	}
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Auth(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Hello(); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// mockSecretService Secret Serviceの最小限の実装
+type mockSecretService struct {
+	conn  *dbus.Conn
+	mu    sync.Mutex
+	items map[dbus.ObjectPath]*mockItem
+	next  int
+}
+
+type mockItem struct {
+	service    *mockSecretService
+	path       dbus.ObjectPath
+	attributes map[string]string
+	secret     account.Secret
+}
+
+func (m *mockSecretService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", nil)
+	}
+
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (m *mockSecretService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unlocked := make([]dbus.ObjectPath, 0)
+	for path, item := range m.items {
+		matched := true
+		for k, v := range attributes {
+			if item.attributes[k] != v {
+				matched = false
+			}
+		}
+		if matched {
+			unlocked = append(unlocked, path)
+		}
+	}
+
+	return unlocked, []dbus.ObjectPath{}, nil
+}
+
+func (m *mockSecretService) CreateItem(properties map[string]dbus.Variant, secret account.Secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attributes, ok := properties["org.freedesktop.Secret.Item.Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", nil)
+	}
+
+	if replace {
+		found, _, _ := m.SearchItems(attributes)
+		for _, path := range found {
+			m.items[path].Delete()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next++
+	item := &mockItem{
+		service:    m,
+		path:       dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", m.next)),
+		attributes: attributes,
+		secret:     secret,
+	}
+	m.items[item.path] = item
+	m.conn.Export(item, item.path, "org.freedesktop.Secret.Item")
+
+	return item.path, "/", nil
+}
+
+func (i *mockItem) GetSecret(session dbus.ObjectPath) (account.Secret, *dbus.Error) {
+	secret := i.secret
+	secret.Session = session
+	return secret, nil
+}
+
+func (i *mockItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.service.mu.Lock()
+	defer i.service.mu.Unlock()
+
+	delete(i.service.items, i.path)
+	i.service.conn.Export(nil, i.path, "org.freedesktop.Secret.Item")
+
+	return "/", nil
+}
+
+type mockSession struct{}
+
+func (mockSession) Close() *dbus.Error {
+	return nil
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	address, stop := startBus(t)
+	defer stop()
+
+	// Secret Serviceのモックをバスに登録する
+	serviceConn := connect(t, address)
+	defer serviceConn.Close()
+
+	mock := &mockSecretService{conn: serviceConn, items: make(map[dbus.ObjectPath]*mockItem)}
+	serviceConn.Export(mock, "/org/freedesktop/secrets", "org.freedesktop.Secret.Service")
+	serviceConn.Export(mock, "/org/freedesktop/secrets/aliases/default", "org.freedesktop.Secret.Collection")
+	serviceConn.Export(mockSession{}, "/org/freedesktop/secrets/session/1", "org.freedesktop.Secret.Session")
+	if reply, err := serviceConn.RequestName("org.freedesktop.secrets", dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatal("cannot own org.freedesktop.secrets:", err)
+	}
+
+	clientConn := connect(t, address)
+	defer clientConn.Close()
+	store := account.NewSecretServiceStore(clientConn)
+
+	if _, err := store.Load(); err != account.ErrNotFound {
+		t.Fatalf("empty store: got %v", err)
+	}
+
+	first := account.Credential{ECSID: "a0123456", Password: "first"}
+	second := account.Credential{ECSID: "a0123456", Password: "second"}
+	for _, cred := range []account.Credential{first, second} {
+		cred := cred
+		if err := store.Save(&cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(mock.items) != 1 {
+		t.Errorf("saved item is not replaced: %d items", len(mock.items))
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != second {
+		t.Errorf("got %+v, want %+v", *got, second)
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err != account.ErrNotFound {
+		t.Errorf("deleted store: got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"pandora/pkg/crypt"
+	"pandora/pkg/dir"
+	"pandora/pkg/secret"
+	"path/filepath"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// 暗号化した認証情報を記録するファイルの名前
+	credentialFile = "credentials.dat"
+
+	// 認証情報の保存先を指定する環境変数
+	storeEnv = "PANDORA_CREDENTIAL_STORE"
+	// PassphraseEnv 認証情報の暗号化に用いるパスフレーズを指定する環境変数
+	PassphraseEnv = "PANDORA_PASSPHRASE"
+
+	// StoreFile 暗号化したファイルに保存する
+	StoreFile = "file"
+	// StoreSecretService freedesktop Secret Service (GNOME Keyring, KWalletなど)に保存する
+	StoreSecretService = "secret-service"
+)
+
+var (
+	// ErrNotFound 認証情報が保存されていない場合のエラー
+	ErrNotFound = errors.New("account information is not found")
+	// ErrPassphraseRequired 暗号化したファイルを用いるのにパスフレーズが与えられていない場合のエラー
+	ErrPassphraseRequired = errors.New("a passphrase is required to encrypt the account information; enter one or set " + PassphraseEnv)
+)
+
+var (
+	passMu sync.Mutex
+	// 利用者が入力したパスフレーズ
+	entered secret.String
+	// パスフレーズが必要になった際に利用者に尋ねる関数
+	prompt func() (secret.String, error)
+)
+
+// Credential PandAへのログインに用いる認証情報
+type Credential struct {
+	ECSID    string
+	Password secret.String
+	// ワンタイムパスワードの秘密鍵(Base32) 二段階認証を用いない場合は空
+	TOTPSecret secret.String
+}
+
+// storedCredential 保存する際の認証情報の形式
+// secret.StringはJSONに変換すると伏せ字になるため、パスワードを平文の文字列として持つ
+type storedCredential struct {
+	ECSID      string `json:"ecsID"`
+	Password   string `json:"password"`
+	TOTPSecret string `json:"totpSecret,omitempty"`
+}
+
+// encodeCredential 認証情報を保存する形式に変換する
+func encodeCredential(cred *Credential) ([]byte, error) {
+	return json.Marshal(storedCredential{ECSID: cred.ECSID, Password: cred.Password.Reveal(), TOTPSecret: cred.TOTPSecret.Reveal()})
+}
+
+// decodeCredential 保存された認証情報を読み出す 読み出したパスワードは伏せ字の対象として登録する
+func decodeCredential(data []byte) (*Credential, error) {
+	var stored storedCredential
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	secret.Register(stored.Password)
+	secret.Register(stored.TOTPSecret)
+
+	return &Credential{ECSID: stored.ECSID, Password: secret.String(stored.Password), TOTPSecret: secret.String(stored.TOTPSecret)}, nil
+}
+
+// Store 認証情報の保存先
+type Store interface {
+	// Load 保存されている認証情報を読み出す 保存されていない場合はErrNotFoundを返す
+	Load() (*Credential, error)
+	// Save 認証情報を保存する 既に保存されている場合は置き換える
+	Save(cred *Credential) error
+	// Delete 保存されている認証情報を削除する
+	Delete() error
+}
+
+// DefaultStore 環境変数PANDORA_CREDENTIAL_STOREで指定された保存先を返す
+// 指定がなければ、パスフレーズが与えられているか既に暗号化したファイルがある場合はファイルを、
+// そうでなければSecret Serviceを用いる 鍵を暗号文と同じ場所に保存することはしない
+func DefaultStore() (Store, error) {
+	path := dir.ConfigPath(credentialFile)
+
+	switch kind := os.Getenv(storeEnv); kind {
+	case StoreFile:
+		return fileStore(path)
+
+	case StoreSecretService:
+		conn, err := dbus.SessionBus()
+		if err != nil {
+			return nil, err
+		}
+		return NewSecretServiceStore(conn), nil
+
+	case "":
+		if !Passphrase().IsEmpty() || exists(path) {
+			return fileStore(path)
+		}
+		if conn, err := dbus.SessionBus(); err == nil && secretServiceAvailable(conn) {
+			return NewSecretServiceStore(conn), nil
+		}
+		return fileStore(path)
+
+	default:
+		return nil, fmt.Errorf("unknown credential store: %s", kind)
+	}
+}
+
+// fileStore pathに保存するFileStoreを返す パスフレーズが与えられていなければ利用者に尋ねる
+func fileStore(path string) (Store, error) {
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFileStore(path, pass), nil
+}
+
+// SetPassphrase 認証情報の暗号化に用いるパスフレーズを設定する フォームやコマンドラインで入力されたものを渡す
+func SetPassphrase(pass secret.String) {
+	passMu.Lock()
+	defer passMu.Unlock()
+
+	secret.Register(pass.Reveal())
+	entered = pass
+}
+
+// SetPrompt パスフレーズが必要になった際に利用者に尋ねる関数を設定する
+// 尋ねるのは一度だけで、入力されたパスフレーズはプロセスが終了するまで用いる
+func SetPrompt(f func() (secret.String, error)) {
+	passMu.Lock()
+	defer passMu.Unlock()
+
+	prompt = f
+}
+
+// Passphrase 環境変数PANDORA_PASSPHRASEもしくはSetPassphraseで設定されたパスフレーズを返す 利用者には尋ねない
+func Passphrase() secret.String {
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		return secret.String(pass)
+	}
+
+	passMu.Lock()
+	defer passMu.Unlock()
+
+	return entered
+}
+
+// passphrase 認証情報の暗号化に用いるパスフレーズを返す
+// 環境変数PANDORA_PASSPHRASE、SetPassphraseで設定されたもの、SetPromptの関数で尋ねたものの順に用いる
+func passphrase() ([]byte, error) {
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+
+	passMu.Lock()
+	defer passMu.Unlock()
+
+	if entered.IsEmpty() && prompt != nil {
+		pass, err := prompt()
+		if err != nil {
+			return nil, err
+		}
+		secret.Register(pass.Reveal())
+		entered = pass
+	}
+	if entered.IsEmpty() {
+		return nil, ErrPassphraseRequired
+	}
+
+	return []byte(entered.Reveal()), nil
+}
+
+// forgetPassphrase 入力されたパスフレーズで復号できなかった場合に、次に必要になった際に尋ね直すよう破棄する
+func forgetPassphrase() {
+	passMu.Lock()
+	defer passMu.Unlock()
+
+	entered = ""
+}
+
+// NeedsPassphrase パスフレーズが与えられていないか誤っているため、認証情報を読み書きできなかったかどうか
+func NeedsPassphrase(err error) bool {
+	return errors.Is(err, ErrPassphraseRequired) || errors.Is(err, crypt.ErrDecrypt)
+}
+
+// exists pathにファイルがあるかどうか
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// FileStore 認証情報をパスフレーズから導出した鍵で暗号化してファイルに保存する
+type FileStore struct {
+	path       string
+	passphrase []byte
+}
+
+// NewFileStore pathに認証情報を保存するFileStoreを返す
+func NewFileStore(path string, passphrase []byte) *FileStore {
+	return &FileStore{path: path, passphrase: passphrase}
+}
+
+// Load 保存されている認証情報を読み出す
+func (f *FileStore) Load() (*Credential, error) {
+	sealed, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := crypt.Open(f.passphrase, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCredential(data)
+}
+
+// Save 認証情報を暗号化して保存する
+func (f *FileStore) Save(cred *Credential) error {
+	data, err := encodeCredential(cred)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := crypt.Seal(f.passphrase, data)
+	if err != nil {
+		return err
+	}
+
+	return writePrivateFile(f.path, sealed)
+}
+
+// Delete 認証情報のファイルを削除する
+func (f *FileStore) Delete() error {
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// writePrivateFile 所有者のみが読み書きできるファイルにdataを書き込む
+// 書き込み途中の状態が残らないよう、一時ファイルに書き込んでから置き換える
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
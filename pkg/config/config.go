@@ -0,0 +1,472 @@
+// Package config PandorAの設定ファイル(YAML形式)の読み書きを行う
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pandora/pkg/dir"
+	"pandora/pkg/layout"
+	"pandora/pkg/schedule"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// CurrentVersion 設定ファイルの形式のバージョン
+	CurrentVersion = 1
+
+	// 設定ファイルの名前
+	configFile = "config.yaml"
+	// 設定ファイルのパスを指定する環境変数
+	pathEnv = "PANDORA_CONFIG"
+	// 設定値を上書きする環境変数の接頭辞
+	envPrefix = "PANDORA_"
+
+	// 授業サイトの対象とする学期
+	TermsCurrent = "current"
+	TermsAll     = "all"
+
+	// 保存先に既にファイルがある場合の対応
+	// PandorAが保存し、その後変更されていないファイルのみ上書きする それ以外は両方残す
+	ConflictOverwrite = "overwrite"
+	// 既存のファイルを残し、新しいファイルの名前に日時をつける
+	ConflictKeepBoth = "keep-both"
+	// ダウンロードしない
+	ConflictSkip = "skip"
+	// その都度確認する 確認できない場合は両方残す
+	ConflictAsk = "ask"
+
+	// ログイン方法
+	// ECS-IDとパスワードでCASにログインする
+	AuthCAS = "cas"
+	// CASのログインに加えてワンタイムパスワードを送信する 秘密鍵は認証情報と共に保存する
+	AuthCASTOTP = "cas-totp"
+	// SAML(Shibboleth)のIdPにログインする
+	AuthSAML = "saml"
+	// ブラウザから書き出したCookieを読み込む
+	AuthCookies = "cookies"
+
+	// 通知のメッセージの言語
+	LanguageJapanese = "ja"
+	LanguageEnglish  = "en"
+
+	// 同時にダウンロードするファイル数の上限
+	maxConcurrency = 16
+	// 自動実行の間隔の下限
+	minInterval = 10 * time.Minute
+)
+
+// 設定ファイルの先頭に書き込むコメント
+const header = `# PandorA configuration
+# 各項目は環境変数 PANDORA_<KEY> (例: PANDORA_DOWNLOAD_ROOT) で上書きできます
+`
+
+// Config PandorAの設定
+type Config struct {
+	Version       int           `yaml:"version"`
+	Download      Download      `yaml:"download"`
+	Schedule      Schedule      `yaml:"schedule"`
+	Filters       Filters       `yaml:"filters"`
+	Notifications Notifications `yaml:"notifications"`
+	Sites         Sites         `yaml:"sites"`
+	Auth          Auth          `yaml:"auth"`
+	Dashboard     Dashboard     `yaml:"dashboard"`
+}
+
+// Download ダウンロードに関する設定
+type Download struct {
+	// 資料を保存するフォルダ 空の場合はデスクトップのPandorA Box
+	Root string `yaml:"root"`
+	// 資料の保存先のパスのテンプレート (例: {year}/{term}/{course_title}/{folder}/{filename})
+	Template string `yaml:"template"`
+	// 同時にダウンロードするファイル数
+	Concurrency int `yaml:"concurrency"`
+	// 保存先に既にファイルがある場合の対応 Conflict から始まる定数のいずれか
+	OnConflict string `yaml:"on_conflict"`
+}
+
+// Schedule 自動実行に関する設定
+type Schedule struct {
+	// 自動でダウンロードを行う間隔 0の場合は自動で実行しない
+	Interval Duration `yaml:"interval"`
+	// 自動でダウンロードを行う時刻をcron形式(分 時 日 月 曜日)で指定する 指定した場合はIntervalより優先する
+	Cron string `yaml:"cron"`
+	// 起動時にダウンロードを行う
+	OnStartup bool `yaml:"on_startup"`
+	// 自動実行の時刻をランダムに遅らせる最大の時間
+	Jitter Duration `yaml:"jitter"`
+	// 自動実行の際に通知を行わない時間帯 (例: "23:00-07:00") 空の場合は常に通知する
+	QuietHours string `yaml:"quiet_hours"`
+	// 前回のダウンロードを開始してから手動で実行できるまでの時間 0の場合は制限しない
+	Cooldown Duration `yaml:"cooldown"`
+}
+
+// Filters ダウンロードしない資料の設定
+type Filters struct {
+	Reject Reject `yaml:"reject"`
+}
+
+// Reject ダウンロードしないファイル形式 resource.RejectableTypeと同じフィールドを持つ
+type Reject struct {
+	Video      bool `yaml:"video"`
+	Audio      bool `yaml:"audio"`
+	Excel      bool `yaml:"excel"`
+	PowerPoint bool `yaml:"powerpoint"`
+	Word       bool `yaml:"word"`
+}
+
+// Notifications 通知に関する設定
+type Notifications struct {
+	// ダウンロードが成功した場合に通知する
+	OnSuccess bool `yaml:"on_success"`
+	// エラーが起きた場合に通知する
+	OnError bool `yaml:"on_error"`
+	// エラーを知らせるメッセージの言語 "ja"もしくは"en"
+	Language string `yaml:"language"`
+}
+
+// Sites ダウンロードの対象とする授業サイトの設定
+type Sites struct {
+	// 対象とする学期 "current"(現在の学期のみ)もしくは"all"
+	Terms string `yaml:"terms"`
+	// 学期に関わらず対象とする授業サイト(IDもしくはタイトル)
+	Include []string `yaml:"include"`
+	// 対象としない授業サイト(IDもしくはタイトル)
+	Exclude []string `yaml:"exclude"`
+}
+
+// Auth ログイン方法の設定
+type Auth struct {
+	// ログイン方法 Auth から始まる定数のいずれか
+	Method string `yaml:"method"`
+	// SAMLでログインを開始するURL 空の場合はPandAのログインページ
+	SAMLLoginURL string `yaml:"saml_login_url"`
+	// cookiesで読み込むNetscape形式(cookies.txt)のファイル
+	CookieFile string `yaml:"cookie_file"`
+}
+
+// Dashboard ブラウザやスクリプトから状態を確認するHTTPサーバーの設定
+type Dashboard struct {
+	// 127.0.0.1でHTTPサーバーを起動する
+	Enabled bool `yaml:"enabled"`
+	// 待ち受けるポート番号
+	Port int `yaml:"port"`
+}
+
+// Duration "4h"や"10m"のように表記する時間
+type Duration time.Duration
+
+// UnmarshalYAML time.ParseDurationの形式で読み込む
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalYAML time.Durationの表記で書き出す
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// ValidationError 設定値が不正な場合のエラー
+type ValidationError struct {
+	// 不正な設定項目 (例: schedule.interval)
+	Key     string
+	Message string
+}
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("config: %s: %s", v.Key, v.Message)
+}
+
+// Default 既定の設定を返す
+func Default() *Config {
+	return &Config{
+		Version: CurrentVersion,
+		Download: Download{
+			Template:    layout.Default,
+			Concurrency: 4,
+			OnConflict:  ConflictOverwrite,
+		},
+		Schedule: Schedule{
+			Interval: Duration(4 * time.Hour),
+			Jitter:   Duration(10 * time.Minute),
+			Cooldown: Duration(10 * time.Minute),
+		},
+		Filters: Filters{
+			// 設定フォームの初期値に合わせて全て除外する
+			Reject: Reject{Video: true, Audio: true, Excel: true, PowerPoint: true, Word: true},
+		},
+		Notifications: Notifications{
+			OnSuccess: true,
+			OnError:   true,
+			Language:  LanguageEnglish,
+		},
+		Sites: Sites{
+			Terms:   TermsCurrent,
+			Include: make([]string, 0),
+			Exclude: make([]string, 0),
+		},
+		Auth: Auth{
+			Method: AuthCAS,
+		},
+		Dashboard: Dashboard{
+			Enabled: true,
+			Port:    47810,
+		},
+	}
+}
+
+var (
+	// SetPathで指定された設定ファイルのパス
+	path string
+	// SetOverridesで指定された上書きする設定値
+	overrides []string
+)
+
+// SetPath 設定ファイルのパスを指定する コマンドラインのフラグから指定する場合に用いる
+func SetPath(p string) {
+	path = p
+}
+
+// SetOverrides "key=value"の形式で上書きする設定値を指定する 環境変数よりも優先される
+func SetOverrides(kv []string) {
+	overrides = kv
+}
+
+// Path 設定ファイルのパスを返す
+func Path() string {
+	if path != "" {
+		return path
+	}
+	if p := os.Getenv(pathEnv); p != "" {
+		return p
+	}
+
+	return dir.ConfigPath(configFile)
+}
+
+// Load 設定ファイルを読み込み、環境変数とSetOverridesによる上書きを適用した設定を返す
+// 設定ファイルが存在しない場合は旧形式の設定を移行して作成する
+func Load() (*Config, error) {
+	c, err := LoadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+
+	for _, kv := range overrides {
+		s := strings.SplitN(kv, "=", 2)
+		if len(s) != 2 {
+			return nil, &ValidationError{Key: kv, Message: "override must be in the form key=value"}
+		}
+		if err := c.Set(s[0], s[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, c.Validate()
+}
+
+// LoadFile 上書きを適用せずに設定ファイルを読み込む 設定を変更して保存する場合に用いる
+func LoadFile() (*Config, error) {
+	p := Path()
+
+	c, err := Read(p)
+	if os.IsNotExist(err) {
+		return migrate(filepath.Dir(p))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Read pathの設定ファイルを読み込む 書かれていない項目は既定値になる
+func Read(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse YAML形式の設定を読み込んで検証する
+func Parse(data []byte) (*Config, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config: %s", err)
+	}
+
+	c := Default()
+	if raw != nil {
+		if err := decode(raw, c, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Save 設定ファイルに書き込む
+func (c *Config) Save() error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.Write(data)
+
+	p := Path()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(p, b.Bytes(), 0644)
+}
+
+// Validate 設定値を検証し、不正な項目があればValidationErrorを返す
+func (c *Config) Validate() error {
+	if c.Version < 1 || c.Version > CurrentVersion {
+		return &ValidationError{Key: "version", Message: fmt.Sprintf("unsupported version %d (this PandorA supports up to %d)", c.Version, CurrentVersion)}
+	}
+
+	if root := c.Download.Root; root != "" && !filepath.IsAbs(expandHome(root)) {
+		return &ValidationError{Key: "download.root", Message: fmt.Sprintf("must be an absolute path: %q", root)}
+	}
+
+	if _, err := layout.Parse(c.Download.Template); err != nil {
+		return &ValidationError{Key: "download.template", Message: err.(*layout.Error).Message}
+	}
+
+	if n := c.Download.Concurrency; n < 1 || n > maxConcurrency {
+		return &ValidationError{Key: "download.concurrency", Message: fmt.Sprintf("must be between 1 and %d: %d", maxConcurrency, n)}
+	}
+
+	switch c.Download.OnConflict {
+	case ConflictOverwrite, ConflictKeepBoth, ConflictSkip, ConflictAsk:
+	default:
+		return &ValidationError{Key: "download.on_conflict", Message: fmt.Sprintf("must be %q, %q, %q or %q: %q",
+			ConflictOverwrite, ConflictKeepBoth, ConflictSkip, ConflictAsk, c.Download.OnConflict)}
+	}
+
+	if d := time.Duration(c.Schedule.Interval); d != 0 && d < minInterval {
+		return &ValidationError{Key: "schedule.interval", Message: fmt.Sprintf("must be 0 (disabled) or at least %s: %s", minInterval, d)}
+	}
+
+	if c.Schedule.Cron != "" {
+		if _, err := schedule.ParseCron(c.Schedule.Cron); err != nil {
+			return &ValidationError{Key: "schedule.cron", Message: err.(*schedule.Error).Message}
+		}
+	}
+
+	if c.Schedule.Jitter < 0 {
+		return &ValidationError{Key: "schedule.jitter", Message: "must not be negative"}
+	}
+
+	if _, err := schedule.ParseQuietHours(c.Schedule.QuietHours); err != nil {
+		return &ValidationError{Key: "schedule.quiet_hours", Message: err.(*schedule.Error).Message}
+	}
+
+	if c.Schedule.Cooldown < 0 {
+		return &ValidationError{Key: "schedule.cooldown", Message: "must not be negative"}
+	}
+
+	if l := c.Notifications.Language; l != LanguageJapanese && l != LanguageEnglish {
+		return &ValidationError{Key: "notifications.language", Message: fmt.Sprintf("must be %q or %q: %q", LanguageJapanese, LanguageEnglish, l)}
+	}
+
+	if t := c.Sites.Terms; t != TermsCurrent && t != TermsAll {
+		return &ValidationError{Key: "sites.terms", Message: fmt.Sprintf("must be %q or %q: %q", TermsCurrent, TermsAll, t)}
+	}
+
+	switch c.Auth.Method {
+	case AuthCAS, AuthCASTOTP:
+	case AuthSAML:
+		if u := c.Auth.SAMLLoginURL; u != "" && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+			return &ValidationError{Key: "auth.saml_login_url", Message: fmt.Sprintf("must be an http(s) URL: %q", u)}
+		}
+	case AuthCookies:
+		if c.Auth.CookieFile == "" {
+			return &ValidationError{Key: "auth.cookie_file", Message: "must be set when auth.method is \"cookies\""}
+		}
+	default:
+		return &ValidationError{Key: "auth.method", Message: fmt.Sprintf("must be %q, %q, %q or %q: %q",
+			AuthCAS, AuthCASTOTP, AuthSAML, AuthCookies, c.Auth.Method)}
+	}
+
+	if p := c.Dashboard.Port; p < 1 || p > 65535 {
+		return &ValidationError{Key: "dashboard.port", Message: fmt.Sprintf("must be between 1 and 65535: %d", p)}
+	}
+
+	return nil
+}
+
+// ScheduleSpec 自動実行の設定を返す 設定は検証済みであるものとする
+func (c *Config) ScheduleSpec() schedule.Spec {
+	spec := schedule.Spec{
+		Interval:  time.Duration(c.Schedule.Interval),
+		OnStartup: c.Schedule.OnStartup,
+		Jitter:    time.Duration(c.Schedule.Jitter),
+	}
+	if c.Schedule.Cron != "" {
+		spec.Cron, _ = schedule.ParseCron(c.Schedule.Cron)
+	}
+	spec.Quiet, _ = schedule.ParseQuietHours(c.Schedule.QuietHours)
+
+	return spec
+}
+
+// CookieFile Cookieを読み込むファイルのパスを返す ~はホームディレクトリに展開する
+func (c *Config) CookieFile() string {
+	return expandHome(c.Auth.CookieFile)
+}
+
+// DownloadRoot 資料を保存するフォルダのパスを返す ~はホームディレクトリに展開する
+func (c *Config) DownloadRoot() string {
+	return expandHome(c.Download.Root)
+}
+
+// expandHome 先頭の~をホームディレクトリに展開する
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+
+	return filepath.Join(home, p[1:])
+}
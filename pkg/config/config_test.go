@@ -0,0 +1,210 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pandora/pkg/config"
+)
+
+func TestParse(t *testing.T) {
+	c, err := config.Parse([]byte(`
+version: 1
+download:
+  root: /tmp/pandora
+  concurrency: 2
+schedule:
+  interval: 2h
+filters:
+  reject:
+    video: false
+sites:
+  terms: all
+  exclude: [2020前期線形代数]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Download.Root != "/tmp/pandora" || c.Download.Concurrency != 2 {
+		t.Errorf("download: %+v", c.Download)
+	}
+	if time.Duration(c.Schedule.Interval) != 2*time.Hour {
+		t.Errorf("interval: %s", c.Schedule.Interval)
+	}
+	// 書かれていない項目は既定値になる
+	if time.Duration(c.Schedule.Cooldown) != 10*time.Minute {
+		t.Errorf("cooldown: %s", c.Schedule.Cooldown)
+	}
+	if c.Filters.Reject.Video || !c.Filters.Reject.Audio {
+		t.Errorf("reject: %+v", c.Filters.Reject)
+	}
+	if c.Sites.Terms != config.TermsAll || len(c.Sites.Exclude) != 1 {
+		t.Errorf("sites: %+v", c.Sites)
+	}
+}
+
+// 不正な設定は該当する項目の名前を示すエラーになる
+func TestParseErrorKey(t *testing.T) {
+	tests := []struct {
+		yaml string
+		key  string
+	}{
+		{"download:\n  rooot: /tmp\n", "download.rooot"},
+		{"download:\n  concurrency: many\n", "download.concurrency"},
+		{"download:\n  concurrency: 100\n", "download.concurrency"},
+		{"download:\n  root: relative/path\n", "download.root"},
+		{"schedule:\n  interval: 1m\n", "schedule.interval"},
+		{"schedule:\n  cooldown: soon\n", "schedule.cooldown"},
+		{"filters:\n  reject: true\n", "filters.reject"},
+		{"sites:\n  terms: previous\n", "sites.terms"},
+		{"version: 99\n", "version"},
+		{"auth:\n  method: password\n", "auth.method"},
+		{"notifications:\n  language: fr\n", "notifications.language"},
+		{"schedule:\n  cron: every day\n", "schedule.cron"},
+		{"schedule:\n  quiet_hours: night\n", "schedule.quiet_hours"},
+		{"dashboard:\n  port: 70000\n", "dashboard.port"},
+		{"auth:\n  method: cookies\n", "auth.cookie_file"},
+	}
+
+	for _, tt := range tests {
+		_, err := config.Parse([]byte(tt.yaml))
+		ve, ok := err.(*config.ValidationError)
+		if !ok {
+			t.Errorf("%q: got %v, want ValidationError", tt.yaml, err)
+			continue
+		}
+		if ve.Key != tt.key {
+			t.Errorf("%q: got key %q, want %q", tt.yaml, ve.Key, tt.key)
+		}
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	c := config.Default()
+
+	sets := map[string]string{
+		"download.concurrency":   "8",
+		"schedule.interval":      "1h30m",
+		"filters.reject.word":    "false",
+		"sites.include":          "abc, def",
+		"notifications.on_error": "false",
+		"notifications.language": "ja",
+	}
+	for k, v := range sets {
+		if err := c.Set(k, v); err != nil {
+			t.Fatalf("Set(%s): %v", k, err)
+		}
+	}
+
+	want := map[string]string{
+		"download.concurrency":   "8",
+		"schedule.interval":      "1h30m0s",
+		"filters.reject.word":    "false",
+		"sites.include":          "abc,def",
+		"notifications.on_error": "false",
+		"notifications.language": "ja",
+	}
+	for k, v := range want {
+		if got, err := c.Get(k); err != nil || got != v {
+			t.Errorf("Get(%s) = %q, %v; want %q", k, got, err, v)
+		}
+	}
+
+	if err := c.Set("download", "x"); err == nil {
+		t.Error("setting a section should fail")
+	}
+	if err := c.Set("download.speed", "1"); err == nil {
+		t.Error("setting an unknown key should fail")
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "config.yaml")
+	config.SetPath(path)
+	defer config.SetPath("")
+
+	if err := ioutil.WriteFile(path, []byte("download:\n  concurrency: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("PANDORA_DOWNLOAD_CONCURRENCY", "3")
+	os.Setenv("PANDORA_SITES_TERMS", "all")
+	defer os.Unsetenv("PANDORA_DOWNLOAD_CONCURRENCY")
+	defer os.Unsetenv("PANDORA_SITES_TERMS")
+
+	// フラグによる上書きは環境変数よりも優先される
+	config.SetOverrides([]string{"download.concurrency=5"})
+	defer config.SetOverrides(nil)
+
+	c, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Download.Concurrency != 5 || c.Sites.Terms != config.TermsAll {
+		t.Errorf("overrides are not applied: %+v %+v", c.Download, c.Sites)
+	}
+
+	// 上書きされた値は設定ファイルの内容には含まれない
+	file, err := config.LoadFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Download.Concurrency != 2 || file.Sites.Terms != config.TermsCurrent {
+		t.Errorf("file is affected by overrides: %+v %+v", file.Download, file.Sites)
+	}
+
+	os.Setenv("PANDORA_SITES_TERMS", "sometimes")
+	_, err = config.Load()
+	if ve, ok := err.(*config.ValidationError); !ok || ve.Key != "sites.terms" {
+		t.Errorf("invalid env value: got %v", err)
+	}
+}
+
+func TestMigrateLegacyReject(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	config.SetPath(filepath.Join(tmp, "config.yaml"))
+	defer config.SetPath("")
+
+	// Video, Excel のみ除外する設定
+	legacy := filepath.Join(tmp, "reject.dat")
+	if err := ioutil.WriteFile(legacy, []byte("20"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := config.LoadFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := config.Reject{Video: true, Excel: true}
+	if c.Filters.Reject != want {
+		t.Errorf("got %+v, want %+v", c.Filters.Reject, want)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("legacy file is not removed")
+	}
+
+	// 作成された設定ファイルから読み込み直しても同じ設定になる
+	saved, err := config.Read(filepath.Join(tmp, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Filters.Reject != want {
+		t.Errorf("saved %+v, want %+v", saved.Filters.Reject, want)
+	}
+}
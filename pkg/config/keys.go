@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 設定項目は"download.root"のようにYAMLのキーを.で繋いだ名前で表す
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// isLeaf 値を直接読み書きする項目かどうかを判定する
+func isLeaf(t reflect.Type) bool {
+	return t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// yamlName 構造体のフィールドのYAMLでのキーを返す
+func yamlName(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("yaml"), ",")[0]
+}
+
+// decode YAMLを読み込んだ値rawをvに書き込む 未知のキーや型の誤りは該当する項目を示すエラーにする
+func decode(raw interface{}, v interface{}, prefix string) error {
+	return decodeValue(raw, reflect.ValueOf(v).Elem(), prefix)
+}
+
+func decodeValue(raw interface{}, v reflect.Value, key string) error {
+	if isLeaf(v.Type()) {
+		// 値を一度YAMLに戻してフィールドの型で読み込み直す
+		data, err := yaml.Marshal(raw)
+		if err != nil {
+			return &ValidationError{Key: key, Message: err.Error()}
+		}
+		return decodeLeaf(data, v, key)
+	}
+
+	m, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		if key == "" {
+			return &ValidationError{Key: "(root)", Message: "must be a mapping"}
+		}
+		return &ValidationError{Key: key, Message: "must be a mapping"}
+	}
+
+	// エラーの内容が毎回同じになるようキーの順に処理する
+	names := make([]string, 0, len(m))
+	values := make(map[string]interface{}, len(m))
+	for k, val := range m {
+		name := fmt.Sprint(k)
+		names = append(names, name)
+		values[name] = val
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f, ok := field(v, name)
+		if !ok {
+			return &ValidationError{Key: join(key, name), Message: "unknown key"}
+		}
+		if err := decodeValue(values[name], f, join(key, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeLeaf YAMLで表された値dataをフィールドの型で読み込む
+func decodeLeaf(data []byte, v reflect.Value, key string) error {
+	ptr := reflect.New(v.Type())
+	if err := yaml.UnmarshalStrict(data, ptr.Interface()); err != nil {
+		return &ValidationError{Key: key, Message: fmt.Sprintf("invalid value %s for %s", strings.TrimSpace(string(data)), v.Type())}
+	}
+
+	v.Set(ptr.Elem())
+	return nil
+}
+
+// field 構造体からYAMLのキーがnameであるフィールドを探す
+func field(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// lookup keyで表される項目を返す
+func (c *Config) lookup(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(key, ".") {
+		if isLeaf(v.Type()) {
+			return reflect.Value{}, &ValidationError{Key: key, Message: "unknown key"}
+		}
+
+		f, ok := field(v, name)
+		if !ok {
+			return reflect.Value{}, &ValidationError{Key: key, Message: "unknown key"}
+		}
+		v = f
+	}
+
+	if !isLeaf(v.Type()) {
+		return reflect.Value{}, &ValidationError{Key: key, Message: "is a section, not a value"}
+	}
+
+	return v, nil
+}
+
+// Keys 全ての設定項目の名前を返す
+func Keys() []string {
+	keys := make([]string, 0)
+	collectKeys(reflect.TypeOf(Config{}), "", &keys)
+	return keys
+}
+
+func collectKeys(t reflect.Type, prefix string, keys *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := join(prefix, yamlName(f))
+		if isLeaf(f.Type) {
+			*keys = append(*keys, key)
+		} else {
+			collectKeys(f.Type, key, keys)
+		}
+	}
+}
+
+// Get 設定値を文字列で返す リストは,で区切る
+func (c *Config) Get(key string) (string, error) {
+	v, err := c.lookup(key)
+	if err != nil {
+		return "", err
+	}
+
+	if list, ok := v.Interface().([]string); ok {
+		return strings.Join(list, ","), nil
+	}
+
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// Set 文字列で与えられた設定値を書き込む リストは,で区切って指定する
+// 書き込んだ後の設定は検証しないため、必要に応じてValidateを呼び出す
+func (c *Config) Set(key, value string) error {
+	v, err := c.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(value)
+		return nil
+
+	case []string:
+		list := make([]string, 0)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+
+	return decodeLeaf([]byte(value), v, key)
+}
+
+// EnvName 設定項目を上書きする環境変数の名前を返す (例: download.root → PANDORA_DOWNLOAD_ROOT)
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// applyEnv 環境変数による上書きを適用する environはos.Environの形式
+func (c *Config) applyEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if s := strings.SplitN(kv, "=", 2); len(s) == 2 {
+			env[s[0]] = s[1]
+		}
+	}
+
+	for _, key := range Keys() {
+		value, ok := env[EnvName(key)]
+		if !ok {
+			continue
+		}
+
+		if err := c.Set(key, value); err != nil {
+			if ve, ok := err.(*ValidationError); ok {
+				ve.Message += " (from " + EnvName(key) + ")"
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 旧バージョンでダウンロードしないファイル形式を記録していたファイルの名前
+	legacyRejectFile = "reject.dat"
+)
+
+// migrate 既定の設定に旧形式のファイルの設定を反映して設定ファイルを作成し、移行した旧ファイルを削除する
+// 旧形式のaccount.datに含まれる設定はaccountパッケージが認証情報と合わせて移行する
+func migrate(settingsDir string) (*Config, error) {
+	c := Default()
+
+	legacy := filepath.Join(settingsDir, legacyRejectFile)
+	content, err := ioutil.ReadFile(legacy)
+	if os.IsNotExist(err) {
+		return c, c.Save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	num, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, &ValidationError{Key: "filters.reject", Message: "cannot migrate " + legacy + ": " + err.Error()}
+	}
+	c.Filters.Reject = DecodeReject(uint(num))
+
+	if err := c.Save(); err != nil {
+		return nil, err
+	}
+
+	return c, os.Remove(legacy)
+}
+
+// DecodeReject 旧形式の数値で表された除外設定を読み込む
+// Video * 2^4 + Audio * 2^3 + Excel * 2^2 + PowerPoint * 2^1 + Word * 2^0
+func DecodeReject(code uint) Reject {
+	return Reject{
+		Video:      code&16 != 0,
+		Audio:      code&8 != 0,
+		Excel:      code&4 != 0,
+		PowerPoint: code&2 != 0,
+		Word:       code&1 != 0,
+	}
+}
@@ -0,0 +1,116 @@
+// Package crypt パスフレーズから導出した鍵でデータを暗号化・復号する
+//
+// 鍵の導出にはArgon2id、暗号化にはAES-256-GCMを用いる。暗号文の形式は
+//
+//	"PDRA" | version(1) | salt(16) | nonce(12) | ciphertext
+//
+// となっており、バージョンごとにArgon2idのパラメータを固定している。
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// 暗号文の先頭に付けるマジックナンバー
+	magic = "PDRA"
+	// 暗号文の形式のバージョン
+	version1 = 1
+
+	saltSize = 16
+	keySize  = 32
+
+	// Argon2idのパラメータ(version1)
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+var (
+	// ErrDecrypt パスフレーズが誤っているか、暗号文が改ざんされている場合のエラー
+	ErrDecrypt = errors.New("crypt: wrong passphrase or corrupted data")
+	// ErrFormat 暗号文の形式が不正な場合のエラー
+	ErrFormat = errors.New("crypt: unknown data format")
+)
+
+// Seal passphraseから導出した鍵でplaintextを暗号化する
+func Seal(passphrase, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(magic)+1+saltSize+len(nonce))
+	header = append(header, magic...)
+	header = append(header, version1)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	// ヘッダーも認証の対象に含める
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// Open Sealで暗号化されたデータを復号する
+func Open(passphrase, sealed []byte) ([]byte, error) {
+	if !IsSealed(sealed) {
+		return nil, ErrFormat
+	}
+
+	if sealed[len(magic)] != version1 {
+		return nil, ErrFormat
+	}
+
+	salt := sealed[len(magic)+1 : len(magic)+1+saltSize]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := len(magic) + 1 + saltSize + aead.NonceSize()
+	if len(sealed) < headerSize+aead.Overhead() {
+		return nil, ErrFormat
+	}
+
+	header := sealed[:headerSize]
+	nonce := sealed[headerSize-aead.NonceSize() : headerSize]
+
+	plaintext, err := aead.Open(nil, nonce, sealed[headerSize:], header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+// IsSealed データがSealで暗号化されたものかどうかを判定する
+func IsSealed(data []byte) bool {
+	return len(data) > len(magic)+1+saltSize && bytes.HasPrefix(data, []byte(magic))
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, keySize)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
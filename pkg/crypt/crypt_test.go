@@ -0,0 +1,36 @@
+package crypt_test
+
+import (
+	"bytes"
+	"pandora/pkg/crypt"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	plaintext := []byte("a0123456:p@ssword")
+
+	sealed, err := crypt.Seal([]byte("passphrase"), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Error("plaintext is visible in the sealed data")
+	}
+
+	opened, err := crypt.Open([]byte("passphrase"), sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("got %q, want %q", opened, plaintext)
+	}
+
+	if _, err := crypt.Open([]byte("wrong"), sealed); err != crypt.ErrDecrypt {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := crypt.Open([]byte("passphrase"), sealed); err != crypt.ErrDecrypt {
+		t.Errorf("tampered data: got %v", err)
+	}
+}
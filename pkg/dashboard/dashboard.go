@@ -0,0 +1,394 @@
+// Package dashboard 常駐しているPandorAの状態をブラウザやスクリプトから確認するHTTPサーバー
+// 127.0.0.1でのみ待ち受け、/api/ 以下は状態のディレクトリに保存したトークンを知っている場合にのみ応答する
+package dashboard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pandora/pkg/dir"
+	"pandora/pkg/ipc"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+	"pandora/pkg/state"
+)
+
+const (
+	// トークンを保存するファイルの名前
+	tokenFile = "dashboard-token"
+	// 課題の締切を取得し直すまでの時間 PandAへの負荷を抑えるため一定時間は前回の結果を返す
+	deadlineTTL = 10 * time.Minute
+	// 締切を取得する際のタイムアウト
+	deadlineTimeout = time.Minute
+)
+
+// Backend ダウンロードの実行や状態の取得など、トレイのプロセスが行う処理
+type Backend interface {
+	// Status 現在の状態を返す
+	Status() ipc.Status
+	// SyncNow ダウンロードを開始する 終了を待たずに返る
+	SyncNow() error
+	// Assignments PandAにログインして課題の一覧を取得する
+	Assignments(ctx context.Context) ([]pandaapi.Assignment, error)
+	// OpenFile ファイルをOSの既定のアプリケーションで開く
+	OpenFile(path string) error
+}
+
+// Site 資料をダウンロードした授業サイト
+type Site struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// ダウンロードした資料の数
+	Files int `json:"files"`
+	// 最後に資料をダウンロードした日時
+	LastDownload time.Time `json:"lastDownload"`
+}
+
+// Deadline 締切が過ぎていない課題
+type Deadline struct {
+	SiteID    string    `json:"siteID"`
+	SiteTitle string    `json:"siteTitle"`
+	Title     string    `json:"title"`
+	Due       time.Time `json:"due"`
+	// 授業サイトをブラウザで開くURL
+	URL string `json:"url"`
+}
+
+// Server ダッシュボードとJSONのAPIを提供するHTTPサーバー
+type Server struct {
+	backend Backend
+	token   string
+	// 待ち受けているアドレス (例: 127.0.0.1:47810)
+	addr string
+	l    net.Listener
+	srv  *http.Server
+
+	// ダウンロードの記録とレポートの読み込み方 テストで差し替える
+	openStore func() (*state.Store, error)
+	reportDir string
+	now       func() time.Time
+
+	mu sync.Mutex
+	// 前回取得した課題の締切と取得した日時
+	deadlines []Deadline
+	fetchedAt time.Time
+}
+
+// New backendを用いて応答するServerを返す tokenを知っているクライアントにのみAPIを提供する
+func New(backend Backend, token string) *Server {
+	return &Server{
+		backend:   backend,
+		token:     token,
+		openStore: state.Default,
+		reportDir: dir.StateDir(),
+		now:       time.Now,
+	}
+}
+
+// Token 状態のディレクトリに保存されたトークンを返す なければ作成して保存する
+func Token() (string, error) {
+	return loadToken(dir.StatePath(tokenFile))
+}
+
+func loadToken(path string) (string, error) {
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	// 他のユーザーが読めないようにする
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Start 127.0.0.1のportで待ち受けを始める
+func (s *Server) Start(port int) error {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+
+	s.l = l
+	s.addr = l.Addr().String()
+	s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go s.srv.Serve(l)
+
+	return nil
+}
+
+// URL トークンを含めたダッシュボードのURLを返す トークンはサーバーに送られないようフラグメントにつける
+func (s *Server) URL() string {
+	return "http://" + s.addr + "/#token=" + s.token
+}
+
+// Close 待ち受けを終える
+func (s *Server) Close() error {
+	if s.srv == nil {
+		return nil
+	}
+
+	return s.srv.Close()
+}
+
+// ServeHTTP リクエストを各エンドポイントへ振り分ける
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 他のサイトのページからDNSリバインディングで接続されないよう、ループバックを指すHostのみ受け付ける
+	if !loopbackHost(r.Host) {
+		http.Error(w, "forbidden host", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Path == "/" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+		w.Write([]byte(page))
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	type endpoint struct {
+		method string
+		handle func(r *http.Request) (interface{}, error)
+	}
+	endpoints := map[string]endpoint{
+		"/api/status":    {http.MethodGet, s.status},
+		"/api/report":    {http.MethodGet, s.report},
+		"/api/sites":     {http.MethodGet, s.sites},
+		"/api/files":     {http.MethodGet, s.files},
+		"/api/deadlines": {http.MethodGet, s.upcoming},
+		"/api/sync":      {http.MethodPost, s.sync},
+		"/api/open":      {http.MethodPost, s.open},
+	}
+
+	e, ok := endpoints[r.URL.Path]
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown endpoint"))
+		return
+	}
+	if r.Method != e.method {
+		w.Header().Set("Allow", e.method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	v, err := e.handle(r)
+	if err != nil {
+		var he *httpError
+		if errors.As(err, &he) {
+			writeError(w, he.code, he.err)
+		} else {
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorized Authorizationヘッダのトークンが正しいかどうか
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// loopbackHost Hostヘッダがループバックアドレスもしくはlocalhostを指すかどうか
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpError ステータスコードを伴うエラー
+type httpError struct {
+	code int
+	err  error
+}
+
+func (h *httpError) Error() string {
+	return h.err.Error()
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func (s *Server) status(*http.Request) (interface{}, error) {
+	return s.backend.Status(), nil
+}
+
+func (s *Server) report(*http.Request) (interface{}, error) {
+	r, err := resource.ReadReport(s.reportDir)
+	if os.IsNotExist(err) {
+		return nil, &httpError{code: http.StatusNotFound, err: errors.New("there is no report yet")}
+	}
+
+	return r, err
+}
+
+func (s *Server) sites(*http.Request) (interface{}, error) {
+	store, err := s.openStore()
+	if err != nil {
+		return nil, err
+	}
+
+	sites := make([]Site, 0)
+	for _, site := range store.Sites() {
+		sites = append(sites, Site{ID: site.ID, Title: site.Title, URL: pandaapi.SiteURL(site.ID), Files: site.Files, LastDownload: site.LastDownload})
+	}
+
+	return sites, nil
+}
+
+// files ダウンロードした資料の記録を返す siteを指定した場合はその授業サイトのもののみ
+func (s *Server) files(r *http.Request) (interface{}, error) {
+	store, err := s.openStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if site := r.URL.Query().Get("site"); site != "" {
+		return store.SiteRecords(site), nil
+	}
+
+	return store.Records(), nil
+}
+
+// upcoming 締切が過ぎていない課題を締切の早い順に返す
+func (s *Server) upcoming(r *http.Request) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.deadlines == nil || now.Sub(s.fetchedAt) > deadlineTTL {
+		deadlines, err := s.fetchDeadlines(r.Context())
+		if err != nil {
+			return nil, &httpError{code: http.StatusBadGateway, err: errors.New(pandaapi.Message(err, pandaapi.LangEnglish))}
+		}
+		s.deadlines, s.fetchedAt = deadlines, now
+	}
+
+	upcoming := make([]Deadline, 0, len(s.deadlines))
+	for _, d := range s.deadlines {
+		if d.Due.After(now) {
+			upcoming = append(upcoming, d)
+		}
+	}
+
+	return upcoming, nil
+}
+
+// fetchDeadlines PandAから課題の一覧を取得し、締切のあるものを授業サイトのタイトルとともに返す
+func (s *Server) fetchDeadlines(ctx context.Context) ([]Deadline, error) {
+	ctx, cancel := context.WithTimeout(ctx, deadlineTimeout)
+	defer cancel()
+
+	assignments, err := s.backend.Assignments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 授業サイトのタイトルはダウンロードの記録から引く
+	titles := make(map[string]string)
+	if store, err := s.openStore(); err == nil {
+		for _, rec := range store.Records() {
+			if rec.SiteTitle != "" {
+				titles[rec.SiteID] = rec.SiteTitle
+			}
+		}
+	}
+
+	deadlines := make([]Deadline, 0, len(assignments))
+	for _, a := range assignments {
+		if a.Due.IsZero() {
+			continue
+		}
+		title, ok := titles[a.SiteID]
+		if !ok {
+			title = a.SiteID
+		}
+		deadlines = append(deadlines, Deadline{SiteID: a.SiteID, SiteTitle: title, Title: a.Title, Due: a.Due.Time, URL: pandaapi.SiteURL(a.SiteID)})
+	}
+	sort.SliceStable(deadlines, func(i, j int) bool { return deadlines[i].Due.Before(deadlines[j].Due) })
+
+	return deadlines, nil
+}
+
+func (s *Server) sync(*http.Request) (interface{}, error) {
+	if err := s.backend.SyncNow(); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"result": "started"}, nil
+}
+
+// open ダウンロードした資料を開く 任意のファイルを開けないよう、記録にあるファイルのみ受け付ける
+func (s *Server) open(r *http.Request) (interface{}, error) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		return nil, &httpError{code: http.StatusBadRequest, err: errors.New("path is required")}
+	}
+
+	store, err := s.openStore()
+	if err != nil {
+		return nil, err
+	}
+	rec, ok := store.LookupPath(req.Path)
+	if !ok || !dir.Exists(rec.Path) {
+		return nil, &httpError{code: http.StatusNotFound, err: errors.New("the file is not downloaded by PandorA")}
+	}
+
+	if err := s.backend.OpenFile(rec.Path); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"result": "opened"}, nil
+}
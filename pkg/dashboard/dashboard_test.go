@@ -0,0 +1,213 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pandora/pkg/ipc"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+	"pandora/pkg/state"
+)
+
+const testToken = "0123456789abcdef"
+
+// testBackend 呼び出しを記録するBackend
+type testBackend struct {
+	synced  int
+	fetched int
+	opened  []string
+}
+
+func (b *testBackend) Status() ipc.Status {
+	return ipc.Status{Running: true}
+}
+
+func (b *testBackend) SyncNow() error {
+	b.synced++
+	return nil
+}
+
+func (b *testBackend) Assignments(ctx context.Context) ([]pandaapi.Assignment, error) {
+	b.fetched++
+	due := func(t time.Time) pandaapi.Timestamp { return pandaapi.Timestamp{Time: t, Raw: "x"} }
+	return []pandaapi.Assignment{
+		{Title: "第2回 レポート", SiteID: "site1", Due: due(time.Date(2020, 4, 24, 15, 0, 0, 0, time.UTC))},
+		{Title: "締切なし", SiteID: "site1"},
+		{Title: "第1回 レポート", SiteID: "site1", Due: due(time.Date(2020, 4, 17, 15, 0, 0, 0, time.UTC))},
+		{Title: "小テスト", SiteID: "site2", Due: due(time.Date(2020, 4, 20, 1, 30, 0, 0, time.UTC))},
+	}, nil
+}
+
+func (b *testBackend) OpenFile(path string) error {
+	b.opened = append(b.opened, path)
+	return nil
+}
+
+func newTestServer(t *testing.T) (*Server, *testBackend, string) {
+	tmp, err := ioutil.TempDir("", "pandora-dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+
+	slides := filepath.Join(tmp, "線形代数学", "slides.pdf")
+	if err := os.MkdirAll(filepath.Dir(slides), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(slides, []byte("%PDF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := state.New()
+	store.Put(state.Record{URL: "https://example.com/site1/slides.pdf", SiteID: "site1", SiteTitle: "線形代数学", Title: "slides.pdf", Path: slides})
+	store.Put(state.Record{URL: "https://example.com/site1/notes.pdf", SiteID: "site1", SiteTitle: "線形代数学", Title: "notes.pdf"})
+
+	b := &testBackend{}
+	s := New(b, testToken)
+	s.openStore = func() (*state.Store, error) { return store, nil }
+	s.reportDir = tmp
+	s.now = func() time.Time { return time.Date(2020, 4, 18, 0, 0, 0, 0, time.UTC) }
+
+	return s, b, slides
+}
+
+func request(s *Server, method, path, body string, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "http://127.0.0.1:47810"+path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAuthorization(t *testing.T) {
+	s, b, _ := newTestServer(t)
+
+	if w := request(s, "GET", "/", "", ""); w.Code != 200 || !strings.Contains(w.Body.String(), "<title>PandorA</title>") {
+		t.Errorf("page: %d", w.Code)
+	}
+	if w := request(s, "GET", "/api/status", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: %d", w.Code)
+	}
+	if w := request(s, "POST", "/api/sync", "", "wrong"); w.Code != http.StatusUnauthorized || b.synced != 0 {
+		t.Errorf("wrong token: %d", w.Code)
+	}
+	if w := request(s, "GET", "/api/sync", "", testToken); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong method: %d", w.Code)
+	}
+
+	// ループバック以外を指すHostは拒否する
+	r := httptest.NewRequest("GET", "http://evil.example.com/api/status", nil)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("foreign host: %d", w.Code)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	s, b, slides := newTestServer(t)
+
+	w := request(s, "GET", "/api/status", "", testToken)
+	var status ipc.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || !status.Running {
+		t.Errorf("status: %s", w.Body)
+	}
+
+	if w := request(s, "GET", "/api/report", "", testToken); w.Code != http.StatusNotFound {
+		t.Errorf("report before sync: %d", w.Code)
+	}
+	report := &resource.SyncReport{New: 1, Files: []resource.FileReport{{SiteID: "site1", Title: "slides.pdf", Local: slides}}}
+	if _, _, err := report.Save(s.reportDir); err != nil {
+		t.Fatal(err)
+	}
+	if w := request(s, "GET", "/api/report", "", testToken); w.Code != 200 || !strings.Contains(w.Body.String(), `"new":1`) {
+		t.Errorf("report: %d %s", w.Code, w.Body)
+	}
+
+	var sites []Site
+	w = request(s, "GET", "/api/sites", "", testToken)
+	if err := json.Unmarshal(w.Body.Bytes(), &sites); err != nil || len(sites) != 1 || sites[0].Title != "線形代数学" || sites[0].Files != 2 {
+		t.Errorf("sites: %s", w.Body)
+	}
+
+	var files []state.Record
+	w = request(s, "GET", "/api/files?site=site1", "", testToken)
+	if err := json.Unmarshal(w.Body.Bytes(), &files); err != nil || len(files) != 2 {
+		t.Errorf("files: %s", w.Body)
+	}
+
+	if w := request(s, "POST", "/api/sync", "", testToken); w.Code != 200 || b.synced != 1 {
+		t.Errorf("sync: %d", w.Code)
+	}
+
+	// 記録にあるファイルのみ開ける
+	if w := request(s, "POST", "/api/open", `{"path":"/etc/passwd"}`, testToken); w.Code != http.StatusNotFound || len(b.opened) != 0 {
+		t.Errorf("open unknown file: %d", w.Code)
+	}
+	body, _ := json.Marshal(map[string]string{"path": slides})
+	if w := request(s, "POST", "/api/open", string(body), testToken); w.Code != 200 || len(b.opened) != 1 || b.opened[0] != slides {
+		t.Errorf("open: %d %v", w.Code, b.opened)
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	s, b, _ := newTestServer(t)
+
+	var deadlines []Deadline
+	w := request(s, "GET", "/api/deadlines", "", testToken)
+	if err := json.Unmarshal(w.Body.Bytes(), &deadlines); err != nil {
+		t.Fatalf("deadlines: %s", w.Body)
+	}
+
+	// 締切を過ぎたものと締切のないものは除き、締切の早い順に並べる
+	if len(deadlines) != 2 || deadlines[0].Title != "小テスト" || deadlines[1].Title != "第2回 レポート" {
+		t.Fatalf("deadlines: %+v", deadlines)
+	}
+	if deadlines[1].SiteTitle != "線形代数学" || deadlines[0].SiteTitle != "site2" || deadlines[0].URL != pandaapi.SiteURL("site2") {
+		t.Errorf("site: %+v", deadlines)
+	}
+
+	// 一定時間はPandAに問い合わせ直さない
+	request(s, "GET", "/api/deadlines", "", testToken)
+	if b.fetched != 1 {
+		t.Errorf("fetched %d times", b.fetched)
+	}
+	s.now = func() time.Time { return time.Date(2020, 4, 18, 1, 0, 0, 0, time.UTC) }
+	request(s, "GET", "/api/deadlines", "", testToken)
+	if b.fetched != 2 {
+		t.Errorf("fetched %d times after the cache expired", b.fetched)
+	}
+}
+
+func TestToken(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "state", tokenFile)
+	token, err := loadToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("token: %q, %v", token, err)
+	}
+	if again, err := loadToken(path); err != nil || again != token {
+		t.Errorf("token changed: %q, %v", again, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode: %v, %v", info, err)
+	}
+}
@@ -0,0 +1,186 @@
+package dashboard
+
+// page ダッシュボードのページ データはトークンを付けて /api/ から取得する
+const page = `<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>PandorA</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 960px; padding: 1em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; border-bottom: 1px solid #ccc; padding-bottom: .2em; margin-top: 1.5em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; padding: .25em .5em; border-bottom: 1px solid #eee; }
+summary { cursor: pointer; padding: .25em 0; }
+a.file { cursor: pointer; color: #06c; text-decoration: underline; }
+.muted { color: #888; }
+.error { color: #c00; }
+#status span { margin-right: 1.5em; }
+</style>
+</head>
+<body>
+<h1>PandorA</h1>
+<p id="status" class="muted">Loading...</p>
+<button id="sync">Sync now</button>
+<span id="message"></span>
+
+<h2>Upcoming deadlines</h2>
+<div id="deadlines" class="muted">Loading...</div>
+
+<h2>Recent changes</h2>
+<div id="changes" class="muted">Loading...</div>
+
+<h2>Course materials</h2>
+<div id="materials" class="muted">Loading...</div>
+
+<script>
+"use strict";
+
+// トークンはURLのフラグメントで受け取り、履歴に残らないよう取り除く
+const match = location.hash.match(/token=([0-9a-f]+)/);
+if (match) {
+  sessionStorage.setItem("token", match[1]);
+  history.replaceState(null, "", "/");
+}
+const token = sessionStorage.getItem("token") || "";
+
+async function api(path, options) {
+  options = options || {};
+  options.headers = { "Authorization": "Bearer " + token };
+  const resp = await fetch(path, options);
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+function el(tag, text, attrs) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  for (const k in attrs || {}) e.setAttribute(k, attrs[k]);
+  return e;
+}
+
+function fmt(t) {
+  if (!t || t.startsWith("0001-")) return "-";
+  return new Date(t).toLocaleString([], { month: "numeric", day: "numeric", weekday: "short", hour: "2-digit", minute: "2-digit" });
+}
+
+function fileLink(title, path) {
+  if (!path) return el("span", title);
+  const a = el("a", title, { class: "file", title: path });
+  a.onclick = () => api("/api/open", { method: "POST", body: JSON.stringify({ path: path }) })
+    .catch(err => show(err.message, true));
+  return a;
+}
+
+function table(rows) {
+  const t = el("table");
+  for (const cells of rows) {
+    const tr = el("tr");
+    for (const c of cells) {
+      const td = el("td");
+      td.append(c);
+      tr.append(td);
+    }
+    t.append(tr);
+  }
+  return t;
+}
+
+function fill(id, content) {
+  const e = document.getElementById(id);
+  e.className = "";
+  e.replaceChildren(content);
+}
+
+function fail(id, err) {
+  const e = document.getElementById(id);
+  e.className = "error";
+  e.textContent = err.message;
+}
+
+function show(text, error) {
+  const m = document.getElementById("message");
+  m.className = error ? "error" : "muted";
+  m.textContent = text;
+}
+
+async function loadStatus() {
+  try {
+    const s = await api("/api/status");
+    const paused = fmt(s.pausedUntil);
+    const state = s.running ? "Downloading" : s.queued ? "Waiting for PandA" : paused !== "-" ? "Paused until " + paused : "Idle";
+    const started = fmt(s.lastRun.lastStart);
+    const last = started === "-" ? "-" : started + " (" + s.lastRun.result + ", " + s.lastRun.new + " new)";
+    const p = el("p");
+    p.append(el("span", state), el("span", "Last sync: " + last), el("span", "Next sync: " + fmt(s.nextRun)));
+    fill("status", p);
+  } catch (err) {
+    fail("status", err);
+  }
+}
+
+async function loadDeadlines() {
+  try {
+    const ds = await api("/api/deadlines");
+    if (ds.length === 0) {
+      fill("deadlines", el("span", "No upcoming deadlines.", { class: "muted" }));
+      return;
+    }
+    fill("deadlines", table(ds.map(d => [fmt(d.due), el("a", d.siteTitle, { href: d.url, target: "_blank" }), d.title])));
+  } catch (err) {
+    fail("deadlines", err);
+  }
+}
+
+async function loadChanges() {
+  try {
+    const r = await api("/api/report");
+    r.files = r.files || [];
+    if (r.files.length === 0) {
+      fill("changes", el("span", "Nothing was downloaded in the last sync (" + fmt(r.startedAt) + ").", { class: "muted" }));
+      return;
+    }
+    fill("changes", table(r.files.map(f => [f.updated ? "Updated" : "New", f.siteTitle, fileLink(f.path, f.local)])));
+  } catch (err) {
+    fail("changes", err);
+  }
+}
+
+async function loadMaterials() {
+  try {
+    const [sites, files] = await Promise.all([api("/api/sites"), api("/api/files")]);
+    const div = el("div");
+    for (const s of sites) {
+      const d = el("details");
+      d.append(el("summary", s.title + " (" + s.files + ")"));
+      const rows = (files || []).filter(f => f.siteID === s.id)
+        .map(f => [fileLink(f.sitePath || f.title, f.path), fmt(f.downloadedAt)]);
+      d.append(table(rows));
+      div.append(d);
+    }
+    fill("materials", sites.length ? div : el("span", "No materials yet.", { class: "muted" }));
+  } catch (err) {
+    fail("materials", err);
+  }
+}
+
+document.getElementById("sync").onclick = () => {
+  api("/api/sync", { method: "POST" })
+    .then(() => { show("Started."); setTimeout(loadStatus, 1000); })
+    .catch(err => show(err.message, true));
+};
+
+loadStatus();
+loadDeadlines();
+loadChanges();
+loadMaterials();
+setInterval(loadStatus, 30000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,101 @@
+package dir
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// FS pkg/dirが用いるファイルシステムの操作
+// パスは全て絶対パスで渡され、カレントディレクトリには依存しない
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// File FSで開いたファイル
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+}
+
+// OS 実際のファイルシステム
+var OS FS = osFS{}
+
+var (
+	fsMu sync.RWMutex
+	fsys = OS
+)
+
+// SetFS pkg/dirが用いるファイルシステムを差し替える nilの場合は実際のファイルシステムに戻す
+func SetFS(f FS) {
+	fsMu.Lock()
+	defer fsMu.Unlock()
+
+	if f == nil {
+		f = OS
+	}
+	fsys = f
+}
+
+// currentFS 現在用いているファイルシステムを返す
+func currentFS() FS {
+	fsMu.RLock()
+	defer fsMu.RUnlock()
+
+	return fsys
+}
+
+// Stat ファイルの情報を返す
+func Stat(path string) (os.FileInfo, error) {
+	return currentFS().Stat(path)
+}
+
+// Open ファイルを読み込み用に開く
+func Open(path string) (File, error) {
+	return currentFS().OpenFile(path, os.O_RDONLY, 0)
+}
+
+// Remove ファイルもしくは空のフォルダを削除する
+func Remove(path string) error {
+	return currentFS().Remove(path)
+}
+
+// Exists ファイルもしくはフォルダが存在するかどうかを判定する
+func Exists(path string) bool {
+	_, err := currentFS().Stat(path)
+	return err == nil
+}
+
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// nilの*os.FileをFileとして返さないようにする
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
@@ -0,0 +1,324 @@
+package dir
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS メモリ上のファイルシステム テストで実際のファイルシステムの代わりに用いる
+// 複数のゴルーチンから同時に用いてよい
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+// memNode MemFSのファイルもしくはフォルダ
+type memNode struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NewMemFS 空のMemFSを返す
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: make(map[string]*memNode)}
+}
+
+// parentExists nameの親フォルダが存在するかどうか ロックを取得した状態で呼ぶ
+func (m *MemFS) parentExists(name string) bool {
+	parent := filepath.Dir(name)
+	if parent == name {
+		return true
+	}
+	n, ok := m.nodes[parent]
+	return ok && n.mode.IsDir()
+}
+
+// Stat ファイルもしくはフォルダの情報を返す
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if filepath.Dir(name) == name {
+		return (&memNode{mode: os.ModeDir | 0755}).info(name), nil
+	}
+
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return n.info(filepath.Base(name)), nil
+}
+
+// MkdirAll 途中のフォルダも含めてフォルダを作成する
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	for p := path; filepath.Dir(p) != p; p = filepath.Dir(p) {
+		if n, ok := m.nodes[p]; ok {
+			if !n.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: p, Err: errNotDir}
+			}
+			continue
+		}
+		m.nodes[p] = &memNode{mode: os.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+
+	return nil
+}
+
+// OpenFile flagに従ってファイルを開く 親フォルダがない場合は作成しない
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, ok := m.nodes[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case ok && n.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok && !m.parentExists(name):
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[name] = n
+	}
+
+	if flag&os.O_TRUNC != 0 {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+
+	f := &memFile{fs: m, name: name, node: n, flag: flag}
+	if flag&os.O_APPEND != 0 {
+		f.offset = int64(len(n.data))
+	}
+	return f, nil
+}
+
+// Rename ファイルもしくはフォルダを移動する フォルダの場合は中身も移動する
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	n, ok := m.nodes[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if !m.parentExists(newpath) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = n
+
+	if n.mode.IsDir() {
+		prefix := oldpath + string(filepath.Separator)
+		for p, child := range m.nodes {
+			if strings.HasPrefix(p, prefix) {
+				delete(m.nodes, p)
+				m.nodes[filepath.Join(newpath, strings.TrimPrefix(p, prefix))] = child
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove ファイルもしくは空のフォルダを削除する
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	n, ok := m.nodes[name]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if n.mode.IsDir() && len(m.children(name)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+
+	delete(m.nodes, name)
+	return nil
+}
+
+// ReadFile ファイルの内容を返す
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	f, err := m.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteFile ファイルを作成してdataを書き込む 途中のフォルダも作成する
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := m.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Files 全てのファイルのパスを並べて返す フォルダは含まない
+func (m *MemFS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := make([]string, 0, len(m.nodes))
+	for p, n := range m.nodes {
+		if !n.mode.IsDir() {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// children フォルダの直下にあるファイルとフォルダのパス ロックを取得した状態で呼ぶ
+func (m *MemFS) children(folder string) []string {
+	children := make([]string, 0)
+	for p := range m.nodes {
+		if filepath.Dir(p) == folder && p != folder {
+			children = append(children, p)
+		}
+	}
+	return children
+}
+
+// memFile MemFSで開いたファイル
+type memFile struct {
+	fs     *MemFS
+	name   string
+	node   *memNode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrPermission}
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrPermission}
+	}
+
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset += int64(len(p))
+	f.node.modTime = time.Now()
+
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+// info その時点でのファイルの情報を返す ロックを取得した状態で呼ぶ
+func (n *memNode) info(name string) os.FileInfo {
+	return &memFileInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// memFileInfo MemFSのファイルの情報
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+// MemFSが返すエラー
+var (
+	errNotDir   = errorString("not a directory")
+	errIsDir    = errorString("is a directory")
+	errNotEmpty = errorString("directory not empty")
+)
+
+type errorString string
+
+func (e errorString) Error() string {
+	return string(e)
+}
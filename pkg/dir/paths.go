@@ -0,0 +1,232 @@
+package dir
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+const (
+	// アプリケーションのディレクトリの名前
+	appName = "pandora"
+	// macOSとWindowsでのアプリケーションのディレクトリの名前
+	appDisplayName = "PandorA"
+
+	// 実行ファイルと同じディレクトリにこの名前のファイルがあればポータブルモードで動作する
+	portableMarker = "portable"
+	// ポータブルモードを指定する環境変数
+	portableEnv = "PANDORA_PORTABLE"
+)
+
+// paths ファイルの種類ごとの保存先
+// Linuxなどでは XDG Base Directory に従い、macOSとWindowsではそれぞれの慣習に従う
+// ポータブルモードでは全て実行ファイルと同じディレクトリに保存する
+type paths struct {
+	config, state, cache, log string
+	portable                  bool
+}
+
+// 旧バージョンで実行ファイルと同じディレクトリに保存していたファイルと、その移行先
+var legacyFiles = map[string]func(p *paths) string{
+	"account.dat":      func(p *paths) string { return p.config },
+	"reject.dat":       func(p *paths) string { return p.config },
+	"config.yaml":      func(p *paths) string { return p.config },
+	"credentials.dat":  func(p *paths) string { return p.config },
+	"dmap.dat":         func(p *paths) string { return p.state },
+	"last-report.json": func(p *paths) string { return p.state },
+	"last-report.md":   func(p *paths) string { return p.state },
+	"pandoraError.log": func(p *paths) string { return p.log },
+}
+
+var (
+	resolved     *paths
+	resolvedOnce sync.Once
+)
+
+// current 保存先を決定して返す 初回の呼び出しでディレクトリの作成と旧ファイルの移行を行う
+func current() *paths {
+	resolvedOnce.Do(func() {
+		resolved = resolvePaths(runtime.GOOS, os.Getenv, isPortable())
+
+		for _, d := range []string{resolved.config, resolved.state, resolved.cache, resolved.log} {
+			if err := currentFS().MkdirAll(d, 0700); err != nil {
+				log.Println("cannot create directory:", err)
+			}
+		}
+
+		if !resolved.portable {
+			migrateLegacyFiles(WorkingDirecory, resolved)
+		}
+	})
+
+	return resolved
+}
+
+// isPortable ポータブルモードで動作するかどうかを判定する
+func isPortable() bool {
+	if v := os.Getenv(portableEnv); v != "" {
+		return v != "0" && v != "false"
+	}
+
+	return Exists(filepath.Join(WorkingDirecory, portableMarker))
+}
+
+// resolvePaths OSと環境変数から保存先を決定する
+func resolvePaths(goos string, getenv func(string) string, portable bool) *paths {
+	if portable {
+		return &paths{config: WorkingDirecory, state: WorkingDirecory, cache: WorkingDirecory, log: WorkingDirecory, portable: true}
+	}
+
+	home := getenv("HOME")
+	if goos == "windows" {
+		home = getenv("USERPROFILE")
+	}
+
+	// 環境変数が設定されていなければ既定のパスを用いる
+	env := func(name string, fallback ...string) string {
+		if v := getenv(name); v != "" && filepath.IsAbs(v) {
+			return v
+		}
+		return filepath.Join(append([]string{home}, fallback...)...)
+	}
+
+	switch goos {
+	case "windows":
+		roaming := env("APPDATA", "AppData", "Roaming")
+		local := env("LOCALAPPDATA", "AppData", "Local")
+		return &paths{
+			config: filepath.Join(roaming, appDisplayName),
+			state:  filepath.Join(local, appDisplayName),
+			cache:  filepath.Join(local, appDisplayName, "Cache"),
+			log:    filepath.Join(local, appDisplayName, "Logs"),
+		}
+
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support", appDisplayName)
+		return &paths{
+			config: support,
+			state:  support,
+			cache:  filepath.Join(home, "Library", "Caches", appDisplayName),
+			log:    filepath.Join(home, "Library", "Logs", appDisplayName),
+		}
+	}
+
+	state := filepath.Join(env("XDG_STATE_HOME", ".local", "state"), appName)
+	return &paths{
+		config: filepath.Join(env("XDG_CONFIG_HOME", ".config"), appName),
+		state:  state,
+		cache:  filepath.Join(env("XDG_CACHE_HOME", ".cache"), appName),
+		log:    state,
+	}
+}
+
+// migrateLegacyFiles 実行ファイルと同じディレクトリに残っているファイルを新しい保存先へ移動する
+// 移行先に同名のファイルが既にある場合は移動しない
+func migrateLegacyFiles(from string, p *paths) {
+	for name, to := range legacyFiles {
+		src := filepath.Join(from, name)
+		dst := filepath.Join(to(p), name)
+		if src == dst {
+			continue
+		}
+
+		if !Exists(src) || Exists(dst) {
+			continue
+		}
+
+		if err := MoveFile(src, dst); err != nil {
+			log.Printf("cannot migrate %s: %s", src, err)
+		}
+	}
+}
+
+// MoveFile ファイルを移動する 移動先のフォルダがなければ作成する
+// 別のファイルシステムへの移動はコピーしてから削除する
+func MoveFile(src, dst string) error {
+	fsys := currentFS()
+
+	if err := fsys.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := fsys.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := fsys.OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		fsys.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		fsys.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return fsys.Remove(src)
+}
+
+// Portable ポータブルモード(全てのファイルを実行ファイルと同じディレクトリに保存する)で動作しているかを返す
+func Portable() bool {
+	return current().portable
+}
+
+// ConfigDir 設定ファイルと認証情報を保存するディレクトリを返す
+func ConfigDir() string {
+	return current().config
+}
+
+// StateDir ダウンロードの記録やレポートを保存するディレクトリを返す
+func StateDir() string {
+	return current().state
+}
+
+// CacheDir 削除しても問題のない一時的なデータを保存するディレクトリを返す
+func CacheDir() string {
+	return current().cache
+}
+
+// LogDir ログファイルを保存するディレクトリを返す
+func LogDir() string {
+	return current().log
+}
+
+// ConfigPath 設定ファイルのパスを返す
+func ConfigPath(filename string) string {
+	return filepath.Join(ConfigDir(), filename)
+}
+
+// StatePath 状態を記録するファイルのパスを返す
+func StatePath(filename string) string {
+	return filepath.Join(StateDir(), filename)
+}
+
+// CachePath キャッシュのファイルのパスを返す
+func CachePath(filename string) string {
+	return filepath.Join(CacheDir(), filename)
+}
+
+// LogPath ログファイルのパスを返す
+func LogPath(filename string) string {
+	return filepath.Join(LogDir(), filename)
+}
@@ -0,0 +1,122 @@
+package dir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePaths(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(name string) string { return m[name] }
+	}
+
+	tests := []struct {
+		goos string
+		env  map[string]string
+		want paths
+	}{
+		{
+			goos: "linux",
+			env:  map[string]string{"HOME": "/home/u"},
+			want: paths{
+				config: "/home/u/.config/pandora",
+				state:  "/home/u/.local/state/pandora",
+				cache:  "/home/u/.cache/pandora",
+				log:    "/home/u/.local/state/pandora",
+			},
+		},
+		{
+			// 相対パスのXDG_*は無視する
+			goos: "linux",
+			env:  map[string]string{"HOME": "/home/u", "XDG_CONFIG_HOME": "/etc/xdg/u", "XDG_STATE_HOME": "/var/u", "XDG_CACHE_HOME": "cache"},
+			want: paths{
+				config: "/etc/xdg/u/pandora",
+				state:  "/var/u/pandora",
+				cache:  "/home/u/.cache/pandora",
+				log:    "/var/u/pandora",
+			},
+		},
+		{
+			goos: "darwin",
+			env:  map[string]string{"HOME": "/Users/u"},
+			want: paths{
+				config: "/Users/u/Library/Application Support/PandorA",
+				state:  "/Users/u/Library/Application Support/PandorA",
+				cache:  "/Users/u/Library/Caches/PandorA",
+				log:    "/Users/u/Library/Logs/PandorA",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := resolvePaths(tt.goos, env(tt.env), false)
+		if *got != tt.want {
+			t.Errorf("%s %v:\ngot  %+v\nwant %+v", tt.goos, tt.env, *got, tt.want)
+		}
+	}
+
+	if p := resolvePaths("linux", env(nil), true); !p.portable || p.config != WorkingDirecory || p.state != WorkingDirecory {
+		t.Errorf("portable: %+v", *p)
+	}
+}
+
+func TestMigrateLegacyFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	exe := filepath.Join(tmp, "bin")
+	p := &paths{
+		config: filepath.Join(tmp, "config"),
+		state:  filepath.Join(tmp, "state"),
+		cache:  filepath.Join(tmp, "cache"),
+		log:    filepath.Join(tmp, "log"),
+	}
+	for _, d := range []string{exe, p.config, p.state, p.cache, p.log} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"dmap.dat":         "{}",
+		"credentials.dat":  "sealed",
+		"pandoraError.log": "log",
+		"form":             "binary",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(exe, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 移行先に既にあるファイルは上書きしない
+	if err := ioutil.WriteFile(filepath.Join(p.config, "credentials.dat"), []byte("newer"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	migrateLegacyFiles(exe, p)
+
+	moved := map[string]string{
+		filepath.Join(p.state, "dmap.dat"):         "{}",
+		filepath.Join(p.log, "pandoraError.log"):   "log",
+		filepath.Join(p.config, "credentials.dat"): "newer",
+		filepath.Join(exe, "credentials.dat"):      "sealed",
+		filepath.Join(exe, "form"):                 "binary",
+	}
+	for path, want := range moved {
+		got, err := ioutil.ReadFile(path)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	for _, name := range []string{"dmap.dat", "pandoraError.log"} {
+		if _, err := os.Stat(filepath.Join(exe, name)); !os.IsNotExist(err) {
+			t.Errorf("%s is left in the executable directory", name)
+		}
+	}
+}
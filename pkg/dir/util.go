@@ -7,13 +7,25 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
+)
 
-	"github.com/google/uuid"
+const (
+	// 資料をダウンロードするフォルダの名前
+	pandorAFolder = "PandorA Box"
+	// 同名のファイルを残す場合に名前を変えて試す回数の上限
+	maxKeepBoth = 100
 )
 
 var (
 	// WorkingDirecory 実行ファイルの存在するディレクトリ
 	WorkingDirecory string
+
+	// SetDownloadRootで指定された資料をダウンロードするフォルダ
+	downloadRoot string
+
+	// 現在時刻 テストで差し替える
+	now = time.Now
 )
 
 func init() {
@@ -37,113 +49,90 @@ func getPathToDesktop() (path string) {
 		home = os.Getenv("USERPROFILE")
 	}
 
-	if err := os.Chdir(home); err != nil {
-		return home
-	}
-
-	if info, err := os.Stat(home + "/Desktop"); !os.IsNotExist(err) && info.IsDir() {
-		// $HOME/Desktopが存在する場合
-		return home + "/Desktop"
-	}
+	return desktopPath(currentFS(), home)
+}
 
-	if info, err := os.Stat(home + "/デスクトップ"); !os.IsNotExist(err) && info.IsDir() {
-		// $HOME/デスクトップが存在する場合
-		return home + "/デスクトップ"
+// desktopPath home以下のデスクトップのフォルダのパスを返す 存在しない場合はhomeを返す
+func desktopPath(fsys FS, home string) string {
+	for _, name := range []string{"Desktop", "デスクトップ"} {
+		// $HOME/Desktop もしくは $HOME/デスクトップ が存在する場合
+		p := filepath.Join(home, name)
+		if info, err := fsys.Stat(p); err == nil && info.IsDir() {
+			return p
+		}
 	}
 
 	return home
 }
 
-// PandorAフォルダへ移動する
-func cdPandorA() error {
-	folderName := "PandorA Box"
+// SetDownloadRoot 資料をダウンロードするフォルダを指定する 空の場合はデスクトップのPandorAフォルダを用いる
+func SetDownloadRoot(path string) {
+	downloadRoot = path
+}
 
-	if err := os.Chdir(getPathToDesktop()); err != nil {
-		return err
-	}
+// PandorAPath PandorAフォルダのパスを返す
+func PandorAPath() string {
+	return ResolveDownloadRoot(downloadRoot)
+}
 
-	if info, err := os.Stat(folderName); os.IsNotExist(err) || !info.IsDir() {
-		// PandorAフォルダが存在しない場合は作成する
-		if err := os.Mkdir(folderName, 0766); err != nil {
-			return err
-		}
+// ResolveDownloadRoot 設定された資料をダウンロードするフォルダのパスを返す 空の場合はデスクトップのPandorAフォルダ
+func ResolveDownloadRoot(root string) string {
+	if root != "" {
+		return root
 	}
 
-	return os.Chdir(folderName)
+	return filepath.Join(getPathToDesktop(), pandorAFolder)
 }
 
-// FetchFile PandorAフォルダ内のファイルを取得する関数 フォルダ名が空の場合はPandorAフォルダに直でファイルを作成・取得する
-func FetchFile(filename, foldername string) (file *os.File, err error) {
-	// あらかじめ戻り先を絶対パスに展開しておく
-	prev, err := filepath.Abs(".")
-	if err != nil {
-		return file, err
-	}
-	defer os.Chdir(prev)
+// CreateFile pathにファイルを作成する 途中のフォルダがなければ作成する
+// 同名のファイルが既に存在する場合は上書きせず、名前に日時をつけたファイルを作成して実際に作成したファイルのパスを返す
+// 同じパスに対して並行に呼ばれても、それぞれ異なるファイルを作成する
+func CreateFile(path string) (file File, created string, err error) {
+	fsys := currentFS()
 
-	if err := cdPandorA(); err != nil {
-		return file, err
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, "", err
 	}
 
-	if foldername != "" {
-		if info, err := os.Stat(foldername); os.IsNotExist(err) || !info.IsDir() {
-			// 授業用のフォルダが存在しない場合は作成する
-			if err := os.Mkdir(foldername, 0766); err != nil {
-				return file, err
-			}
+	stamp := now().Format("2006-01-02 150405")
+	created = path
+	for i := 1; ; i++ {
+		file, err = fsys.OpenFile(created, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file, created, nil
+		}
+		if !os.IsExist(err) || i > maxKeepBoth {
+			return nil, "", err
 		}
 
-		if err := os.Chdir(foldername); err != nil {
-			return file, err
+		// slides.pdf → slides (2020-10-18 120405).pdf → slides (2020-10-18 120405 2).pdf
+		if i == 1 {
+			created = Suffixed(path, stamp)
+		} else {
+			created = Suffixed(path, fmt.Sprintf("%s %d", stamp, i))
 		}
 	}
+}
 
-	// ファイルがなければ作成し、読み書き両用でファイルを開く
-	if _, err := os.Stat(filename); !os.IsNotExist(err) {
-		// 同名のファイルが既に存在している場合にはファイル名に(n)をつけたファイルを作成
-		text := strings.Split(filename, ".")
-
-		changed := false
-		for i := 1; i < 10; i++ {
-			var newName string
-
-			if len(text) == 2 {
-				newName = text[0] + fmt.Sprintf("(%d)", i) + "." + text[1]
-			} else {
-				newName = fmt.Sprintf("(%d)", i) + filename
-			}
-
-			if _, err := os.Stat(newName); os.IsNotExist(err) {
-				changed = true
-				filename = newName
-				break
-			}
-		}
+// OverwriteFile pathのファイルを上書きするために開く 途中のフォルダがなければ作成する
+func OverwriteFile(path string) (File, error) {
+	fsys := currentFS()
 
-		if !changed {
-			// 10個以上同名のファイルが存在する場合にはuuidをファイル名の頭につける
-			u, err := uuid.NewRandom()
-			if err != nil {
-				return file, err
-			}
-			filename = u.String() + filename
-		}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
 	}
 
-	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0766)
+	return fsys.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 }
 
-// FetchSettingsFile 設定ファイルを実行ファイルと同じディレクトリに生成する
-func FetchSettingsFile(filename string) (file *os.File, err error) {
-	prev, err := filepath.Abs(".")
-	if err != nil {
-		return file, err
+// Suffixed ファイル名の拡張子の前に " (suffix)" をつけたパスを返す
+// a.b.pdf は a.b (suffix).pdf に、拡張子のない名前や .bashrc は末尾につける
+func Suffixed(path, suffix string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	if ext == "" || base == "" || strings.HasSuffix(base, string(filepath.Separator)) {
+		base, ext = path, ""
 	}
-	defer os.Chdir(prev)
 
-	if err := os.Chdir(WorkingDirecory); err != nil {
-		return file, err
-	}
-	// ファイルがなければ作成し、存在する場合は既に存在するファイルをオープンする
-	return os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	return base + " (" + suffix + ")" + ext
 }
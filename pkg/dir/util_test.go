@@ -0,0 +1,153 @@
+package dir
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useMemFS テストの間だけメモリ上のファイルシステムを用いる
+func useMemFS(t *testing.T) *MemFS {
+	m := NewMemFS()
+	SetFS(m)
+	t.Cleanup(func() { SetFS(nil) })
+	return m
+}
+
+func TestDesktopPath(t *testing.T) {
+	home := filepath.FromSlash("/home/u")
+
+	m := NewMemFS()
+	if got := desktopPath(m, home); got != home {
+		t.Errorf("got %s, want %s", got, home)
+	}
+
+	if err := m.MkdirAll(filepath.Join(home, "デスクトップ"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := desktopPath(m, home), filepath.Join(home, "デスクトップ"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// 同名のファイルはデスクトップとみなさない
+	if err := m.WriteFile(filepath.Join(home, "Desktop"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := desktopPath(m, home), filepath.Join(home, "デスクトップ"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	m := useMemFS(t)
+	now = func() time.Time { return time.Date(2020, 10, 18, 12, 4, 5, 0, time.Local) }
+	defer func() { now = time.Now }()
+
+	folder := filepath.FromSlash("/root/PandorA Box/線形代数学")
+
+	want := []string{"第1回.a.b.pdf", "第1回.a.b (2020-10-18 120405).pdf", "第1回.a.b (2020-10-18 120405 2).pdf"}
+	for _, name := range want {
+		file, created, err := CreateFile(filepath.Join(folder, "第1回.a.b.pdf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		if created != filepath.Join(folder, name) {
+			t.Errorf("got %s, want %s", created, name)
+		}
+	}
+
+	if n := len(m.Files()); n != len(want) {
+		t.Errorf("%d files are created", n)
+	}
+}
+
+func TestSuffixed(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/a/slides.pdf", "/a/slides (x).pdf"},
+		{"/a/a.b.pdf", "/a/a.b (x).pdf"},
+		{"/a/README", "/a/README (x)"},
+		{"/a/.bashrc", "/a/.bashrc (x)"},
+		{"/a.d/README", "/a.d/README (x)"},
+	}
+
+	for _, tt := range tests {
+		if got := Suffixed(filepath.FromSlash(tt.path), "x"); got != filepath.FromSlash(tt.want) {
+			t.Errorf("Suffixed(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// 並行にダウンロードしても、それぞれのファイルが正しいフォルダに保存される
+func TestCreateFileConcurrently(t *testing.T) {
+	m := useMemFS(t)
+	root := filepath.FromSlash("/root/PandorA Box")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// 同じ名前のファイルを異なるフォルダと同じフォルダの両方に作成する
+			for _, folder := range []string{fmt.Sprintf("site%d", i), "shared"} {
+				file, created, err := CreateFile(filepath.Join(root, folder, "slides.pdf"))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				io.WriteString(file, created)
+				file.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	files := m.Files()
+	if len(files) != 32 {
+		t.Fatalf("%d files are created: %v", len(files), files)
+	}
+	for _, p := range files {
+		data, err := m.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != p {
+			t.Errorf("%s contains %s", p, data)
+		}
+		if filepath.Dir(p) == filepath.Join(root, "shared") {
+			continue
+		}
+		if !strings.HasSuffix(p, "slides.pdf") {
+			t.Errorf("unexpected name: %s", p)
+		}
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	m := useMemFS(t)
+	src := filepath.FromSlash("/old/a.pdf")
+	dst := filepath.FromSlash("/new/folder/a.pdf")
+
+	if err := m.WriteFile(src, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if Exists(src) {
+		t.Error("source file is left")
+	}
+	if data, err := m.ReadFile(dst); err != nil || string(data) != "a" {
+		t.Errorf("moved file: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,273 @@
+// Package ipc 常駐しているPandorAとフォームやコマンドラインの間で、ローカルのソケットを通じてJSON-RPCで通信する
+// 多重起動はソケットと同じディレクトリのロックファイルで防ぐ WindowsでもWindows 10以降はUnixドメインソケットを使える
+package ipc
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pandora/pkg/dir"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+	"pandora/pkg/state"
+)
+
+const (
+	// ソケットの名前
+	socketFile = "pandora.sock"
+	// RPCのサービス名
+	serviceName = "PandorA"
+	// 起動中のPandorAに接続する際のタイムアウト
+	dialTimeout = 2 * time.Second
+)
+
+var (
+	// ErrAlreadyRunning 他のPandorAが既に起動している
+	ErrAlreadyRunning = errors.New("PandorA is already running")
+	// ErrNotRunning 起動中のPandorAがない
+	ErrNotRunning = errors.New("PandorA is not running")
+)
+
+// Status 起動中のPandorAの状態
+type Status struct {
+	PID int `json:"pid"`
+	// ダウンロード中の場合にtrue
+	Running bool `json:"running"`
+	// オフラインのため自動実行が待機している場合にtrue
+	Queued bool `json:"queued"`
+	// 次の自動実行の時刻 自動実行を行わない場合はゼロ値
+	NextRun time.Time `json:"nextRun"`
+	// 自動実行を一時停止している場合は再開する時刻 停止していない場合はゼロ値
+	PausedUntil time.Time `json:"pausedUntil"`
+	// 最後に行ったダウンロードの記録
+	LastRun state.Run `json:"lastRun"`
+}
+
+// Handler 他のプロセスからの要求を処理する
+type Handler interface {
+	// SyncNow ダウンロードを開始する 終了を待たずに返る
+	// 実行中やクールダウン中のため開始できない場合はその理由を返す
+	SyncNow() error
+	// SyncWait ダウンロードを行い、終了を待って結果を返す 開始できない場合はSyncNowと同じ理由を返す
+	SyncWait() (*resource.SyncReport, error)
+	// Reload 設定を読み込み直す
+	Reload() error
+	// Status 現在の状態を返す
+	Status() Status
+	// Quit 終了する 応答を返せるよう、終了は非同期に行う
+	Quit()
+}
+
+// Empty 引数や結果のないメソッドに用いる
+type Empty struct{}
+
+// SyncResult 終了を待ったダウンロードの結果
+type SyncResult struct {
+	Report *resource.SyncReport `json:"report"`
+	// ダウンロードを開始できなかったか、失敗した場合の理由
+	Error string `json:"error"`
+	// Errorの原因による分類 RPCのエラーは文字列しか伝わらないため、終了コードを決められるよう別に返す
+	Class pandaapi.Class `json:"class"`
+}
+
+// SyncError 起動中のPandorAでダウンロードを開始できなかったか、失敗した場合のエラー
+type SyncError struct {
+	Message string
+	Kind    pandaapi.Class
+}
+
+func (e *SyncError) Error() string {
+	return e.Message
+}
+
+// Class pandaapi.ClassOfで原因による分類を得られるようにする
+func (e *SyncError) Class() pandaapi.Class {
+	return e.Kind
+}
+
+// service RPCで公開するメソッド
+type service struct {
+	h Handler
+}
+
+func (s *service) Sync(_ Empty, _ *Empty) error {
+	return s.h.SyncNow()
+}
+
+func (s *service) SyncWait(_ Empty, reply *SyncResult) error {
+	report, err := s.h.SyncWait()
+	if err != nil {
+		reply.Error = err.Error()
+		reply.Class = pandaapi.ClassOf(err)
+		return nil
+	}
+
+	reply.Report = report
+	return nil
+}
+
+func (s *service) Reload(_ Empty, _ *Empty) error {
+	return s.h.Reload()
+}
+
+func (s *service) Status(_ Empty, reply *Status) error {
+	*reply = s.h.Status()
+	reply.PID = os.Getpid()
+	return nil
+}
+
+func (s *service) Quit(_ Empty, _ *Empty) error {
+	s.h.Quit()
+	return nil
+}
+
+// socketPath ソケットのパスを返す XDG_RUNTIME_DIRがあればそこに、なければ状態のディレクトリに作成する
+func socketPath() string {
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" && !dir.Portable() {
+		return filepath.Join(d, "pandora", socketFile)
+	}
+
+	return dir.StatePath(socketFile)
+}
+
+// Server 他のプロセスからの要求を受け付けるサーバー
+type Server struct {
+	l    net.Listener
+	lock *Lock
+}
+
+// Listen ソケットを作成して要求の受け付けを始める 他のPandorAが起動している場合はErrAlreadyRunningを返す
+func Listen(h Handler) (*Server, error) {
+	return listen(socketPath(), h)
+}
+
+func listen(path string, h Handler) (*Server, error) {
+	// 同時に起動した二つのPandorAが互いのソケットを古いものとして削除しないよう、先にロックを取得する
+	lock, err := acquire(filepath.Join(filepath.Dir(path), lockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := lock.listen(path, h)
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Listen 取得したロックを持ったまま要求の受け付けを始める 作成したServerを閉じるとロックも解放される
+// 多重起動を先に確かめ、初期化を終えてから要求を受け付ける場合に用いる 失敗した場合のロックの解放は呼び出し側で行う
+func (l *Lock) Listen(h Handler) (*Server, error) {
+	return l.listen(socketPath(), h)
+}
+
+func (l *Lock) listen(path string, h Handler) (*Server, error) {
+	// ロックを取得できたので、残っているソケットは異常終了したPandorAのもの
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// 他のユーザーが接続できないようにする
+	os.Chmod(path, 0600)
+
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(serviceName, &service{h: h}); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	s := &Server{l: ln, lock: l}
+	go s.serve(srv)
+
+	return s, nil
+}
+
+func (s *Server) serve(srv *rpc.Server) {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// Close 要求の受け付けを終えてソケットを削除し、ロックを解放する
+func (s *Server) Close() error {
+	err := s.l.Close()
+	if lerr := s.lock.Release(); err == nil {
+		err = lerr
+	}
+
+	return err
+}
+
+// Client 起動中のPandorAに要求を送るクライアント
+type Client struct {
+	c *rpc.Client
+}
+
+// Dial 起動中のPandorAに接続する 起動していない場合はErrNotRunningを返す
+func Dial() (*Client, error) {
+	return dial(socketPath())
+}
+
+func dial(path string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+
+	return &Client{c: jsonrpc.NewClient(conn)}, nil
+}
+
+// Sync ダウンロードを開始させる 開始できない場合はその理由をエラーとして返す
+func (c *Client) Sync() error {
+	return c.c.Call(serviceName+".Sync", Empty{}, &Empty{})
+}
+
+// SyncWait ダウンロードを行わせ、終了を待って結果を返す
+// 開始できなかったか失敗した場合は、原因による分類を持つ*SyncErrorを返す
+func (c *Client) SyncWait() (*resource.SyncReport, error) {
+	var r SyncResult
+	if err := c.c.Call(serviceName+".SyncWait", Empty{}, &r); err != nil {
+		return nil, err
+	}
+	if r.Error != "" {
+		return nil, &SyncError{Message: r.Error, Kind: r.Class}
+	}
+
+	return r.Report, nil
+}
+
+// Reload 設定を読み込み直させる
+func (c *Client) Reload() error {
+	return c.c.Call(serviceName+".Reload", Empty{}, &Empty{})
+}
+
+// Status 起動中のPandorAの状態を返す
+func (c *Client) Status() (Status, error) {
+	var s Status
+	err := c.c.Call(serviceName+".Status", Empty{}, &s)
+	return s, err
+}
+
+// Quit 起動中のPandorAを終了させる
+func (c *Client) Quit() error {
+	return c.c.Call(serviceName+".Quit", Empty{}, &Empty{})
+}
+
+// Close 接続を閉じる
+func (c *Client) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,233 @@
+package ipc
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/resource"
+	"pandora/pkg/state"
+)
+
+// testHandler 受け取った要求を記録するHandler
+type testHandler struct {
+	synced, reloaded, quit int
+	status                 Status
+	// SyncWaitで返す結果
+	report  *resource.SyncReport
+	syncErr error
+}
+
+func (h *testHandler) SyncNow() error {
+	h.synced++
+	return nil
+}
+
+func (h *testHandler) SyncWait() (*resource.SyncReport, error) {
+	h.synced++
+	return h.report, h.syncErr
+}
+
+func (h *testHandler) Reload() error {
+	h.reloaded++
+	return errors.New("invalid config")
+}
+
+func (h *testHandler) Status() Status {
+	return h.status
+}
+
+func (h *testHandler) Quit() {
+	h.quit++
+}
+
+func tempSocket(t *testing.T) string {
+	tmp, err := ioutil.TempDir("", "pandora-ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+
+	return filepath.Join(tmp, socketFile)
+}
+
+func TestServer(t *testing.T) {
+	path := tempSocket(t)
+	next := time.Date(2020, 10, 19, 12, 0, 0, 0, time.UTC)
+	h := &testHandler{status: Status{Running: true, NextRun: next, LastRun: state.Run{Result: state.ResultSuccess, New: 3}}}
+
+	if _, err := dial(path); err != ErrNotRunning {
+		t.Fatalf("dial before listen: %v", err)
+	}
+
+	s, err := listen(path, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 二つ目のインスタンスは起動できない
+	if _, err := listen(path, h); err != ErrAlreadyRunning {
+		t.Fatalf("second listen: %v", err)
+	}
+
+	c, err := dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Sync(); err != nil || h.synced != 1 {
+		t.Errorf("sync: %v, %d", err, h.synced)
+	}
+	h.report = &resource.SyncReport{New: 2, Failed: 1}
+	if report, err := c.SyncWait(); err != nil || report.New != 2 || report.Failed != 1 || h.synced != 2 {
+		t.Errorf("sync wait: %+v, %v, %d", report, err, h.synced)
+	}
+	// 失敗した場合は原因による分類も伝わる
+	h.syncErr = &SyncError{Message: "login failed", Kind: pandaapi.ClassAuth}
+	if _, err := c.SyncWait(); err == nil || err.Error() != "login failed" || pandaapi.ClassOf(err) != pandaapi.ClassAuth {
+		t.Errorf("sync wait error: %v", err)
+	}
+	if err := c.Reload(); err == nil || err.Error() != "invalid config" || h.reloaded != 1 {
+		t.Errorf("reload: %v, %d", err, h.reloaded)
+	}
+	status, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || !status.NextRun.Equal(next) || status.LastRun.New != 3 || status.PID != os.Getpid() {
+		t.Errorf("status: %+v", status)
+	}
+	if err := c.Quit(); err != nil || h.quit != 1 {
+		t.Errorf("quit: %v, %d", err, h.quit)
+	}
+}
+
+// 異常終了したインスタンスのソケットが残っていても起動できる
+func TestStaleSocket(t *testing.T) {
+	path := tempSocket(t)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	s, err := listen(path, &testHandler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket is left after close: %v", err)
+	}
+}
+
+// 同時に起動しても一つだけが待ち受け、他のインスタンスのソケットを削除しない
+func TestConcurrentListen(t *testing.T) {
+	path := tempSocket(t)
+
+	const n = 8
+	servers := make(chan *Server, n)
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			s, err := listen(path, &testHandler{})
+			servers <- s
+			errs <- err
+		}()
+	}
+
+	running := 0
+	for i := 0; i < n; i++ {
+		if s := <-servers; s != nil {
+			defer s.Close()
+			running++
+		}
+		if err := <-errs; err != nil && err != ErrAlreadyRunning {
+			t.Errorf("listen: %v", err)
+		}
+	}
+	if running != 1 {
+		t.Fatalf("%d instances are listening", running)
+	}
+
+	c, err := dial(path)
+	if err != nil {
+		t.Fatalf("the running instance is not reachable: %v", err)
+	}
+	c.Close()
+}
+
+// ロックを持つプロセスがあれば起動せず、ソケットも削除しない
+func TestLock(t *testing.T) {
+	path := tempSocket(t)
+	lockPath := filepath.Join(filepath.Dir(path), lockFile)
+
+	s, err := listen(path, &testHandler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquire(lockPath); err != ErrAlreadyRunning {
+		t.Errorf("acquire while listening: %v", err)
+	}
+	s.Close()
+
+	// コマンドラインでダウンロードしている間
+	lock, err := acquire(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(path, &testHandler{}); err != ErrAlreadyRunning {
+		t.Errorf("listen while locked: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("socket is removed without the lock: %v", err)
+	}
+	lock.Release()
+
+	s, err = listen(path, &testHandler{})
+	if err != nil {
+		t.Fatalf("listen after release: %v", err)
+	}
+	s.Close()
+}
+
+// 先に取得したロックで待ち受けた場合も、閉じるとロックが解放される
+func TestListenWithLock(t *testing.T) {
+	path := tempSocket(t)
+	lockPath := filepath.Join(filepath.Dir(path), lockFile)
+
+	lock, err := acquire(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := lock.listen(path, &testHandler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := dial(path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c.Close()
+
+	s.Close()
+	lock, err = acquire(lockPath)
+	if err != nil {
+		t.Fatalf("acquire after close: %v", err)
+	}
+	lock.Release()
+}
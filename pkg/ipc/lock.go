@@ -0,0 +1,58 @@
+package ipc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// 多重起動を防ぐロックファイルの名前
+	lockFile = "pandora.lock"
+)
+
+// errLocked 他のプロセスがロックを持っている
+var errLocked = errors.New("the lock is held by another process")
+
+// Lock 常駐しているPandorAやコマンドラインのダウンロードが同時に一つだけ行われるようにするロック
+// OSのファイルロックを用いるため、プロセスが異常終了した場合も自動的に解放される
+type Lock struct {
+	f *os.File
+}
+
+// lockPath ロックファイルのパスを返す ソケットと同じディレクトリに作成する
+func lockPath() string {
+	return filepath.Join(filepath.Dir(socketPath()), lockFile)
+}
+
+// Acquire ロックを取得する 他のPandorAが起動しているかダウンロード中の場合はErrAlreadyRunningを返す
+func Acquire() (*Lock, error) {
+	return acquire(lockPath())
+}
+
+func acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tryLock(f); err != nil {
+		f.Close()
+		if err == errLocked {
+			return nil, ErrAlreadyRunning
+		}
+		return nil, err
+	}
+
+	return &Lock{f: f}, nil
+}
+
+// Release ロックを解放する ロックファイルは他のプロセスが待っている可能性があるため削除しない
+func (l *Lock) Release() error {
+	unlock(l.f)
+	return l.f.Close()
+}
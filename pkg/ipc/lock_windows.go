@@ -0,0 +1,21 @@
+package ipc
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// tryLock ファイルの先頭1バイトを排他的にロックする 他のプロセスがロックしている場合は待たずにerrLockedを返す
+func tryLock(f *os.File) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errLocked
+	}
+
+	return err
+}
+
+func unlock(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
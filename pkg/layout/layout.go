@@ -0,0 +1,189 @@
+// Package layout ダウンロードした資料の保存先のパスをテンプレートから決定する
+package layout
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Default 既定のテンプレート 以前のバージョンと同じく授業サイト名のフォルダに資料を保存する
+	Default = "{site_title}/{filename}"
+)
+
+var (
+	// 授業サイト名に含まれる "[2020前期月２]" の部分
+	semesterPattern = regexp.MustCompile(`^\s*[\[［]([^\]］]*)[\]］]\s*`)
+	// "2020前期" から年度と学期を取り出す
+	termPattern = regexp.MustCompile(`(\d{4})\s*(前期|後期|通年|集中)`)
+	// 授業サイトのID "2020-110-7081-000" から科目番号を取り出す
+	courseCodePattern = regexp.MustCompile(`^\d{4}-(.+)-\d+$`)
+)
+
+// Vars テンプレートに埋め込む資料の情報
+type Vars struct {
+	SiteID    string
+	SiteTitle string
+	// 授業サイト内のフォルダ(/区切り) フォルダに入っていない場合は空
+	Folder   string
+	Filename string
+}
+
+// variables テンプレートで使える変数と、その値を返す関数
+var variables = map[string]func(v *Vars) string{
+	// 授業サイトのタイトルから読み取った年度
+	"year": func(v *Vars) string {
+		if m := termPattern.FindStringSubmatch(v.SiteTitle); m != nil {
+			return m[1]
+		}
+		return ""
+	},
+	// 授業サイトのタイトルから読み取った学期 (前期, 後期など)
+	"term": func(v *Vars) string {
+		if m := termPattern.FindStringSubmatch(v.SiteTitle); m != nil {
+			return m[2]
+		}
+		return ""
+	},
+	// 授業サイトのIDから年度などを除いた科目番号
+	"course_code": func(v *Vars) string {
+		if m := courseCodePattern.FindStringSubmatch(v.SiteID); m != nil {
+			return m[1]
+		}
+		return v.SiteID
+	},
+	// 授業サイトのタイトルから "[2020前期月２]" を除いたもの
+	"course_title": func(v *Vars) string {
+		return strings.TrimSpace(semesterPattern.ReplaceAllString(v.SiteTitle, ""))
+	},
+	"site_title": func(v *Vars) string { return v.SiteTitle },
+	"site_id":    func(v *Vars) string { return v.SiteID },
+	"folder":     func(v *Vars) string { return v.Folder },
+	"filename":   func(v *Vars) string { return v.Filename },
+}
+
+// Variables テンプレートで使える変数の名前を返す
+func Variables() []string {
+	return []string{"year", "term", "course_code", "course_title", "site_title", "site_id", "folder", "filename"}
+}
+
+// Error テンプレートが不正な場合のエラー
+type Error struct {
+	Template string
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid path template %q: %s", e.Template, e.Message)
+}
+
+// Template 保存先のパスのテンプレート
+// "/"で区切られた各部分に {変数名} を埋め込む ({folder}は単独で一つの部分として書く)
+type Template struct {
+	text       string
+	components []string
+}
+
+// Parse テンプレートを解析する
+func Parse(text string) (*Template, error) {
+	fail := func(format string, a ...interface{}) (*Template, error) {
+		return nil, &Error{Template: text, Message: fmt.Sprintf(format, a...)}
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return fail("must not be empty")
+	}
+	if strings.HasPrefix(text, "/") || strings.Contains(text, "\\") {
+		return fail("must be a relative path separated by /")
+	}
+
+	components := strings.Split(text, "/")
+	for i, c := range components {
+		if c == "" || c == "." || c == ".." {
+			return fail("contains an empty, . or .. component")
+		}
+
+		rest := c
+		for {
+			start := strings.Index(rest, "{")
+			end := strings.Index(rest, "}")
+			if start < 0 && end < 0 {
+				break
+			}
+			if start < 0 || end < start {
+				return fail("unbalanced braces in %q", c)
+			}
+
+			name := rest[start+1 : end]
+			if _, ok := variables[name]; !ok {
+				return fail("unknown variable {%s} (available: %s)", name, strings.Join(Variables(), ", "))
+			}
+			if name == "folder" && c != "{folder}" {
+				return fail("{folder} must be a component by itself")
+			}
+			if name == "filename" && i != len(components)-1 {
+				return fail("{filename} must be in the last component")
+			}
+
+			rest = rest[end+1:]
+		}
+	}
+
+	if !strings.Contains(components[len(components)-1], "{filename}") {
+		return fail("the last component must contain {filename}")
+	}
+
+	return &Template{text: text, components: components}, nil
+}
+
+// MustParse Parseに失敗した場合はpanicする
+func MustParse(text string) *Template {
+	t, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *Template) String() string {
+	return t.text
+}
+
+// Render 資料の保存先の相対パス(/区切り)を返す 各部分はファイル名として使えるよう無害化される
+// 値が空になった部分は取り除く
+func (t *Template) Render(v Vars) string {
+	parts := make([]string, 0, len(t.components))
+
+	for _, c := range t.components {
+		if c == "{folder}" {
+			for _, f := range strings.Split(v.Folder, "/") {
+				if f = Sanitize(f); f != "" {
+					parts = append(parts, f)
+				}
+			}
+			continue
+		}
+
+		var b strings.Builder
+		rest := c
+		for {
+			start := strings.Index(rest, "{")
+			if start < 0 {
+				b.WriteString(rest)
+				break
+			}
+			end := strings.Index(rest, "}")
+			b.WriteString(rest[:start])
+			b.WriteString(variables[rest[start+1:end]](&v))
+			rest = rest[end+1:]
+		}
+
+		if s := Sanitize(b.String()); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	return path.Join(parts...)
+}
@@ -0,0 +1,57 @@
+package layout_test
+
+import (
+	"testing"
+
+	"pandora/pkg/layout"
+)
+
+func TestRender(t *testing.T) {
+	v := layout.Vars{
+		SiteID:    "2020-110-7081-000",
+		SiteTitle: "[2020前期月２]線形代数学",
+		Folder:    "第1回/演習",
+		Filename:  "slides.pdf",
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{layout.Default, "[2020前期月２]線形代数学/slides.pdf"},
+		{"{year}/{term}/{course_code} {course_title}/{folder}/{filename}", "2020/前期/110-7081 線形代数学/第1回/演習/slides.pdf"},
+		{"{site_id}/{filename}", "2020-110-7081-000/slides.pdf"},
+		{"{course_title}/{folder}/{filename}", "線形代数学/第1回/演習/slides.pdf"},
+	}
+
+	for _, tt := range tests {
+		if got := layout.MustParse(tt.template).Render(v); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.template, got, tt.want)
+		}
+	}
+
+	// 値が空になった部分は取り除かれる
+	v = layout.Vars{SiteID: "site1", SiteTitle: "ゼミ: 輪講?", Filename: "a.pdf"}
+	if got := layout.MustParse("{year}/{course_title}/{folder}/{filename}").Render(v); got != "ゼミ_ 輪講_/a.pdf" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"/abs/{filename}",
+		"{site_title}\\{filename}",
+		"{site_title}//{filename}",
+		"../{filename}",
+		"{site_title}/{filename",
+		"{semester}/{filename}",
+		"{site_title}-{folder}/{filename}",
+		"{filename}/{site_title}",
+		"{site_title}",
+	} {
+		if _, err := layout.Parse(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
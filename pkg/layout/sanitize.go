@@ -0,0 +1,99 @@
+package layout
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// 一つのパスの部分の最大のバイト数
+	// 多くのファイルシステムの上限は255バイトだが、重なった場合に付ける " (n)" の分を空けておく
+	maxComponentBytes = 240
+	// 値が全て取り除かれた場合に代わりに用いる名前
+	placeholder = "_"
+)
+
+// 一つのパスの部分に使えない文字
+var unsafeChars = strings.NewReplacer(
+	"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_",
+)
+
+// Windowsで予約されているデバイス名 拡張子がついていても使えない
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize パスの一つの部分をどのOSでもファイル名として使える形にする
+// 文字列はNFCに正規化し、使えない文字は _ に置き換える 全角文字(／や：など)はそのまま使える
+// 元の名前は資料の記録に残るため、保存先から元の資料をたどることができる
+func Sanitize(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	// macOSではNFDで渡されることがあるため、どのOSでも同じ名前になるようNFCに揃える
+	s := norm.NFC.String(name)
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, s)
+	s = unsafeChars.Replace(s)
+
+	// Windowsでは末尾の空白と.が取り除かれてしまう
+	s = strings.TrimRight(strings.TrimSpace(s), ". ")
+	s = escapeReserved(s)
+	s = truncate(s, maxComponentBytes)
+
+	if s == "" {
+		return placeholder
+	}
+	return s
+}
+
+// escapeReserved Windowsの予約名 (CON, COM1.txt など) の場合は名前の後ろに _ をつける
+func escapeReserved(name string) string {
+	base := name
+	ext := ""
+	if i := strings.Index(name, "."); i >= 0 {
+		base, ext = name[:i], name[i:]
+	}
+
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		return base + placeholder + ext
+	}
+	return name
+}
+
+// truncate 拡張子を残したまま、名前をmaxバイト以下に切り詰める
+func truncate(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i <= 16 {
+		ext = name[i:]
+	}
+	base := name[:len(name)-len(ext)]
+
+	// 濁点などの結合文字を切り離さないよう、文字の区切りごとに詰めていく
+	limit := max - len(ext)
+	kept := make([]byte, 0, limit)
+	var it norm.Iter
+	it.InitString(norm.NFC, base)
+	for !it.Done() {
+		seg := it.Next()
+		if len(kept)+len(seg) > limit {
+			break
+		}
+		kept = append(kept, seg...)
+	}
+
+	return strings.TrimRight(string(kept), ". ") + ext
+}
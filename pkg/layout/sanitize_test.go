@@ -0,0 +1,82 @@
+package layout_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"pandora/pkg/layout"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"plain", "slides.pdf", "slides.pdf"},
+		{"reserved chars", `a/b\c:d*e?f"g<h>i|j.pdf`, "a_b_c_d_e_f_g_h_i_j.pdf"},
+		{"control chars", "a\tb\x00c\x7f.pdf", "abc.pdf"},
+		{"trailing dots and spaces", "第1回資料. . ", "第1回資料"},
+		{"leading and trailing spaces", "  report.pdf  ", "report.pdf"},
+		{"only dots", "..", "_"},
+		{"only reserved chars", "???", "___"},
+		{"windows device name", "CON", "CON_"},
+		{"windows device name with extension", "com1.txt", "com1_.txt"},
+		{"not a device name", "CONSOLE.txt", "CONSOLE.txt"},
+		{"full-width slash and colon", "第１回／導入：概要？.pdf", "第１回／導入：概要？.pdf"},
+		{"full-width brackets", "［2020前期月２］線形代数学", "［2020前期月２］線形代数学"},
+		{"full-width space", "線形代数学　", "線形代数学"},
+		{"half-width katakana", "ﾚﾎﾟｰﾄ課題.docx", "ﾚﾎﾟｰﾄ課題.docx"},
+		{"NFD dakuten", "\u30ab\u3099イ\u30bf\u3099ンス.pdf", "ガイダンス.pdf"},
+		{"NFD latin", "Cafe\u0301.pdf", "Café.pdf"},
+		{"mixed ascii reserved in japanese", "課題1: 提出方法 <重要>.pdf", "課題1_ 提出方法 _重要_.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := layout.Sanitize(tt.in)
+			if got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			// 一度無害化したものは変化しない
+			if again := layout.Sanitize(got); again != got {
+				t.Errorf("Sanitize is not idempotent: %q -> %q", got, again)
+			}
+		})
+	}
+}
+
+func TestSanitizeLongName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ext  string
+	}{
+		{"japanese", strings.Repeat("線形代数学", 40) + ".pdf", ".pdf"},
+		{"NFD japanese", strings.Repeat("\u30ab\u3099", 200) + ".pptx", ".pptx"},
+		{"ascii", strings.Repeat("a", 300), ""},
+		{"long extension", strings.Repeat("b", 300) + "." + strings.Repeat("c", 30), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := layout.Sanitize(tt.in)
+			if len(got) > 240 {
+				t.Errorf("too long: %d bytes", len(got))
+			}
+			if !utf8.ValidString(got) || !norm.NFC.IsNormalString(got) {
+				t.Errorf("broken name: %q", got)
+			}
+			if !strings.HasSuffix(got, tt.ext) {
+				t.Errorf("extension is lost: %q", got)
+			}
+			if !strings.HasPrefix(norm.NFC.String(tt.in), strings.TrimSuffix(got, tt.ext)) {
+				t.Errorf("not a prefix of the original name: %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Package netwatch ネットワークの接続状態の変化を監視し、接続されるまで待つ
+package netwatch
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	// watchRoutes OSの通知を用いて経路の変化を監視する関数 使えない環境ではnil
+	watchRoutes func(ctx context.Context) <-chan struct{}
+
+	// 経路が変化してから接続状態を調べるまでの時間 アドレスの取得などが終わるのを待つ テストで差し替える
+	settleDelay = 3 * time.Second
+)
+
+// Changes ネットワークの経路やアドレスが変化したことを通知するチャネルを返す ctxが終了すると監視を終える
+// Linuxではnetlinkを用いる それ以外の環境や監視を始められない場合はnilを返す
+func Changes(ctx context.Context) <-chan struct{} {
+	if watchRoutes == nil {
+		return nil
+	}
+
+	return watchRoutes(ctx)
+}
+
+// WaitOnline checkがtrueを返すまで、changesから通知を受けた時とpollの間隔ごとに調べ直す
+// changesがnilの場合はポーリングのみを行う ctxが終了した場合はそのエラーを返す
+func WaitOnline(ctx context.Context, check func(context.Context) bool, changes <-chan struct{}, poll time.Duration) error {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-changes:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(settleDelay):
+			}
+		}
+
+		if check(ctx) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package netwatch
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 監視するnetlinkのグループ リンクの状態、アドレス、経路の変化
+const routeGroups = unix.RTMGRP_LINK |
+	unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR |
+	unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE
+
+func init() {
+	watchRoutes = watchNetlink
+}
+
+// watchNetlink netlinkのソケットで経路の変化を受け取る ソケットを作成できない場合はnilを返す
+func watchNetlink(ctx context.Context) <-chan struct{} {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: routeGroups}); err != nil {
+		unix.Close(fd)
+		return nil
+	}
+
+	// ctxの終了を確かめられるよう、読み込みにタイムアウトを設定する
+	tv := unix.NsecToTimeval(int64(time.Second))
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return nil
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer unix.Close(fd)
+
+		buf := make([]byte, unix.Getpagesize())
+		for ctx.Err() == nil {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+
+			// 続けて届いた通知は一つにまとめる
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes
+}
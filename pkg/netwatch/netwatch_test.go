@@ -0,0 +1,67 @@
+package netwatch
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitOnline(t *testing.T) {
+	settleDelay = time.Millisecond
+	defer func() { settleDelay = 3 * time.Second }()
+
+	// 経路の変化を通知されたら調べ直す
+	var checks int32
+	changes := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- WaitOnline(context.Background(), func(context.Context) bool {
+			return atomic.AddInt32(&checks, 1) >= 2
+		}, changes, time.Hour)
+	}()
+
+	changes <- struct{}{}
+	changes <- struct{}{}
+	select {
+	case err := <-done:
+		if err != nil || atomic.LoadInt32(&checks) != 2 {
+			t.Errorf("err: %v, checks: %d", err, checks)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitOnline did not return after the network changed")
+	}
+
+	// 通知がない場合はポーリングで調べ直す
+	var polled int32
+	err := WaitOnline(context.Background(), func(context.Context) bool {
+		return atomic.AddInt32(&polled, 1) >= 3
+	}, nil, time.Millisecond)
+	if err != nil || polled != 3 {
+		t.Errorf("err: %v, polled: %d", err, polled)
+	}
+
+	// 接続されないまま終了した場合
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitOnline(ctx, func(context.Context) bool { return false }, nil, time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("err: %v", err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	saved := watchRoutes
+	defer func() { watchRoutes = saved }()
+
+	// 経路の変化を監視できない環境ではnilを返し、ポーリングのみを行う
+	watchRoutes = nil
+	if Changes(context.Background()) != nil {
+		t.Error("changes without a watcher")
+	}
+
+	ch := make(chan struct{})
+	watchRoutes = func(context.Context) <-chan struct{} { return ch }
+	if Changes(context.Background()) == nil {
+		t.Error("watcher is not used")
+	}
+}
@@ -1,16 +1,16 @@
 package pandaapi
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
+	"pandora/pkg/secret"
 	"strings"
-
-	"github.com/PuerkitoBio/goquery"
-	"golang.org/x/net/publicsuffix"
+	"sync"
 )
 
 const (
@@ -22,22 +22,36 @@ const (
 	pandaAllSites = pandaDomain + "/direct/site.json"
 	// URL for Resources Infomation
 	pandaResourcesInfo = pandaDomain + "/direct/content/site/" // {SITEID}.json を追記する
+	// URL for the portal page of a site
+	pandaPortalSite = pandaDomain + "/portal/site/" // {SITEID} を追記する
+	// URL for assignments of all sites
+	pandaAssignments = pandaDomain + "/direct/assignment/my.json"
 	// URL for getting resource
 	pandaResource = pandaDomain + "/access" // {SITEID}/{フォルダ名(あれば)}/{資料名} を追記する
 	// URL for Resource Acception
 	pandaAcception = pandaDomain + "/access/accept?"
-	// Error message appears when failed to log in
-	loginErrorMessage = "あなたが入力した認証情報は，認証可能なものであることが確認できませんでした．"
 )
 
-var (
-	// URL for Kyoto University's CAS Login System
-	casURL = "https://cas.ecs.kyoto-u.ac.jp/cas/login?service=" + url.QueryEscape(pandaLogin)
+const (
+	// Host and Protocol for Kyoto University's CAS Login System
+	casHost   = "cas.ecs.kyoto-u.ac.jp"
+	casDomain = "https://" + casHost
 )
 
-// LoggedInClient PandAにログイン済みのクライアントを表す
+// LoggedInClient PandAにログイン済みのクライアントを表す 複数のゴルーチンから同時に用いてよい
 type LoggedInClient struct {
 	c *http.Client
+	// セッションが切れた場合にログインし直す関数
+	login func() error
+
+	mu sync.Mutex
+	// ログインし直した回数
+	generation int
+}
+
+// SiteURL 授業サイトをブラウザで開くURLを返す
+func SiteURL(siteID string) string {
+	return pandaPortalSite + url.PathEscape(siteID)
 }
 
 // CheckPandaStatus PandAサーバが生きているかどうかを判定する
@@ -50,7 +64,7 @@ func CheckPandaStatus() error {
 
 	resp, err := c.Head(pandaDomain)
 	if err != nil {
-		return &NetworkError{err: err}
+		return &NetworkError{URL: pandaDomain, Err: err}
 	}
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
@@ -58,190 +72,194 @@ func CheckPandaStatus() error {
 	}()
 
 	if resp.StatusCode != 200 {
-		return &DeadPandAError{code: resp.StatusCode, err: nil, url: pandaDomain}
+		return &StatusError{StatusCode: resp.StatusCode, URL: pandaDomain}
 	}
 
 	return nil
 }
 
 // FetchAllSites 全ての授業サイトの情報を取得するAPI レスポンスボディをクローズする必要がある
-func (lic *LoggedInClient) FetchAllSites() (resp *http.Response, err error) {
-	resp, err = lic.c.Get(pandaAllSites)
-	// 200以外のレスポンスが帰ってくる場合はサーバーが死んでいるとみなす
-	if resp.StatusCode != 200 {
-		return resp, &DeadPandAError{code: resp.StatusCode, err: err, url: pandaAllSites}
+// エラーの場合はレスポンスを返さない
+func (lic *LoggedInClient) FetchAllSites() (*http.Response, error) {
+	return lic.fetchOK(context.Background(), pandaAllSites)
+}
+
+// FetchSiteResources 授業サイトに登録されているリソースの情報を取得するAPI レスポンスボディをクローズする必要がある
+// エラーの場合はレスポンスを返さない
+func (lic *LoggedInClient) FetchSiteResources(siteID string) (*http.Response, error) {
+	resp, err := lic.fetchOK(context.Background(), pandaResourcesInfo+siteID+".json")
+	if err != nil {
+		return nil, withSite(err, siteID)
 	}
 
-	return
+	return resp, nil
 }
 
-// FetchSiteResources 授業サイトに登録されているリソースの情報を取得するAPI レスポンスボディをクローズする必要がある
-func (lic *LoggedInClient) FetchSiteResources(siteID string) (resp *http.Response, err error) {
-	siteURL := pandaResourcesInfo + siteID + ".json"
+// fetchOK uriを取得する 通信に失敗した場合や200以外のレスポンスの場合はボディをクローズしてエラーを返す
+func (lic *LoggedInClient) fetchOK(ctx context.Context, uri string) (*http.Response, error) {
+	resp, err := lic.get(ctx, uri)
+	if err != nil {
+		return nil, wrapNetworkError(err, uri)
+	}
 
-	resp, err = lic.c.Get(siteURL)
-	// 200以外のレスポンスが帰ってくる場合はサーバーが死んでいるとみなす
 	if resp.StatusCode != 200 {
-		return resp, &DeadPandAError{code: resp.StatusCode, err: err, url: siteURL}
+		discard(resp)
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: uri}
 	}
 
-	return
+	return resp, nil
+}
+
+// discard レスポンスボディを読み捨ててクローズする
+func discard(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
 }
 
 // FetchResource リソースを取得するAPI レスポンスボディをクローズする必要がある
-func (lic *LoggedInClient) FetchResource(uri string) (resp *http.Response, err error) {
-	resp, err = lic.c.Get(uri)
+// エラーの場合はレスポンスを返さない
+func (lic *LoggedInClient) FetchResource(uri string) (*http.Response, error) {
+	return lic.fetchResource(context.Background(), uri)
+}
+
+func (lic *LoggedInClient) fetchResource(ctx context.Context, uri string) (*http.Response, error) {
+	resp, err := lic.get(ctx, uri)
 	if err != nil {
-		return resp, &NetworkError{err: err}
+		return nil, wrapNetworkError(err, uri)
 	}
 
 	// 通常のダウンロードに成功した場合
 	if resp.StatusCode == 200 {
-		return
+		return resp, nil
 	}
+	discard(resp)
 
 	// 著作権制限付きダウンロード警告がでる場合
 	if resp.StatusCode == 302 {
+
 		// /{SITEID}/{フォルダパス}/{資料名}の部分を取得
 		path := strings.Replace(uri, pandaResource, "", 1)
 		// 資料のダウンロードの許可をくれるパスへクエリを投げる
 		query := "ref=" + path + "&url=" + path
-		r, e := lic.c.Get(pandaAcception + query)
-		if e != nil {
-			return resp, &NetworkError{err: e}
-		}
-		defer func() {
-			io.Copy(ioutil.Discard, r.Body)
-			r.Body.Close()
-		}()
-
-		resp, err = lic.c.Get(uri)
+		r, err := lic.get(ctx, pandaAcception+query)
 		if err != nil {
-			return resp, &NetworkError{err: err}
-		}
-		if resp.StatusCode != 200 {
-			return resp, &DeadPandAError{code: resp.StatusCode, err: err, url: uri}
+			return nil, wrapNetworkError(err, pandaAcception)
 		}
-		return
+		discard(r)
+
+		return lic.fetchOK(ctx, uri)
 	}
 
-	// 200と302以外のレスポンスを返す場合はサーバーが死んでいるとみなす
-	return resp, &DeadPandAError{code: resp.StatusCode, err: err, url: uri}
+	// 200と302以外のレスポンスはステータスコードに応じて分類したエラーにする
+	return nil, &StatusError{StatusCode: resp.StatusCode, URL: uri}
 }
 
-// NewLoggedInClient ログイン済みのクライアントを返す関数
-func NewLoggedInClient(ecsID, password string) (lic *LoggedInClient, err error) {
-	// Cookieを保存する
-	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
-	client := &http.Client{Jar: jar}
-
-	// まずPandAの生存確認を行う
-	// この関数内ではここで生存が確認された場合にはログイン中はPandAが死んでいないものと推定する
-	if err := CheckPandaStatus(); err != nil {
-		return &LoggedInClient{c: client}, err
+// Sites 過去のものも含めて全ての授業サイトの情報を取得する
+func (lic *LoggedInClient) Sites(ctx context.Context) ([]Site, error) {
+	// APIの返すJSONと形を合わせるための構造体
+	var w struct {
+		Sites []Site `json:"site_collection"`
 	}
-
-	// pandaURLにGETを行うと、ログインページにリダイレクトされる
-	// この際Pandaのドメインに対しJESESSIONIDが紐付けられる
-	loginPage, err := client.Get(pandaLogin)
-	if err != nil {
-		return &LoggedInClient{c: client}, &NetworkError{err: err}
+	if err := lic.getJSON(ctx, pandaAllSites, &w); err != nil {
+		return nil, err
 	}
-	defer loginPage.Body.Close()
 
-	// ログインページからLT(おそらくログインチケットの略)を取得
-	lt, err := getLT(loginPage)
-	if err != nil {
-		return &LoggedInClient{c: client}, err
-	}
+	return w.Sites, nil
+}
 
-	// ログイン
-	client, err = login(client, lt, ecsID, password)
-	if err != nil {
-		return &LoggedInClient{c: client}, err
+// Resources 授業サイトに登録されている資料の情報を取得する フォルダやURLへのリンクも含む
+func (lic *LoggedInClient) Resources(ctx context.Context, siteID string) ([]Resource, error) {
+	// APIの返すJSONと形を合わせるための構造体
+	var w struct {
+		Collection []Resource `json:"content_collection"`
+	}
+	if err := lic.getJSON(ctx, pandaResourcesInfo+url.PathEscape(siteID)+".json", &w); err != nil {
+		return nil, withSite(err, siteID)
 	}
 
-	//　リダイレクトを無効にする
-	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
+	for i := range w.Collection {
+		w.Collection[i].SiteID = siteID
 	}
 
-	return &LoggedInClient{c: client}, nil
+	return w.Collection, nil
 }
 
-// 京大のCASシステムにログイン情報をPOSTする関数
-func login(client *http.Client, lt, ecsID, password string) (loggedInClient *http.Client, err error) {
-	values := url.Values{
-		"_eventId":  {"submit"},
-		"execution": {"e1s1"},
-		"lt":        {lt},
-		"username":  {ecsID},
-		"password":  {password},
-		"submit":    {"ログイン"},
+// Assignments 全ての授業サイトの課題の情報を取得する
+func (lic *LoggedInClient) Assignments(ctx context.Context) ([]Assignment, error) {
+	// APIの返すJSONと形を合わせるための構造体
+	var w struct {
+		Assignments []Assignment `json:"assignment_collection"`
+	}
+	if err := lic.getJSON(ctx, pandaAssignments, &w); err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", casURL, strings.NewReader(values.Encode()))
+	return w.Assignments, nil
+}
+
+// Open 資料をダウンロードするレスポンスボディを返す 読み終えたらクローズする必要がある
+// 著作権についての確認が必要な資料は確認を済ませてからダウンロードする
+func (lic *LoggedInClient) Open(ctx context.Context, res Resource) (io.ReadCloser, Meta, error) {
+	resp, err := lic.fetchResource(ctx, res.URL)
 	if err != nil {
-		return client, err
+		return nil, Meta{}, withSite(err, res.SiteID)
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	// ログインフォームに必要なデータを送信すると、PandAのポータルサイトにリダイレクトする
-	// この際、クエリパラメータとして発行されるticketを用いて、JSESSIONIDを認証済みにする処理がサーバー側で行われる
-	resp, err := client.Do(req)
+	return resp.Body, newMeta(resp), nil
+}
+
+// getJSON uriから取得したJSONをvに読み込む
+func (lic *LoggedInClient) getJSON(ctx context.Context, uri string, v interface{}) error {
+	resp, err := lic.get(ctx, uri)
 	if err != nil {
-		return client, &NetworkError{err: err}
+		return wrapNetworkError(err, uri)
 	}
-	defer resp.Body.Close()
+	defer discard(resp)
 
-	// ログインに成功したかどうかを確認する
-	auth, err := isAuthorized(resp)
-	if err != nil {
-		return client, err
+	if resp.StatusCode != 200 {
+		return &StatusError{StatusCode: resp.StatusCode, URL: uri}
 	}
-	if !auth {
-		return client, &FailedLoginError{EscID: ecsID, Password: password}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &ParseError{URL: uri, Err: err}
 	}
 
-	return client, nil
+	return nil
 }
 
-// LTをログインページから取り出す関数
-func getLT(resp *http.Response) (lt string, err error) {
-	doc, err := goquery.NewDocumentFromResponse(resp)
-	if err != nil {
-		return "", err
+// newMeta レスポンスヘッダから資料の情報を取り出す
+func newMeta(resp *http.Response) Meta {
+	m := Meta{
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
 	}
-
-	// LTが書かれたタグを取得する
-	ltTag := doc.Find("input[name=\"lt\"]")
-	// LTを取得
-	lt, exist := ltTag.Attr("value")
-	if !exist {
-		err = errors.New("LT is not found")
+	if resp.Request != nil {
+		m.URL = resp.Request.URL.String()
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		m.Modified = t
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		m.Filename = params["filename"]
 	}
-	return
+
+	return m
 }
 
-// ログインに成功していかどうかを判定する関数
-func isAuthorized(resp *http.Response) (bool, error) {
-	doc, err := goquery.NewDocumentFromResponse(resp)
-	if err != nil {
-		return false, err
-	}
+// NewLoggedInClient ECS-IDとパスワードでCASにログインしたクライアントを返す関数
+// パスワードはエラーメッセージやログから伏せ字にされるよう登録される
+func NewLoggedInClient(ecsID string, password secret.String) (lic *LoggedInClient, err error) {
+	secret.Register(password.Reveal())
 
-	// ログインに失敗したときのメッセージが書かれたタグを取得する
-	msg := doc.Find("#msg")
-	if msg.Length() == 0 {
-		// ログインに成功した場合
-		return true, nil
-	}
+	return NewClient(&CASForm{ECSID: ecsID, Password: password})
+}
 
-	if msg.Text() == loginErrorMessage {
-		// ログインに失敗した場合
-		return false, nil
+// newClient jarにCookieを保存するクライアントを返す リダイレクトは無効にする
+func newClient(jar http.CookieJar) *http.Client {
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
-
-	// 想定外の動作
-	return false, errors.New("There's something wrong with the login system")
 }
@@ -0,0 +1,145 @@
+package pandaapi
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"pandora/pkg/secret"
+)
+
+// Authenticator PandAのセッションを認証済みにするログイン方法
+type Authenticator interface {
+	// Authenticate clientのCookieに保存されたセッションをepで認証済みにする
+	// clientはリダイレクトを無効にしたもので、必要なリダイレクトは実装の中で追跡する
+	Authenticate(client *http.Client, ep Endpoint) error
+}
+
+// Endpoint ログインするサービスのURL
+type Endpoint struct {
+	// ログインを開始するページ
+	LoginURL string
+	// ログイン状態を確認するAPI 認証済みの場合はuserEidを含むJSONを返す
+	SessionURL string
+}
+
+// pandaEndpoint PandAのログインに用いるURL
+var pandaEndpoint = Endpoint{LoginURL: pandaLogin, SessionURL: pandaSession}
+
+// sessionOwner ログイン状態を保存できるAuthenticator 利用者ごとの鍵で暗号化して保存する
+type sessionOwner interface {
+	sessionOwner() (ecsID string, key []byte)
+}
+
+// CASForm ECS-IDとパスワードでCASにログインする
+type CASForm struct {
+	ECSID    string
+	Password secret.String
+}
+
+// Authenticate CASのログインフォームに認証情報を送信する
+func (c *CASForm) Authenticate(client *http.Client, ep Endpoint) error {
+	return casLogin(client, ep, c.ECSID, c.Password, nil)
+}
+
+func (c *CASForm) sessionOwner() (string, []byte) {
+	return c.ECSID, sessionKey(c.ECSID, c.Password)
+}
+
+// CASTOTP ECS-IDとパスワードに加え、認証アプリと同じワンタイムパスワードでCASにログインする
+type CASTOTP struct {
+	ECSID    string
+	Password secret.String
+	// 認証アプリに登録したBase32の秘密鍵
+	Secret secret.String
+}
+
+// Authenticate CASのログインフォームに認証情報を送信し、求められればワンタイムパスワードを送信する
+func (c *CASTOTP) Authenticate(client *http.Client, ep Endpoint) error {
+	return casLogin(client, ep, c.ECSID, c.Password, func() (string, error) {
+		return totp(c.Secret.Reveal(), now())
+	})
+}
+
+func (c *CASTOTP) sessionOwner() (string, []byte) {
+	return c.ECSID, sessionKey(c.ECSID, c.Password)
+}
+
+// SAMLPost Shibbolethなど、SAMLのHTTP POST BindingでIdPにログインする
+type SAMLPost struct {
+	ECSID    string
+	Password secret.String
+	// ログインを開始するSPのURL 空の場合はEndpointのLoginURLを用いる
+	LoginURL string
+}
+
+// Authenticate IdPのログインフォームに認証情報を送信し、発行されたSAMLResponseをSPへ送信する
+func (s *SAMLPost) Authenticate(client *http.Client, ep Endpoint) error {
+	if s.LoginURL != "" {
+		ep.LoginURL = s.LoginURL
+	}
+
+	return samlLogin(client, ep, s.ECSID, s.Password)
+}
+
+func (s *SAMLPost) sessionOwner() (string, []byte) {
+	return s.ECSID, sessionKey(s.ECSID, s.Password)
+}
+
+// CookieFile ブラウザから書き出したNetscape形式(cookies.txt)のCookieを読み込む
+// ファイル自体がログイン状態を保持しているため、ログイン状態は別に保存しない
+type CookieFile struct {
+	Path string
+}
+
+// Authenticate ファイルのCookieを読み込み、セッションが認証済みであることを確認する
+func (c *CookieFile) Authenticate(client *http.Client, ep Endpoint) error {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := importCookies(client.Jar, f, now()); err != nil {
+		return err
+	}
+	if !isLoggedIn(client, ep.SessionURL) {
+		return &ExpiredCookieError{Path: c.Path}
+	}
+
+	return nil
+}
+
+// NewClient authでログインしたクライアントを返す
+// authがログイン状態を保存できるものであれば、前回のログイン状態が有効な場合はそれを用い、なければログインして状態を保存する
+func NewClient(auth Authenticator) (lic *LoggedInClient, err error) {
+	// Cookieを保存する
+	jar := newJar()
+	lic = &LoggedInClient{c: newClient(jar)}
+
+	owner, persistent := auth.(sessionOwner)
+	lic.login = func() error {
+		if err := auth.Authenticate(lic.c, pandaEndpoint); err != nil {
+			return err
+		}
+		if persistent {
+			if err := saveSession(jar, owner); err != nil {
+				log.Println("cannot save the session:", err)
+			}
+		}
+		return nil
+	}
+
+	// まずPandAの生存確認を行う
+	// この関数内ではここで生存が確認された場合にはログイン中はPandAが死んでいないものと推定する
+	if err := CheckPandaStatus(); err != nil {
+		return lic, err
+	}
+
+	// 前回のセッションがまだ有効であればログインを省く
+	if persistent && loadSession(jar, owner) && isLoggedIn(lic.c, pandaSession) {
+		return lic, nil
+	}
+
+	return lic, lic.login()
+}
@@ -0,0 +1,224 @@
+package pandaapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTime テストの間だけ現在時刻をtにする
+func useTime(t *testing.T, at time.Time) {
+	old := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = old })
+}
+
+// RFC 6238 Appendix B のテストベクタ(下6桁)
+func TestTOTP(t *testing.T) {
+	// "12345678901234567890" をBase32で表したもの
+	secret := "gezd gnbv gy3t qojq gezd gnbv gy3t qojq"
+
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := totp(secret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Errorf("%d: got %s (%v), want %s", unix, got, err, want)
+		}
+	}
+
+	if _, err := totp("not base32!", time.Now()); err == nil {
+		t.Error("invalid secret is accepted")
+	}
+}
+
+func TestCASTOTP(t *testing.T) {
+	useTime(t, time.Unix(1603000000, 0))
+	const key = "JBSWY3DPEHPK3PXP"
+
+	cas := &fakeCAS{
+		page:      readFixture(t, "login.html"),
+		failure:   readFixture(t, "failed.html"),
+		otpPage:   readFixture(t, "otp.html"),
+		otpSecret: key,
+	}
+	server := httptest.NewServer(cas)
+	defer server.Close()
+
+	auth := &CASTOTP{ECSID: "a0123456", Password: "correct", Secret: key}
+	if err := auth.Authenticate(newClient(newJar()), testEndpoint(server)); err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := totp(key, now()); cas.posted.Get("token") != want || cas.posted.Get("submit") != "確認" {
+		t.Errorf("posted: %v", cas.posted)
+	}
+
+	// 秘密鍵が誤っている場合
+	wrong := &CASTOTP{ECSID: "a0123456", Password: "correct", Secret: "GEZDGNBVGY3TQOJQ"}
+	if err := wrong.Authenticate(newClient(newJar()), testEndpoint(server)); fmt.Sprintf("%T", err) != "*pandaapi.FailedLoginError" {
+		t.Errorf("wrong code: %v", err)
+	}
+
+	// パスワードのみのログインでは二段階認証を通過できない
+	form := &CASForm{ECSID: "a0123456", Password: "correct"}
+	if err := form.Authenticate(newClient(newJar()), testEndpoint(server)); fmt.Sprintf("%T", err) != "*pandaapi.SecondFactorRequiredError" {
+		t.Errorf("without a secret: %v", err)
+	}
+}
+
+// fakeSAML ShibbolethのSPとIdPを再現するサーバー
+type fakeSAML struct {
+	t *testing.T
+	// 送信されたSAMLResponse
+	response string
+}
+
+func (f *fakeSAML) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/Shibboleth.sso/Login":
+		http.Redirect(w, r, "/idp/profile/SAML2/Redirect/SSO?SAMLRequest=fZJBT8MwDIXv&RelayState=ss%3Amem%3A5d3c1f0a", http.StatusFound)
+
+	case "/idp/profile/SAML2/Redirect/SSO":
+		if _, err := r.Cookie("shib_idp_session"); err == nil {
+			fmt.Fprint(w, readSAMLFixture(f.t, "response.html"))
+			return
+		}
+		if r.Method == "GET" {
+			fmt.Fprint(w, readSAMLFixture(f.t, "login.html"))
+			return
+		}
+
+		r.ParseForm()
+		if _, ok := r.PostForm["_eventId_proceed"]; !ok || r.PostForm.Get("csrf_token") == "" ||
+			r.PostForm.Get("j_username") != "a0123456" || r.PostForm.Get("j_password") != "correct" {
+			fmt.Fprint(w, readSAMLFixture(f.t, "failed.html"))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "shib_idp_session", Value: "1", Path: "/idp"})
+		fmt.Fprint(w, readSAMLFixture(f.t, "response.html"))
+
+	case "/Shibboleth.sso/SAML2/POST":
+		r.ParseForm()
+		f.response = r.PostForm.Get("SAMLResponse")
+		if f.response == "" || r.PostForm.Get("RelayState") != "ss:mem:5d3c1f0a" {
+			http.Error(w, "invalid SAML response", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "_shibsession_panda", Value: "authorized", Path: "/"})
+		http.Redirect(w, r, "/portal", http.StatusFound)
+
+	case "/direct/session/current.json":
+		if _, err := r.Cookie("_shibsession_panda"); err == nil {
+			fmt.Fprint(w, `{"userEid":"a0123456"}`)
+			return
+		}
+		fmt.Fprint(w, `{"userEid":null}`)
+
+	case "/portal":
+		fmt.Fprint(w, "<html><body>PandA</body></html>")
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func readSAMLFixture(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "saml", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestSAMLPost(t *testing.T) {
+	idp := &fakeSAML{t: t}
+	server := httptest.NewServer(idp)
+	defer server.Close()
+
+	ep := testEndpoint(server)
+	auth := &SAMLPost{ECSID: "a0123456", Password: "correct", LoginURL: server.URL + "/Shibboleth.sso/Login"}
+
+	client := newClient(newJar())
+	if err := auth.Authenticate(client, ep); err != nil {
+		t.Fatal(err)
+	}
+	if idp.response == "" {
+		t.Error("SAMLResponse is not posted")
+	}
+
+	// IdPのログイン状態が残っていればフォームを経ずにSAMLResponseを送信する
+	idp.response = ""
+	if err := auth.Authenticate(client, ep); err != nil || idp.response == "" {
+		t.Errorf("single sign-on: %v", err)
+	}
+
+	wrong := &SAMLPost{ECSID: "a0123456", Password: "wrong", LoginURL: server.URL + "/Shibboleth.sso/Login"}
+	if err := wrong.Authenticate(newClient(newJar()), ep); fmt.Sprintf("%T", err) != "*pandaapi.FailedLoginError" {
+		t.Errorf("wrong password: %v", err)
+	}
+}
+
+func TestCookieFile(t *testing.T) {
+	useTime(t, time.Unix(1603000000, 0))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("JSESSIONID"); err == nil && c.Value == "good" {
+			fmt.Fprint(w, `{"userEid":"a0123456"}`)
+			return
+		}
+		fmt.Fprint(w, `{"userEid":null}`)
+	}))
+	defer server.Close()
+
+	tmp, err := ioutil.TempDir("", "pandora-cookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+	write := func(name string, lines ...string) string {
+		p := filepath.Join(tmp, name)
+		if err := ioutil.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	valid := write("valid.txt",
+		"# Netscape HTTP Cookie File",
+		"",
+		"#HttpOnly_"+host+"\tFALSE\t/\tFALSE\t0\tJSESSIONID\tgood",
+		host+"\tFALSE\t/\tFALSE\t4102444800\tpasystem\tclosed",
+	)
+	expired := write("expired.txt",
+		host+"\tFALSE\t/\tFALSE\t1600000000\tJSESSIONID\tgood",
+		host+"\tFALSE\t/\tFALSE\t0\tJSESSIONID\tstale",
+	)
+	broken := write("broken.txt", host+" FALSE / FALSE 0 JSESSIONID good")
+
+	client := newClient(newJar())
+	if err := (&CookieFile{Path: valid}).Authenticate(client, testEndpoint(server)); err != nil {
+		t.Fatal(err)
+	}
+	if c := client.Jar.Cookies(mustParse(server.URL)); len(c) != 2 {
+		t.Errorf("cookies: %v", c)
+	}
+
+	if err := (&CookieFile{Path: expired}).Authenticate(newClient(newJar()), testEndpoint(server)); fmt.Sprintf("%T", err) != "*pandaapi.ExpiredCookieError" {
+		t.Errorf("expired: %v", err)
+	}
+	if err := (&CookieFile{Path: broken}).Authenticate(newClient(newJar()), testEndpoint(server)); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("broken: %v", err)
+	}
+}
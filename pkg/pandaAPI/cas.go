@@ -0,0 +1,328 @@
+package pandaapi
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pandora/pkg/secret"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 追跡するリダイレクトの回数の上限
+const maxRedirects = 10
+
+var (
+	// アカウントがロックされていることを表すCASのメッセージ
+	lockedMessages = []string{"ロック", "locked", "disabled"}
+	// パスワードの有効期限が切れていることを表すCASのメッセージ
+	expiredMessages = []string{"有効期限", "expired", "パスワードを変更", "must be changed"}
+	// ワンタイムパスワードを入力するフィールドの名前
+	codeFields = []string{"token", "otp", "totp", "code", "gauthcode", "j_otp"}
+)
+
+// loginForm ログインページから読み取ったフォーム
+type loginForm struct {
+	// 送信先
+	action *url.URL
+	// 隠しフィールドと送信ボタンの値
+	values url.Values
+	// ECS-ID、パスワード、ワンタイムパスワードを入力するフィールドの名前
+	usernameField string
+	passwordField string
+	codeField     string
+}
+
+// casLogin CASにログインし、clientのCookieに保存されたPandAのセッションを認証済みにする
+// clientはリダイレクトを無効にしたもので、リダイレクトはこの関数の中で追跡する
+// 二段階認証を求められた場合はcodeで生成したワンタイムパスワードを送信する codeがnilの場合はエラーとする
+func casLogin(client *http.Client, ep Endpoint, ecsID string, password secret.String, code func() (string, error)) error {
+	// PandAのログインページにGETを行うと、CASのログインページにリダイレクトされる
+	// この際Pandaのドメインに対しJESESSIONIDが紐付けられる
+	doc, base, err := getPage(client, ep.LoginURL)
+	if err != nil {
+		return err
+	}
+
+	form, err := parseLoginForm(doc, base)
+	if err != nil {
+		// CASのログイン状態が残っている場合はログインフォームを経ずにPandAへ戻される
+		if isLoggedIn(client, ep.SessionURL) {
+			return nil
+		}
+		return err
+	}
+
+	// ログインフォームに必要なデータを送信すると、PandAのポータルサイトにリダイレクトする
+	// この際、クエリパラメータとして発行されるticketを用いて、JSESSIONIDを認証済みにする処理がサーバー側で行われる
+	doc, base, err = submit(client, form, form.fill(ecsID, password))
+	if err != nil {
+		return err
+	}
+
+	// ログインに成功したかどうかはPandAのセッションで確認する
+	// ログイン後のページにもエラーと同じ要素がありうるため、メッセージは認証されていない場合にのみ探す
+	if isLoggedIn(client, ep.SessionURL) {
+		return nil
+	}
+
+	// 二段階認証のフォームが表示された場合はワンタイムパスワードを送信する
+	if form, err := parseCodeForm(doc, base); err == nil {
+		if code == nil {
+			return &SecondFactorRequiredError{EcsID: ecsID}
+		}
+		c, err := code()
+		if err != nil {
+			return err
+		}
+
+		values := form.fill("", "")
+		values.Set(form.codeField, c)
+		if doc, base, err = submit(client, form, values); err != nil {
+			return err
+		}
+		if isLoggedIn(client, ep.SessionURL) {
+			return nil
+		}
+		if err := loginFailure(doc, ecsID); err != nil {
+			return err
+		}
+		if _, err := parseCodeForm(doc, base); err == nil {
+			return &FailedLoginError{EscID: ecsID}
+		}
+	} else if err := loginFailure(doc, ecsID); err != nil {
+		return err
+	}
+
+	if _, err := parseLoginForm(doc, base); err == nil {
+		// メッセージがなくともログインページに戻された場合は認証情報の誤りとみなす
+		return &FailedLoginError{EscID: ecsID}
+	}
+
+	return &LoginFormChangedError{url: base.String(), reason: "the session is not authorized after login"}
+}
+
+// getPage uriにGETを行い、リダイレクトを追跡した先のページを読み込む
+func getPage(client *http.Client, uri string) (*goquery.Document, *url.URL, error) {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, nil, &NetworkError{Err: err}
+	}
+
+	return readPage(client, resp)
+}
+
+// submit フォームにvaluesを送信し、リダイレクトを追跡した先のページを読み込む
+func submit(client *http.Client, form *loginForm, values url.Values) (*goquery.Document, *url.URL, error) {
+	resp, err := client.PostForm(form.action.String(), values)
+	if err != nil {
+		return nil, nil, &NetworkError{Err: err}
+	}
+
+	return readPage(client, resp)
+}
+
+// readPage リダイレクトを追跡した先のページを読み込む
+func readPage(client *http.Client, resp *http.Response) (*goquery.Document, *url.URL, error) {
+	resp, err := followRedirects(client, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, nil, &LoginFormChangedError{url: resp.Request.URL.String(), reason: err.Error()}
+	}
+
+	return doc, resp.Request.URL, nil
+}
+
+// followRedirects リダイレクトを最後まで追跡し、最後のレスポンスを返す
+func followRedirects(client *http.Client, resp *http.Response) (*http.Response, error) {
+	for i := 0; resp.StatusCode >= 300 && resp.StatusCode < 400; i++ {
+		loc, err := resp.Location()
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, &LoginFormChangedError{url: resp.Request.URL.String(), reason: "redirect without location"}
+		}
+		if i >= maxRedirects {
+			return nil, &LoginFormChangedError{url: loc.String(), reason: "too many redirects"}
+		}
+
+		if resp, err = client.Get(loc.String()); err != nil {
+			return nil, &NetworkError{Err: err}
+		}
+	}
+
+	return resp, nil
+}
+
+// parseLoginForm パスワードを入力するフィールドを持つフォームを読み取る
+func parseLoginForm(doc *goquery.Document, base *url.URL) (*loginForm, error) {
+	form, err := findForm(doc, base, "login form", func(f *loginForm) bool {
+		return f.passwordField != ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	if form.usernameField == "" {
+		return nil, &LoginFormChangedError{url: base.String(), reason: "username field is not found"}
+	}
+
+	return form, nil
+}
+
+// parseCodeForm ワンタイムパスワードを入力するフィールドを持つフォームを読み取る
+func parseCodeForm(doc *goquery.Document, base *url.URL) (*loginForm, error) {
+	return findForm(doc, base, "one-time password form", func(f *loginForm) bool {
+		return f.codeField != "" && f.passwordField == ""
+	})
+}
+
+// findForm ページの中でmatchを満たす最初のフォームを読み取る
+func findForm(doc *goquery.Document, base *url.URL, name string, match func(*loginForm) bool) (*loginForm, error) {
+	var found *loginForm
+	var err error
+	doc.Find("form").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		var form *loginForm
+		if form, err = parseForm(sel, base); err != nil {
+			return false
+		}
+		if match(form) {
+			found = form
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, &LoginFormChangedError{url: base.String(), reason: name + " is not found"}
+	}
+
+	return found, nil
+}
+
+// parseForm フォームの送信先と入力欄を読み取る
+// 隠しフィールドは全て引き継ぎ、送信ボタンは最初のものの値を用いる
+func parseForm(sel *goquery.Selection, base *url.URL) (*loginForm, error) {
+	form := &loginForm{values: url.Values{}}
+
+	action, _ := sel.Attr("action")
+	u, err := base.Parse(action)
+	if err != nil {
+		return nil, &LoginFormChangedError{url: base.String(), reason: "invalid form action: " + action}
+	}
+	form.action = u
+
+	submitted := false
+	sel.Find("input, button").Each(func(_ int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok || name == "" {
+			return
+		}
+		value, _ := s.Attr("value")
+
+		// buttonの既定の種類はsubmit
+		typ := "text"
+		if goquery.NodeName(s) == "button" {
+			typ = "submit"
+		}
+
+		switch strings.ToLower(s.AttrOr("type", typ)) {
+		case "hidden":
+			form.values.Add(name, value)
+		case "submit":
+			if !submitted {
+				form.values.Set(name, value)
+				submitted = true
+			}
+		case "password":
+			if form.passwordField == "" {
+				form.passwordField = name
+			}
+		case "text", "email", "number", "tel":
+			if containsAny(name, codeFields) && form.codeField == "" {
+				form.codeField = name
+			} else if form.usernameField == "" {
+				form.usernameField = name
+			}
+		}
+	})
+
+	return form, nil
+}
+
+// fill 認証情報を入力したフォームの値を返す 入力欄のないものは無視する
+func (f *loginForm) fill(ecsID string, password secret.String) url.Values {
+	values := url.Values{}
+	for k, v := range f.values {
+		values[k] = append([]string(nil), v...)
+	}
+	if f.usernameField != "" {
+		values.Set(f.usernameField, ecsID)
+	}
+	if f.passwordField != "" {
+		values.Set(f.passwordField, password.Reveal())
+	}
+
+	return values
+}
+
+// loginFailure ログイン後のページにエラーメッセージがあればその内容に応じたエラーを返す
+func loginFailure(doc *goquery.Document, ecsID string) error {
+	msg := strings.TrimSpace(doc.Find("#msg, .errors, .alert-danger, .error-message, .form-element.form-error").Text())
+	if msg == "" {
+		return nil
+	}
+
+	switch {
+	case containsAny(msg, lockedMessages):
+		return &AccountLockedError{EcsID: ecsID, message: msg}
+	case containsAny(msg, expiredMessages):
+		return &PasswordExpiredError{EcsID: ecsID, message: msg}
+	}
+
+	return &FailedLoginError{EscID: ecsID}
+}
+
+// containsAny sにwordsのいずれかが含まれるかどうか 大文字と小文字は区別しない
+func containsAny(s string, words []string) bool {
+	s = strings.ToLower(s)
+	for _, w := range words {
+		if strings.Contains(s, strings.ToLower(w)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLoggedIn PandAのセッションが認証済みかどうかを確認する
+func isLoggedIn(client *http.Client, sessionURL string) bool {
+	resp, err := client.Get(sessionURL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return false
+	}
+
+	var s struct {
+		UserEid string `json:"userEid"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return false
+	}
+
+	return s.UserEid != ""
+}
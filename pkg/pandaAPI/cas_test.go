@@ -0,0 +1,218 @@
+package pandaapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pandora/pkg/secret"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func readFixture(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "cas", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestParseLoginForm(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(readFixture(t, "login.html")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://cas.ecs.kyoto-u.ac.jp/cas/login?service=x")
+
+	form, err := parseLoginForm(doc, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "https://cas.ecs.kyoto-u.ac.jp/cas/login;jsessionid=3F2A9C?service=%2Fsakai-login-tool%2Fcontainer"; form.action.String() != want {
+		t.Errorf("action: %s", form.action)
+	}
+	if form.usernameField != "username" || form.passwordField != "password" {
+		t.Errorf("fields: %s, %s", form.usernameField, form.passwordField)
+	}
+
+	values := form.fill("a0123456", "secret")
+	want := url.Values{
+		"lt":        {"LT-48213-0fQbqYdWcKzRmTnP3aHs-cas.ecs.kyoto-u.ac.jp"},
+		"execution": {"e2s1"},
+		"_eventId":  {"submit"},
+		"submit":    {"ログイン"},
+		"username":  {"a0123456"},
+		"password":  {"secret"},
+	}
+	if values.Encode() != want.Encode() {
+		t.Errorf("values: got %v, want %v", values, want)
+	}
+	if len(form.values["username"]) != 0 {
+		t.Error("fill modified the form")
+	}
+
+	changed, _ := goquery.NewDocumentFromReader(strings.NewReader(readFixture(t, "changed.html")))
+	if _, err := parseLoginForm(changed, base); fmt.Sprintf("%T", err) != "*pandaapi.LoginFormChangedError" {
+		t.Errorf("changed form: %v", err)
+	}
+}
+
+// fakeCAS PandAとCASのログインの流れを再現するサーバー
+type fakeCAS struct {
+	// ログインページとして返すファイル
+	page string
+	// 誤ったパスワードを送信した場合に返すファイル
+	failure string
+	// 二段階認証のページとして返すファイル 空の場合は二段階認証を求めない
+	otpPage string
+	// ワンタイムパスワードの秘密鍵
+	otpSecret string
+	// ログイン後のポータルとして返すHTML 空の場合は簡単なページを返す
+	portal string
+	// 送信されたフォーム
+	posted url.Values
+}
+
+func (f *fakeCAS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const (
+		password = "correct"
+		ticket   = "ST-1-kyoto"
+	)
+
+	switch {
+	case r.URL.Path == "/sakai-login-tool/container":
+		if r.URL.Query().Get("ticket") == ticket {
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "authorized", Path: "/"})
+			http.Redirect(w, r, "/portal", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/cas/login?service=%2Fsakai-login-tool%2Fcontainer", http.StatusFound)
+
+	case strings.HasPrefix(r.URL.Path, "/cas/login") && r.Method == "GET":
+		if _, err := r.Cookie("TGC"); err == nil {
+			http.Redirect(w, r, "/sakai-login-tool/container?ticket="+ticket, http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, f.page)
+
+	case strings.HasPrefix(r.URL.Path, "/cas/login") && r.Method == "POST" && f.otpPage != "" && r.FormValue("token") != "":
+		f.posted = r.PostForm
+		if want, _ := totp(f.otpSecret, now()); r.PostForm.Get("token") != want || r.PostForm.Get("execution") != "e2s2" {
+			fmt.Fprint(w, f.failure)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "TGC", Value: "TGT-1", Path: "/cas"})
+		http.Redirect(w, r, "/sakai-login-tool/container?ticket="+ticket, http.StatusFound)
+
+	case strings.HasPrefix(r.URL.Path, "/cas/login") && r.Method == "POST" && f.otpPage != "" && r.FormValue("password") == password:
+		fmt.Fprint(w, f.otpPage)
+
+	case strings.HasPrefix(r.URL.Path, "/cas/login") && r.Method == "POST":
+		r.ParseForm()
+		f.posted = r.PostForm
+		if r.PostForm.Get("password") != password || r.PostForm.Get("lt") == "" || r.PostForm.Get("execution") == "" {
+			fmt.Fprint(w, f.failure)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "TGC", Value: "TGT-1", Path: "/cas"})
+		http.Redirect(w, r, "/sakai-login-tool/container?ticket="+ticket, http.StatusFound)
+
+	case r.URL.Path == "/direct/session/current.json":
+		w.Header().Set("Content-Type", "application/json")
+		if c, err := r.Cookie("JSESSIONID"); err == nil && c.Value == "authorized" {
+			fmt.Fprint(w, `{"userEid":"a0123456"}`)
+			return
+		}
+		fmt.Fprint(w, `{"userEid":null}`)
+
+	case r.URL.Path == "/portal":
+		if f.portal != "" {
+			fmt.Fprint(w, f.portal)
+			return
+		}
+		fmt.Fprint(w, "<html><body>PandA</body></html>")
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCASLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		failure  string
+		password string
+		want     string
+	}{
+		{"success", "login.html", "failed.html", "correct", "<nil>"},
+		{"wrong password", "login.html", "failed.html", "wrong", "*pandaapi.FailedLoginError"},
+		{"locked", "login.html", "locked.html", "wrong", "*pandaapi.AccountLockedError"},
+		{"expired", "login.html", "expired.html", "wrong", "*pandaapi.PasswordExpiredError"},
+		{"form changed", "changed.html", "failed.html", "correct", "*pandaapi.LoginFormChangedError"},
+	}
+
+	for _, tt := range tests {
+		cas := &fakeCAS{page: readFixture(t, tt.page), failure: readFixture(t, tt.failure)}
+		server := httptest.NewServer(cas)
+
+		client := newClient(newJar())
+		auth := &CASForm{ECSID: "a0123456", Password: secret.String(tt.password)}
+		err := auth.Authenticate(client, testEndpoint(server))
+		if got := fmt.Sprintf("%T", err); got != tt.want {
+			t.Errorf("%s: got %s (%v), want %s", tt.name, got, err, tt.want)
+		}
+		if err == nil {
+			if cas.posted.Get("_eventId") != "submit" || cas.posted.Get("submit") != "ログイン" || cas.posted.Get("reset") != "" {
+				t.Errorf("%s: posted %v", tt.name, cas.posted)
+			}
+
+			// CASのログイン状態が残っていればフォームを送信しない
+			cas.posted = nil
+			client.Jar.SetCookies(mustParse(server.URL), []*http.Cookie{{Name: "JSESSIONID", Value: "expired", Path: "/"}})
+			if err := auth.Authenticate(client, testEndpoint(server)); err != nil || cas.posted != nil {
+				t.Errorf("%s: single sign-on: %v, posted %v", tt.name, err, cas.posted)
+			}
+		}
+
+		server.Close()
+	}
+}
+
+// ログイン後のページにエラーと同じ要素があっても、セッションが認証されていれば成功とする
+func TestCASLoginAlertOnPortal(t *testing.T) {
+	cas := &fakeCAS{
+		page:    readFixture(t, "login.html"),
+		failure: readFixture(t, "failed.html"),
+		portal:  `<html><body><div class="alert-danger">Scheduled maintenance on Sunday</div></body></html>`,
+	}
+	server := httptest.NewServer(cas)
+	defer server.Close()
+
+	auth := &CASForm{ECSID: "a0123456", Password: "correct"}
+	if err := auth.Authenticate(newClient(newJar()), testEndpoint(server)); err != nil {
+		t.Errorf("login with an alert on the portal: %v", err)
+	}
+}
+
+// testEndpoint テスト用のサーバーでログインするためのURL
+func testEndpoint(server *httptest.Server) Endpoint {
+	return Endpoint{LoginURL: server.URL + "/sakai-login-tool/container", SessionURL: server.URL + "/direct/session/current.json"}
+}
+
+func mustParse(raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return u
+}
@@ -0,0 +1,93 @@
+package pandaapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 接続状態を調べる際のタイムアウト
+const connectivityTimeout = 10 * time.Second
+
+// Connectivity PandAへの接続状態
+type Connectivity int
+
+const (
+	// Online PandAのAPIに接続できる
+	Online Connectivity = iota
+	// Offline ネットワークに接続されていない
+	Offline
+	// CaptivePortal 公衆無線LANのログインページなどに差し替えられている
+	CaptivePortal
+)
+
+func (c Connectivity) String() string {
+	switch c {
+	case Online:
+		return "online"
+	case Offline:
+		return "offline"
+	case CaptivePortal:
+		return "captive portal"
+	}
+
+	return "unknown"
+}
+
+// CheckConnectivity PandAのAPIがJSONを返すかどうかで接続状態を調べる ログインは行わない
+// PandA以外のページへリダイレクトされる場合やHTMLが返る場合、証明書が一致しない場合はキャプティブポータルとみなす
+func CheckConnectivity(ctx context.Context) Connectivity {
+	return checkConnectivity(ctx, &http.Client{
+		Timeout: connectivityTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, pandaSession)
+}
+
+func checkConnectivity(ctx context.Context, client *http.Client, uri string) Connectivity {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return Offline
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ClassOf(&NetworkError{Err: err}) == ClassTLS {
+			return CaptivePortal
+		}
+		return Offline
+	}
+	defer discard(resp)
+
+	if resp.StatusCode/100 == 3 {
+		// PandAとCASの間のリダイレクトは正常
+		loc, err := resp.Location()
+		if err != nil || loc.Host != req.URL.Host && loc.Host != casHost {
+			return CaptivePortal
+		}
+		return Online
+	}
+
+	if resp.StatusCode == 200 && !isJSON(resp) {
+		return CaptivePortal
+	}
+
+	// 200以外のステータスコードでもPandAのサーバーには接続できている
+	return Online
+}
+
+// isJSON レスポンスがJSONかどうかを判定する Content-Typeが正しくない場合は先頭の文字で判断する
+func isJSON(resp *http.Response) bool {
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return true
+	}
+
+	head, _ := bufio.NewReaderSize(resp.Body, peekSize).Peek(peekSize)
+	head = bytes.TrimSpace(head)
+
+	return len(head) > 0 && (head[0] == '{' || head[0] == '[')
+}
@@ -0,0 +1,65 @@
+package pandaapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckConnectivity(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    Connectivity
+	}{
+		{"json", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"userEid": null}`))
+		}, Online},
+		{"json without content type", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("\n{}"))
+		}, Online},
+		{"login redirect", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, casDomain+"/cas/login", http.StatusFound)
+		}, Online},
+		{"maintenance", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, Online},
+		{"portal page", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Welcome to Free Wi-Fi</body></html>"))
+		}, CaptivePortal},
+		{"portal redirect", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://wifi.example.com/login", http.StatusFound)
+		}, CaptivePortal},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(tt.handler)
+		client := server.Client()
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+
+		if got := checkConnectivity(context.Background(), client, server.URL+"/direct/session/current.json"); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+		server.Close()
+	}
+
+	// 接続できない場合
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	if got := checkConnectivity(context.Background(), http.DefaultClient, server.URL); got != Offline {
+		t.Errorf("closed server: got %s", got)
+	}
+
+	// 証明書が一致しない場合はHTTPSを差し替えるキャプティブポータルとみなす
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	if got := checkConnectivity(context.Background(), http.DefaultClient, tlsServer.URL); got != CaptivePortal {
+		t.Errorf("untrusted certificate: got %s", got)
+	}
+}
@@ -0,0 +1,67 @@
+package pandaapi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HttpOnlyのCookieを表す行の接頭辞 curlやブラウザの拡張機能が書き出す
+const httpOnlyPrefix = "#HttpOnly_"
+
+// importCookies Netscape形式(cookies.txt)のCookieをjarに読み込む 期限切れのものは読み込まない
+// 各行はドメイン、サブドメインを含むか、パス、HTTPSのみか、有効期限、名前、値をタブで区切ったもの
+func importCookies(jar http.CookieJar, r io.Reader, t time.Time) error {
+	scanner := bufio.NewScanner(r)
+	imported := 0
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = strings.TrimPrefix(line, httpOnlyPrefix)
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("cookie file: line %d: expected 7 tab-separated fields, got %d", n, len(fields))
+		}
+		domain, subdomains, path, secure, name, value := fields[0], fields[1] == "TRUE", fields[2], fields[3] == "TRUE", fields[5], fields[6]
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cookie file: line %d: invalid expiry %q", n, fields[4])
+		}
+		if expires != 0 && time.Unix(expires, 0).Before(t) {
+			continue
+		}
+
+		host := strings.TrimPrefix(domain, ".")
+		c := &http.Cookie{Name: name, Value: value, Path: path, Secure: secure, HttpOnly: httpOnly}
+		if subdomains {
+			c.Domain = host
+		}
+		if expires != 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: path}, []*http.Cookie{c})
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if imported == 0 {
+		return fmt.Errorf("cookie file: no valid cookies")
+	}
+
+	return nil
+}
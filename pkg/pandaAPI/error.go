@@ -1,41 +1,479 @@
 package pandaapi
 
-import "fmt"
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"pandora/pkg/secret"
+)
 
-// DeadPandAError PandAが死んでいる時に返すエラー
-type DeadPandAError struct {
-	code int
-	err  error
-	url  string
+// エラーメッセージには登録された秘密情報が含まれないよう、全てsecret.Redactを通して返す
+
+// 利用者向けのメッセージの言語
+const (
+	LangJapanese = "ja"
+	LangEnglish  = "en"
+)
+
+// Class エラーの原因による分類 errors.Is(err, ClassForbidden) のように判定に用いる
+type Class int
+
+const (
+	// ClassUnknown 分類できないエラー
+	ClassUnknown Class = iota
+	// ClassUnavailable PandAが停止しているか5xxを返した
+	ClassUnavailable
+	// ClassAuth ログインが必要もしくはログインに失敗した
+	ClassAuth
+	// ClassForbidden アクセスが拒否された 授業の履修を取り消された場合など
+	ClassForbidden
+	// ClassNotFound 授業サイトや資料が存在しない
+	ClassNotFound
+	// ClassRateLimited リクエストが多すぎるため制限された
+	ClassRateLimited
+	// ClassTLS 証明書の検証などTLSの通信に失敗した
+	ClassTLS
+	// ClassDNS 名前解決に失敗した
+	ClassDNS
+	// ClassTimeout 通信がタイムアウトした
+	ClassTimeout
+	// ClassNetwork その他の接続のエラー オフラインの場合など
+	ClassNetwork
+	// ClassParse PandAの返した内容が想定と異なる
+	ClassParse
+)
+
+var classNames = map[Class]string{
+	ClassUnknown:     "unknown",
+	ClassUnavailable: "unavailable",
+	ClassAuth:        "auth",
+	ClassForbidden:   "forbidden",
+	ClassNotFound:    "not found",
+	ClassRateLimited: "rate limited",
+	ClassTLS:         "tls",
+	ClassDNS:         "dns",
+	ClassTimeout:     "timeout",
+	ClassNetwork:     "network",
+	ClassParse:       "parse",
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+// Error errors.Isの比較対象として用いるためのメソッド
+func (c Class) Error() string {
+	return "pandaapi: " + c.String()
+}
+
+// classified 原因による分類を持つエラー
+type classified interface {
+	Class() Class
 }
 
-func (d *DeadPandAError) Error() string {
-	if d.err != nil {
-		return fmt.Sprintf("Panda is dead. Status code %d in %s\nerror: %s\n", d.code, d.url, d.err)
+// localized 利用者向けのメッセージを持つエラー
+type localized interface {
+	localize(lang string) string
+}
+
+// ClassOf errの原因による分類を返す 包まれたエラーも調べる
+func ClassOf(err error) Class {
+	var c classified
+	if errors.As(err, &c) {
+		return c.Class()
 	}
 
-	return fmt.Sprintf("Panda is dead. Status code %d: in %s\n", d.code, d.url)
+	return ClassUnknown
 }
 
-// FailedLoginError ログインに失敗したときのエラー
-type FailedLoginError struct {
-	EscID    string
-	Password string
+// Message errの原因に応じた利用者向けのメッセージをlangの言語で返す
+func Message(err error, lang string) string {
+	var l localized
+	if errors.As(err, &l) {
+		return secret.Redact(l.localize(lang))
+	}
+
+	return secret.Redact(pick(lang, "エラーが発生しました: ", "Error: ") + err.Error())
 }
 
-func (f *FailedLoginError) Error() string {
-	return fmt.Sprintf(
-		"Login failed. Please confirm your EcsID and password.\nEcsID: %s\nPassword: %s",
-		f.EscID,
-		f.Password,
-	)
+// pick langに応じてjaかenを返す
+func pick(lang, ja, en string) string {
+	if lang == LangJapanese {
+		return ja
+	}
+
+	return en
+}
+
+// isClass targetがcと同じ分類の場合にtrueを返す
+func isClass(c Class, target error) bool {
+	t, ok := target.(Class)
+	return ok && t == c
+}
+
+// inSite 授業サイトのIDを利用者向けのメッセージに添える
+func inSite(lang, siteID string) string {
+	if siteID == "" {
+		return ""
+	}
+
+	return pick(lang, fmt.Sprintf(" (授業サイト: %s)", siteID), fmt.Sprintf(" (site: %s)", siteID))
+}
+
+// StatusError PandAが200以外のステータスコードを返した時のエラー
+type StatusError struct {
+	StatusCode int
+	URL        string
+	// 授業サイトに関するリクエストの場合はそのID
+	SiteID string
+	Err    error
+}
+
+// DeadPandAError 互換性のための StatusError の別名
+type DeadPandAError = StatusError
+
+func (s *StatusError) Error() string {
+	msg := fmt.Sprintf("PandA returned status %d (%s) in %s", s.StatusCode, s.Class(), s.URL)
+	if s.SiteID != "" {
+		msg += " for site " + s.SiteID
+	}
+	if s.Err != nil {
+		msg += ": " + s.Err.Error()
+	}
+
+	return secret.Redact(msg)
+}
+
+func (s *StatusError) Unwrap() error {
+	return s.Err
+}
+
+// Class ステータスコードから原因を分類する
+func (s *StatusError) Class() Class {
+	switch s.StatusCode {
+	case http.StatusUnauthorized:
+		return ClassAuth
+	case http.StatusForbidden:
+		return ClassForbidden
+	case http.StatusNotFound, http.StatusGone:
+		return ClassNotFound
+	case http.StatusTooManyRequests:
+		return ClassRateLimited
+	}
+
+	return ClassUnavailable
+}
+
+func (s *StatusError) Is(target error) bool {
+	return isClass(s.Class(), target)
+}
+
+func (s *StatusError) localize(lang string) string {
+	site := inSite(lang, s.SiteID)
+
+	switch s.Class() {
+	case ClassAuth:
+		return pick(lang, "PandAへのログインが必要です。", "You need to log in to PandA.") + site
+	case ClassForbidden:
+		return pick(lang, "アクセスが拒否されました。授業の履修が取り消された可能性があります。",
+			"Access denied. You may have been removed from the course.") + site
+	case ClassNotFound:
+		return pick(lang, "授業サイトもしくは資料が見つかりません。削除された可能性があります。",
+			"The course site or material was not found. It may have been deleted.") + site
+	case ClassRateLimited:
+		return pick(lang, "PandAへのリクエストが多すぎるため制限されました。しばらくしてから再度実行してください。",
+			"Too many requests to PandA. Please try again later.")
+	}
+
+	return pick(lang, fmt.Sprintf("PandAが利用できません(ステータスコード %d)。メンテナンス中の可能性があります。", s.StatusCode),
+		fmt.Sprintf("PandA is unavailable (status code %d). It may be under maintenance.", s.StatusCode))
 }
 
 // NetworkError ネットの接続状態のエラー
 type NetworkError struct {
-	err error
+	URL    string
+	SiteID string
+	Err    error
 }
 
 func (n *NetworkError) Error() string {
-	return fmt.Sprintf("Network Error:%s", n.err.Error())
+	return secret.Redact(fmt.Sprintf("Network Error:%s", n.Err.Error()))
+}
+
+func (n *NetworkError) Unwrap() error {
+	return n.Err
+}
+
+// Class 通信のエラーの原因を分類する
+func (n *NetworkError) Class() Class {
+	var dnsErr *net.DNSError
+	if errors.As(n.Err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ClassTimeout
+		}
+		return ClassDNS
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalid          x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		header           tls.RecordHeaderError
+	)
+	if errors.As(n.Err, &unknownAuthority) || errors.As(n.Err, &invalid) || errors.As(n.Err, &hostname) || errors.As(n.Err, &header) {
+		return ClassTLS
+	}
+
+	var netErr net.Error
+	if errors.Is(n.Err, context.DeadlineExceeded) || errors.As(n.Err, &netErr) && netErr.Timeout() {
+		return ClassTimeout
+	}
+
+	return ClassNetwork
+}
+
+func (n *NetworkError) Is(target error) bool {
+	return isClass(n.Class(), target)
+}
+
+func (n *NetworkError) localize(lang string) string {
+	switch n.Class() {
+	case ClassTLS:
+		return pick(lang, "PandAとの安全な通信を確立できませんでした。学内ネットワークのログインページなどに接続していないか確認してください。",
+			"Could not establish a secure connection to PandA. Please check that you are not behind a network login page.")
+	case ClassDNS:
+		return pick(lang, "PandAのサーバーが見つかりません。インターネットへの接続を確認してください。",
+			"Could not find the PandA server. Please check your Internet connection.")
+	case ClassTimeout:
+		return pick(lang, "PandAからの応答がタイムアウトしました。しばらくしてから再度実行してください。",
+			"PandA did not respond in time. Please try again later.")
+	}
+
+	return pick(lang, "PandAに接続できません。インターネットへの接続を確認してください。",
+		"Could not connect to PandA. Please check your Internet connection.")
+}
+
+// ParseError PandAの返した内容を読み込めなかった時のエラー
+type ParseError struct {
+	URL    string
+	SiteID string
+	Err    error
+}
+
+func (p *ParseError) Error() string {
+	return secret.Redact(fmt.Sprintf("decode %s: %s", p.URL, p.Err))
+}
+
+func (p *ParseError) Unwrap() error {
+	return p.Err
+}
+
+// Class 常にClassParseを返す
+func (p *ParseError) Class() Class {
+	return ClassParse
+}
+
+func (p *ParseError) Is(target error) bool {
+	return isClass(ClassParse, target)
+}
+
+func (p *ParseError) localize(lang string) string {
+	return pick(lang, "PandAから想定と異なる応答が返されました。PandAの仕様が変わった可能性があります。",
+		"PandA returned an unexpected response. PandA may have changed.") + inSite(lang, p.SiteID)
+}
+
+// withSite 授業サイトに関するリクエストのエラーにサイトのIDを記録する
+func withSite(err error, siteID string) error {
+	var (
+		s *StatusError
+		n *NetworkError
+		p *ParseError
+	)
+	switch {
+	case errors.As(err, &s):
+		s.SiteID = siteID
+	case errors.As(err, &n):
+		n.SiteID = siteID
+	case errors.As(err, &p):
+		p.SiteID = siteID
+	}
+
+	return err
+}
+
+// FailedLoginError ログインに失敗したときのエラー パスワードは保持しない
+type FailedLoginError struct {
+	EscID string
+}
+
+func (f *FailedLoginError) Error() string {
+	return secret.Redact(fmt.Sprintf("Login failed. Please confirm your EcsID and password.\nEcsID: %s", f.EscID))
+}
+
+// Class 常にClassAuthを返す
+func (f *FailedLoginError) Class() Class {
+	return ClassAuth
+}
+
+func (f *FailedLoginError) Is(target error) bool {
+	return isClass(ClassAuth, target)
+}
+
+func (f *FailedLoginError) localize(lang string) string {
+	return pick(lang, "ログインに失敗しました。ECS-IDとパスワードを確認してください。\nECS-ID: ",
+		"Login failed. Please confirm your ECS-ID and password.\nECS-ID: ") + f.EscID
+}
+
+// AccountLockedError アカウントがロックされているためログインできないときのエラー
+type AccountLockedError struct {
+	EcsID string
+	// CASが表示したメッセージ
+	message string
+}
+
+func (a *AccountLockedError) Error() string {
+	return secret.Redact(fmt.Sprintf("Login failed. The account is locked.\nEcsID: %s\n%s", a.EcsID, a.message))
+}
+
+// Class 常にClassAuthを返す
+func (a *AccountLockedError) Class() Class {
+	return ClassAuth
+}
+
+func (a *AccountLockedError) Is(target error) bool {
+	return isClass(ClassAuth, target)
+}
+
+func (a *AccountLockedError) localize(lang string) string {
+	return pick(lang, "アカウントがロックされているためログインできません。\nECS-ID: ",
+		"Login failed. The account is locked.\nECS-ID: ") + a.EcsID + "\n" + a.message
+}
+
+// PasswordExpiredError パスワードの有効期限が切れているためログインできないときのエラー
+type PasswordExpiredError struct {
+	EcsID string
+	// CASが表示したメッセージ
+	message string
+}
+
+func (p *PasswordExpiredError) Error() string {
+	return secret.Redact(fmt.Sprintf("Login failed. The password has expired. Please change it on the ECS-ID website.\nEcsID: %s\n%s", p.EcsID, p.message))
+}
+
+// Class 常にClassAuthを返す
+func (p *PasswordExpiredError) Class() Class {
+	return ClassAuth
+}
+
+func (p *PasswordExpiredError) Is(target error) bool {
+	return isClass(ClassAuth, target)
+}
+
+func (p *PasswordExpiredError) localize(lang string) string {
+	return pick(lang, "パスワードの有効期限が切れています。ECS-IDのウェブサイトで変更してください。\nECS-ID: ",
+		"The password has expired. Please change it on the ECS-ID website.\nECS-ID: ") + p.EcsID + "\n" + p.message
+}
+
+// LoginFormChangedError ログインページの形式が想定と異なるときのエラー
+type LoginFormChangedError struct {
+	url    string
+	reason string
+}
+
+func (l *LoginFormChangedError) Error() string {
+	return secret.Redact(fmt.Sprintf("The login page has changed: %s in %s", l.reason, l.url))
+}
+
+// Class 常にClassParseを返す
+func (l *LoginFormChangedError) Class() Class {
+	return ClassParse
+}
+
+func (l *LoginFormChangedError) Is(target error) bool {
+	return isClass(ClassParse, target)
+}
+
+func (l *LoginFormChangedError) localize(lang string) string {
+	return pick(lang, "ログインページの形式が変わったためログインできません。PandorAを更新してください。",
+		"The login page has changed. Please update PandorA.")
+}
+
+// SecondFactorRequiredError 二段階認証を求められたがワンタイムパスワードの秘密鍵が設定されていないときのエラー
+type SecondFactorRequiredError struct {
+	EcsID string
+}
+
+func (s *SecondFactorRequiredError) Error() string {
+	return secret.Redact(fmt.Sprintf("Login failed. A one-time password is required. Please set the TOTP secret and use the cas-totp login method.\nEcsID: %s", s.EcsID))
+}
+
+// Class 常にClassAuthを返す
+func (s *SecondFactorRequiredError) Class() Class {
+	return ClassAuth
+}
+
+func (s *SecondFactorRequiredError) Is(target error) bool {
+	return isClass(ClassAuth, target)
+}
+
+func (s *SecondFactorRequiredError) localize(lang string) string {
+	return pick(lang, "ワンタイムパスワードが必要です。秘密鍵を設定し、ログイン方法をcas-totpにしてください。\nECS-ID: ",
+		"A one-time password is required. Please set the TOTP secret and use the cas-totp login method.\nECS-ID: ") + s.EcsID
+}
+
+// ExpiredCookieError 読み込んだCookieのセッションが認証済みでないときのエラー
+type ExpiredCookieError struct {
+	Path string
+}
+
+func (e *ExpiredCookieError) Error() string {
+	return secret.Redact(fmt.Sprintf("Login failed. The cookies in %s are not logged in to PandA. Please export them from the browser again.", e.Path))
+}
+
+// Class 常にClassAuthを返す
+func (e *ExpiredCookieError) Class() Class {
+	return ClassAuth
+}
+
+func (e *ExpiredCookieError) Is(target error) bool {
+	return isClass(ClassAuth, target)
+}
+
+func (e *ExpiredCookieError) localize(lang string) string {
+	return pick(lang, "Cookieのログインの有効期限が切れています。ブラウザからもう一度書き出してください。\nファイル: ",
+		"The cookies are no longer logged in to PandA. Please export them from the browser again.\nFile: ") + e.Path
+}
+
+// IsLoginError 認証情報やアカウントの状態によりログインできなかった場合にtrueを返す
+func IsLoginError(err error) bool {
+	var (
+		failed       *FailedLoginError
+		locked       *AccountLockedError
+		expired      *PasswordExpiredError
+		secondFactor *SecondFactorRequiredError
+		cookie       *ExpiredCookieError
+	)
+
+	return errors.As(err, &failed) || errors.As(err, &locked) || errors.As(err, &expired) ||
+		errors.As(err, &secondFactor) || errors.As(err, &cookie)
+}
+
+// IsNetworkError PandAに接続できなかった場合にtrueを返す
+func IsNetworkError(err error) bool {
+	var n *NetworkError
+	return errors.As(err, &n)
+}
+
+// wrapNetworkError 通信のエラーをNetworkErrorにする 分類済みのエラーはそのまま返す
+func wrapNetworkError(err error, uri string) error {
+	var c classified
+	if errors.As(err, &c) {
+		return err
+	}
+
+	return &NetworkError{URL: uri, Err: err}
 }
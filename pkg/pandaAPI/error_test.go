@@ -0,0 +1,167 @@
+package pandaapi
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pandora/pkg/secret"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Class
+	}{
+		{&StatusError{StatusCode: 503}, ClassUnavailable},
+		{&StatusError{StatusCode: 401}, ClassAuth},
+		{&StatusError{StatusCode: 403}, ClassForbidden},
+		{&StatusError{StatusCode: 404}, ClassNotFound},
+		{&StatusError{StatusCode: 429}, ClassRateLimited},
+		{&NetworkError{Err: &net.DNSError{Err: "no such host", Name: "panda.ecs.kyoto-u.ac.jp"}}, ClassDNS},
+		{&NetworkError{Err: fmt.Errorf("get: %w", x509.UnknownAuthorityError{})}, ClassTLS},
+		{&NetworkError{Err: context.DeadlineExceeded}, ClassTimeout},
+		{&NetworkError{Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, ClassNetwork},
+		{&ParseError{Err: io.ErrUnexpectedEOF}, ClassParse},
+		{&AccountLockedError{}, ClassAuth},
+		{fmt.Errorf("sync: %w", &StatusError{StatusCode: 403}), ClassForbidden},
+		{errors.New("something"), ClassUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ClassOf(tt.err); got != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.err, got, tt.want)
+		}
+		if tt.want != ClassUnknown && !errors.Is(tt.err, tt.want) {
+			t.Errorf("%v: errors.Is(%s) is false", tt.err, tt.want)
+		}
+	}
+
+	// 包んだエラーを取り出せる
+	err := &NetworkError{Err: io.ErrUnexpectedEOF}
+	if !errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ClassTLS) {
+		t.Error("unwrap failed")
+	}
+}
+
+// 授業サイトに関するエラーにはサイトのIDを記録し、利用者向けのメッセージに含める
+func TestErrorSite(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/direct/content/site/removed.json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/direct/content/site/broken.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content_collection": [`))
+	})
+	lic := newFakePandA(t, mux)
+
+	_, err := lic.Resources(context.Background(), "removed")
+	var s *StatusError
+	if !errors.As(err, &s) || s.StatusCode != 403 || s.SiteID != "removed" || !strings.HasSuffix(s.URL, "/removed.json") {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	if !errors.Is(err, ClassForbidden) {
+		t.Error("403 is not classified as forbidden")
+	}
+	if msg := Message(err, LangJapanese); !strings.Contains(msg, "履修") || !strings.Contains(msg, "removed") {
+		t.Errorf("ja: %s", msg)
+	}
+	if msg := Message(err, LangEnglish); !strings.Contains(msg, "removed from the course") {
+		t.Errorf("en: %s", msg)
+	}
+
+	_, err = lic.Resources(context.Background(), "broken")
+	var p *ParseError
+	if !errors.As(err, &p) || p.SiteID != "broken" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
+
+// failingTransport 全てのリクエストをerrで失敗させる
+type failingTransport struct {
+	err error
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, f.err
+}
+
+// 通信に失敗した場合や200以外のレスポンスの場合もパニックせず、分類したエラーを返す
+// ログインのエラーもメッセージから秘密情報を伏せる
+func TestLoginErrorRedacted(t *testing.T) {
+	const password = "s3cret-passw0rd-for-redaction"
+	secret.Register(password)
+
+	errs := []error{
+		&FailedLoginError{EscID: password},
+		&AccountLockedError{EcsID: "a0000000", message: "locked: " + password},
+		&PasswordExpiredError{EcsID: "a0000000", message: password},
+		&SecondFactorRequiredError{EcsID: password},
+		&ExpiredCookieError{Path: "/tmp/" + password},
+	}
+	for _, err := range errs {
+		if strings.Contains(err.Error(), password) {
+			t.Errorf("%T reveals the secret: %s", err, err)
+		}
+	}
+}
+
+func TestFetchFaults(t *testing.T) {
+	offline := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("network is unreachable")}
+	noHost := &net.DNSError{Err: "no such host", Name: "panda.ecs.kyoto-u.ac.jp"}
+
+	status := func(code int) *LoggedInClient {
+		return newFakePandA(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+	}
+	failing := func(err error) *LoggedInClient {
+		return &LoggedInClient{c: &http.Client{Transport: &failingTransport{err: err}}}
+	}
+
+	tests := []struct {
+		name string
+		lic  *LoggedInClient
+		want Class
+	}{
+		{"offline", failing(offline), ClassNetwork},
+		{"dns", failing(noHost), ClassDNS},
+		{"unavailable", status(http.StatusServiceUnavailable), ClassUnavailable},
+		{"forbidden", status(http.StatusForbidden), ClassForbidden},
+		{"not found", status(http.StatusNotFound), ClassNotFound},
+	}
+
+	for _, tt := range tests {
+		resp, err := tt.lic.FetchAllSites()
+		if resp != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: FetchAllSites: %v, %v", tt.name, resp, err)
+		}
+
+		resp, err = tt.lic.FetchSiteResources("site1")
+		var s *StatusError
+		var n *NetworkError
+		if resp != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: FetchSiteResources: %v, %v", tt.name, resp, err)
+		} else if errors.As(err, &s) && s.SiteID != "site1" || errors.As(err, &n) && n.SiteID != "site1" {
+			t.Errorf("%s: site ID is not recorded: %#v", tt.name, err)
+		}
+
+		if resp, err := tt.lic.FetchResource(pandaResource + "site1/slides.pdf"); resp != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: FetchResource: %v, %v", tt.name, resp, err)
+		}
+
+		if _, err := tt.lic.Sites(context.Background()); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Sites: %v", tt.name, err)
+		}
+
+		if body, _, err := tt.lic.Open(context.Background(), Resource{URL: pandaResource + "site1/slides.pdf"}); body != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: Open: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package pandaapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FolderType フォルダを表すリソースの種類
+	FolderType = "collection"
+	// LinkType URLへのリンクを表すリソースの種類
+	LinkType = "text/url"
+
+	// Sakaiが日時を表す形式 (GMT)
+	sakaiTimeLayout = "20060102150405.000"
+	// 授業サイトのリソースのURLに含まれる、サイトIDの直前までの部分
+	contentGroupPath = "/access/content/group/"
+)
+
+// Site 授業サイト
+type Site struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	ShortDescription string `json:"shortDescription"`
+	// サイトの種類 授業サイトは"course"
+	Type         string    `json:"type"`
+	Published    bool      `json:"published"`
+	Joinable     bool      `json:"joinable"`
+	ContactName  string    `json:"contactName"`
+	ContactEmail string    `json:"contactEmail"`
+	Owner        SiteOwner `json:"siteOwner"`
+	Created      Timestamp `json:"createdDate"`
+	Modified     Timestamp `json:"modifiedDate"`
+}
+
+// SiteOwner 授業サイトの管理者
+type SiteOwner struct {
+	UserID      string `json:"userId"`
+	DisplayName string `json:"userDisplayName"`
+}
+
+// Resource 授業サイトに登録された資料 フォルダやURLへのリンクも含む
+type Resource struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	// MIMEタイプ フォルダの場合はFolderType、リンクの場合はLinkType
+	Type string `json:"type"`
+	// バイト数 フォルダの場合は含まれる資料の数
+	Size     int64  `json:"size"`
+	Author   string `json:"author"`
+	AuthorID string `json:"authorId"`
+	// 資料を含むフォルダ (例: /content/group/{SITEID}/第1回/)
+	Container string `json:"container"`
+	// 学生に表示されない資料
+	Hidden bool `json:"hidden"`
+	// ダウンロードの前に著作権についての確認が必要な資料
+	CopyrightAlert bool `json:"copyrightAlert"`
+	// 公開日時と公開終了日時 設定されていない場合はゼロ値
+	Release Timestamp `json:"fromDate"`
+	Retract Timestamp `json:"endDate"`
+	// 最終更新日時
+	Modified Timestamp `json:"modifiedDate"`
+	// 資料が登録されている授業サイトのID
+	SiteID string `json:"siteId"`
+}
+
+// Assignment 授業サイトに登録された課題
+type Assignment struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	Instructions string `json:"instructions"`
+	// 課題の状態 (例: OPEN, CLOSED)
+	Status string `json:"status"`
+	// 締切と、遅れての提出を受け付ける最終日時 設定されていない場合はゼロ値
+	Due   Timestamp `json:"dueTime"`
+	Close Timestamp `json:"closeTime"`
+	// 課題の情報を返すAPIのURL
+	URL string `json:"entityURL"`
+	// 課題が登録されている授業サイトのID
+	SiteID string `json:"context"`
+}
+
+// IsFolder フォルダかどうか
+func (r Resource) IsFolder() bool {
+	return r.Type == FolderType
+}
+
+// IsLink URLへのリンクかどうか
+func (r Resource) IsLink() bool {
+	return r.Type == LinkType
+}
+
+// Path 授業サイト内での資料のパスを返す (例: 第1回/slides.pdf) URLから判別できない場合は資料名を返す
+func (r Resource) Path() string {
+	p, ok := r.relPath()
+	if !ok || p == "" {
+		return r.Title
+	}
+
+	return p
+}
+
+// relPath URLから授業サイト内でのパスを取り出す 授業サイトの最上位のフォルダは空になる
+func (r Resource) relPath() (string, bool) {
+	prefix := contentGroupPath + r.SiteID + "/"
+
+	i := strings.Index(r.URL, prefix)
+	if i < 0 {
+		return "", false
+	}
+
+	p, err := url.PathUnescape(strings.TrimSuffix(r.URL[i+len(prefix):], "/"))
+	if err != nil {
+		return "", false
+	}
+
+	return p, true
+}
+
+// Folder 授業サイト内のフォルダ
+type Folder struct {
+	// 授業サイト内でのパス 最上位のフォルダは空
+	Path      string
+	Title     string
+	URL       string
+	Resources []Resource
+	Folders   []*Folder
+}
+
+// Tree 授業サイトの資料の一覧をフォルダの木構造にまとめる
+// フォルダ自体がResourceとして含まれていない場合も、資料のパスからフォルダを作成する
+func Tree(resources []Resource) *Folder {
+	root := &Folder{}
+	folders := map[string]*Folder{"": root}
+
+	var folder func(p string) *Folder
+	folder = func(p string) *Folder {
+		if f, ok := folders[p]; ok {
+			return f
+		}
+		parent := folder(parentPath(p))
+		f := &Folder{Path: p, Title: path.Base(p)}
+		parent.Folders = append(parent.Folders, f)
+		folders[p] = f
+		return f
+	}
+
+	for _, r := range resources {
+		p := r.Path()
+		if r.IsFolder() {
+			if rel, ok := r.relPath(); ok && rel == "" {
+				// 授業サイトの最上位のフォルダ
+				root.Title, root.URL = r.Title, r.URL
+				continue
+			}
+			f := folder(p)
+			f.Title, f.URL = r.Title, r.URL
+			continue
+		}
+		parent := folder(parentPath(p))
+		parent.Resources = append(parent.Resources, r)
+	}
+
+	for _, f := range folders {
+		sort.Slice(f.Folders, func(i, j int) bool { return f.Folders[i].Path < f.Folders[j].Path })
+	}
+
+	return root
+}
+
+// parentPath 授業サイト内のパスの親フォルダのパスを返す
+func parentPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i < 0 {
+		return ""
+	}
+
+	return p[:i]
+}
+
+// Timestamp APIが返す日時
+// Sakaiの"20200410120000000"の形式、エポックミリ秒、{"time": ミリ秒}のいずれも読み込める
+type Timestamp struct {
+	time.Time
+	// APIが返した表記 比較のために元の形式のまま保持する
+	Raw string
+}
+
+// UnmarshalJSON APIの返す日時を読み込む nullの場合はゼロ値にする
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*t = Timestamp{}
+		return nil
+	}
+
+	switch data[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return t.parse(s)
+
+	case '{':
+		var v struct {
+			Time int64 `json:"time"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*t = Timestamp{Time: time.Unix(0, v.Time*int64(time.Millisecond)), Raw: strconv.FormatInt(v.Time, 10)}
+		return nil
+	}
+
+	return t.parse(string(data))
+}
+
+// MarshalJSON APIと同じ表記で書き出す
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.Raw == "" {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(t.Raw)
+}
+
+// parse 文字列で表された日時を読み込む
+// 一つの資料の日時が読めないために一覧全体を読み込めなくならないよう、未知の形式はRawのみ保持してゼロ値にする
+func (t *Timestamp) parse(s string) error {
+	*t = Timestamp{Raw: s}
+	if s == "" {
+		return nil
+	}
+
+	// Sakaiの形式 yyyyMMddHHmmssSSS
+	if len(s) == 17 {
+		if v, err := time.Parse(sakaiTimeLayout, s[:14]+"."+s[14:]); err == nil {
+			t.Time = v
+			return nil
+		}
+	}
+
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		t.Time = time.Unix(0, ms*int64(time.Millisecond))
+		return nil
+	}
+
+	if v, err := time.Parse(time.RFC3339, s); err == nil {
+		t.Time = v
+	}
+
+	return nil
+}
+
+// Meta 資料をダウンロードする際にレスポンスから得られる情報
+type Meta struct {
+	// リダイレクトを経た後の資料のURL
+	URL         string
+	ContentType string
+	// バイト数 分からない場合は-1
+	Size     int64
+	Modified time.Time
+	// Content-Dispositionで指定されたファイル名 指定がない場合は空
+	Filename string
+}
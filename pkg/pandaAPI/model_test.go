@@ -0,0 +1,228 @@
+package pandaapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rewriteTransport PandAへのリクエストをテスト用のサーバーへ送る
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (r *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newFakePandA テスト用のPandAのサーバーと、そこへリクエストを送るクライアントを作成する
+func newFakePandA(t *testing.T, handler http.Handler) *LoggedInClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := newClient(newJar())
+	client.Transport = &rewriteTransport{target: mustParse(server.URL)}
+
+	return &LoggedInClient{c: client}
+}
+
+func serveFixture(t *testing.T, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "direct", name))
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+func TestSites(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/direct/site.json", serveFixture(t, "site.json"))
+	lic := newFakePandA(t, mux)
+
+	sites, err := lic.Sites(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 2 {
+		t.Fatalf("sites: %+v", sites)
+	}
+
+	s := sites[0]
+	if s.ID != "2020-110-7081-000" || s.Title != "[2020前期月２]線形代数学" || s.Type != "course" || !s.Published {
+		t.Errorf("site: %+v", s)
+	}
+	if s.Owner.UserID != "t0000001" || s.ContactName != "田中 太郎" {
+		t.Errorf("owner: %+v", s.Owner)
+	}
+	if !s.Modified.Equal(time.Date(2020, 4, 10, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("modified: %s", s.Modified)
+	}
+}
+
+func TestResources(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/direct/content/site/2020-110-7081-000.json", serveFixture(t, "content.json"))
+	lic := newFakePandA(t, mux)
+
+	resources, err := lic.Resources(context.Background(), "2020-110-7081-000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 4 {
+		t.Fatalf("resources: %+v", resources)
+	}
+
+	slides := resources[2]
+	if slides.Path() != "第1回/slides.pdf" || slides.SiteID != "2020-110-7081-000" || slides.Author != "田中 太郎" {
+		t.Errorf("slides: %+v", slides)
+	}
+	if !slides.CopyrightAlert || slides.Hidden || slides.Container != "/content/group/2020-110-7081-000/第1回/" {
+		t.Errorf("flags: %+v", slides)
+	}
+	if want := time.Date(2020, 4, 10, 3, 15, 0, 123000000, time.UTC); !slides.Modified.Equal(want) || slides.Modified.Raw != "20200410031500123" {
+		t.Errorf("modified: %s (%s)", slides.Modified, slides.Modified.Raw)
+	}
+	if !slides.Release.Equal(time.Date(2020, 4, 10, 0, 0, 0, 0, time.UTC)) || slides.Retract.Year() != 2020 {
+		t.Errorf("release: %s, retract: %s", slides.Release, slides.Retract)
+	}
+	if link := resources[3]; !link.IsLink() || !link.Hidden || !link.Release.IsZero() {
+		t.Errorf("link: %+v", link)
+	}
+
+	root := Tree(resources)
+	if root.Title != "[2020前期月２]線形代数学" || len(root.Folders) != 1 || len(root.Resources) != 1 {
+		t.Fatalf("root: %+v", root)
+	}
+	if f := root.Folders[0]; f.Path != "第1回" || len(f.Resources) != 1 || f.Resources[0].Title != "slides.pdf" {
+		t.Errorf("folder: %+v", f)
+	}
+
+	// 書き出した日時は元の表記に戻る
+	data, err := json.Marshal(slides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Resource
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Modified.Raw != slides.Modified.Raw || !decoded.Retract.Equal(slides.Retract.Time) {
+		t.Errorf("round trip: %+v, %v", decoded, err)
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/direct/assignment/my.json", serveFixture(t, "assignment.json"))
+	lic := newFakePandA(t, mux)
+
+	assignments, err := lic.Assignments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 2 {
+		t.Fatalf("assignments: %+v", assignments)
+	}
+
+	a := assignments[0]
+	if a.ID != "a1b2c3" || a.Title != "第1回 レポート" || a.SiteID != "2020-110-7081-000" || a.Status != "OPEN" {
+		t.Errorf("assignment: %+v", a)
+	}
+	if !a.Due.Equal(time.Date(2020, 4, 17, 14, 59, 0, 0, time.UTC)) || !a.Close.After(a.Due.Time) {
+		t.Errorf("due: %s, close: %s", a.Due, a.Close)
+	}
+	if b := assignments[1]; !b.Close.IsZero() || b.Due.IsZero() {
+		t.Errorf("close time: %+v", b)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	const path = "/access/content/group/2020-110-7081-000/slides.pdf"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		// 著作権についての確認を済ませるまではその画面へリダイレクトする
+		if _, err := r.Cookie("accepted"); err != nil {
+			http.Redirect(w, r, "/access/copyright?ref="+url.QueryEscape(path), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `inline; filename="slides.pdf"`)
+		w.Header().Set("Last-Modified", "Fri, 10 Apr 2020 03:15:00 GMT")
+		w.Write([]byte("%PDF-1.4"))
+	})
+	mux.HandleFunc("/access/accept", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "accepted", Value: "1", Path: "/"})
+	})
+	lic := newFakePandA(t, mux)
+
+	body, meta, err := lic.Open(context.Background(), Resource{URL: pandaDomain + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	if data, _ := ioutil.ReadAll(body); string(data) != "%PDF-1.4" {
+		t.Errorf("body: %q", data)
+	}
+	if meta.ContentType != "application/pdf" || meta.Filename != "slides.pdf" || meta.Size != 8 {
+		t.Errorf("meta: %+v", meta)
+	}
+	if !meta.Modified.Equal(time.Date(2020, 4, 10, 3, 15, 0, 0, time.UTC)) {
+		t.Errorf("modified: %s", meta.Modified)
+	}
+
+	// キャンセルされた場合はダウンロードしない
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := lic.Open(ctx, Resource{URL: pandaDomain + path}); err == nil {
+		t.Error("canceled request succeeded")
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	tests := []struct {
+		json string
+		want time.Time
+	}{
+		{`"20200410031500123"`, time.Date(2020, 4, 10, 3, 15, 0, 123000000, time.UTC)},
+		{`1586505600000`, time.Date(2020, 4, 10, 8, 0, 0, 0, time.UTC)},
+		{`{"display": "2020/04/10 17:00", "time": 1586505600000}`, time.Date(2020, 4, 10, 8, 0, 0, 0, time.UTC)},
+		{`"2020-04-10T08:00:00Z"`, time.Date(2020, 4, 10, 8, 0, 0, 0, time.UTC)},
+		{`null`, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(tt.json), &ts); err != nil {
+			t.Errorf("%s: %v", tt.json, err)
+			continue
+		}
+		if !ts.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.json, ts.Time, tt.want)
+		}
+	}
+
+	// 読めない日時があっても資料の情報は読み込み、元の表記を保持する
+	var res Resource
+	data := `{"title": "slides.pdf", "fromDate": "yesterday", "modifiedDate": "20200410031500123"}`
+	if err := json.Unmarshal([]byte(data), &res); err != nil {
+		t.Fatalf("unparseable date aborts decoding: %v", err)
+	}
+	if res.Title != "slides.pdf" || !res.Release.IsZero() || res.Release.Raw != "yesterday" || res.Modified.IsZero() {
+		t.Errorf("resource: %+v", res)
+	}
+	if out, err := json.Marshal(res.Release); err != nil || string(out) != `"yesterday"` {
+		t.Errorf("round trip: %s, %v", out, err)
+	}
+}
@@ -0,0 +1,63 @@
+package pandaapi
+
+import (
+	"net/http"
+
+	"pandora/pkg/secret"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// samlLogin SPからIdPへリダイレクトされた先のログインフォームに認証情報を送信し、
+// IdPが返したSAMLResponseをHTTP POST BindingでSPへ送信する
+func samlLogin(client *http.Client, ep Endpoint, ecsID string, password secret.String) error {
+	// SPのログインページにGETを行うと、AuthnRequestを伴ってIdPへリダイレクトされる
+	doc, base, err := getPage(client, ep.LoginURL)
+	if err != nil {
+		return err
+	}
+
+	// IdPのログイン状態が残っている場合はログインフォームを経ずにSAMLResponseが返される
+	if !hasSAMLResponse(doc) {
+		form, err := parseLoginForm(doc, base)
+		if err != nil {
+			if isLoggedIn(client, ep.SessionURL) {
+				return nil
+			}
+			return err
+		}
+
+		if doc, base, err = submit(client, form, form.fill(ecsID, password)); err != nil {
+			return err
+		}
+		if err := loginFailure(doc, ecsID); err != nil {
+			return err
+		}
+	}
+
+	// ブラウザではJavaScriptで自動的に送信されるフォームを送信する
+	response, err := findForm(doc, base, "SAML response form", func(f *loginForm) bool {
+		return f.values.Get("SAMLResponse") != ""
+	})
+	if err != nil {
+		if _, e := parseLoginForm(doc, base); e == nil {
+			// メッセージがなくともログインフォームに戻された場合は認証情報の誤りとみなす
+			return &FailedLoginError{EscID: ecsID}
+		}
+		return err
+	}
+	if _, _, err := submit(client, response, response.values); err != nil {
+		return err
+	}
+
+	if !isLoggedIn(client, ep.SessionURL) {
+		return &LoginFormChangedError{url: response.action.String(), reason: "the session is not authorized after SAML response"}
+	}
+
+	return nil
+}
+
+// hasSAMLResponse ページにSAMLResponseを送信するフォームがあるかどうか
+func hasSAMLResponse(doc *goquery.Document) bool {
+	return doc.Find(`form input[name="SAMLResponse"]`).Length() > 0
+}
@@ -0,0 +1,236 @@
+package pandaapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"pandora/pkg/crypt"
+	"pandora/pkg/dir"
+	"pandora/pkg/secret"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// ログイン状態を保存するファイルの名前
+	sessionFile = "session.dat"
+	// ログイン状態を確認するAPI
+	pandaSession = pandaDomain + "/direct/session/current.json"
+	// JSONを返すAPIがログインページを返していないか確認するために読み込むバイト数
+	peekSize = 4096
+)
+
+var (
+	// Cookieを保存するURL PandAとCASのログイン状態をそれぞれ保存する
+	sessionURLs = []string{pandaDomain + "/", casDomain + "/cas/"}
+
+	// ログイン状態を保存するファイルのパス テストで差し替える
+	sessionPath = func() string { return dir.StatePath(sessionFile) }
+)
+
+// savedSession ファイルに保存するログイン状態
+type savedSession struct {
+	ECSID   string                   `json:"ecsID"`
+	SavedAt time.Time                `json:"savedAt"`
+	Cookies map[string][]savedCookie `json:"cookies"`
+}
+
+// savedCookie 保存するCookie cookiejarからは名前と値しか取り出せない
+type savedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// sessionKey ログイン状態の暗号化に用いるパスフレーズ
+// アカウント情報から導出するため、パスワードを知らなければ復号できず、パスワードを変更すると無効になる
+func sessionKey(ecsID string, password secret.String) []byte {
+	return []byte(ecsID + "\x00" + password.Reveal())
+}
+
+// saveSession jarのCookieをownerの鍵で暗号化して状態のディレクトリに保存する
+func saveSession(jar http.CookieJar, owner sessionOwner) error {
+	ecsID, key := owner.sessionOwner()
+	s := savedSession{ECSID: ecsID, SavedAt: time.Now(), Cookies: make(map[string][]savedCookie)}
+	for _, raw := range sessionURLs {
+		u, _ := url.Parse(raw)
+		for _, c := range jar.Cookies(u) {
+			s.Cookies[raw] = append(s.Cookies[raw], savedCookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := crypt.Seal(key, data)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(sessionPath(), sealed, 0600)
+}
+
+// loadSession 保存されたログイン状態をjarに読み込む 同じアカウントのものが読み込めた場合にtrueを返す
+func loadSession(jar http.CookieJar, owner sessionOwner) bool {
+	ecsID, key := owner.sessionOwner()
+	sealed, err := ioutil.ReadFile(sessionPath())
+	if err != nil {
+		return false
+	}
+
+	data, err := crypt.Open(key, sealed)
+	if err != nil {
+		return false
+	}
+
+	var s savedSession
+	if err := json.Unmarshal(data, &s); err != nil || s.ECSID != ecsID {
+		return false
+	}
+
+	for raw, saved := range s.Cookies {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+
+		cookies := make([]*http.Cookie, 0, len(saved))
+		for _, c := range saved {
+			cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		jar.SetCookies(u, cookies)
+	}
+
+	return true
+}
+
+// newJar Cookieを保存するjarを作成する
+func newJar() http.CookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return jar
+}
+
+// get uriにGETリクエストを送る
+// セッションが切れていた場合はログインし直し、もう一度同じリクエストを送る
+func (lic *LoggedInClient) get(ctx context.Context, uri string) (*http.Response, error) {
+	generation := lic.currentGeneration()
+
+	resp, err := lic.do(ctx, uri)
+	if err != nil {
+		return resp, err
+	}
+
+	expired, resp := checkExpired(resp)
+	if !expired {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if err := lic.relogin(generation); err != nil {
+		return nil, err
+	}
+
+	return lic.do(ctx, uri)
+}
+
+// do ctxを伴うGETリクエストを送る
+func (lic *LoggedInClient) do(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return lic.c.Do(req.WithContext(ctx))
+}
+
+func (lic *LoggedInClient) currentGeneration() int {
+	lic.mu.Lock()
+	defer lic.mu.Unlock()
+
+	return lic.generation
+}
+
+// relogin ログインし直す
+// 並行に送ったリクエストが同時にセッション切れを検出した場合も、ログインは一度だけ行う
+func (lic *LoggedInClient) relogin(generation int) error {
+	lic.mu.Lock()
+	defer lic.mu.Unlock()
+
+	if lic.generation != generation {
+		// 他のリクエストが既にログインし直している
+		return nil
+	}
+	if lic.login == nil {
+		return &FailedLoginError{}
+	}
+
+	if err := lic.login(); err != nil {
+		return err
+	}
+	lic.generation++
+
+	return nil
+}
+
+// checkExpired レスポンスがセッション切れによるログインページへのリダイレクトもしくはログインページそのものかを判定する
+// 本文を確認した場合は、読み込んだ部分を戻したレスポンスを返す
+func checkExpired(resp *http.Response) (bool, *http.Response) {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return true, resp
+
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		loc, err := resp.Location()
+		if err != nil {
+			return false, resp
+		}
+		return isLoginURL(loc), resp
+
+	case resp.StatusCode == http.StatusOK:
+		// JSONを返すAPIがHTMLを返した場合はログインページかどうかを確認する
+		if resp.Request == nil || !strings.HasSuffix(resp.Request.URL.Path, ".json") ||
+			!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			return false, resp
+		}
+
+		body := bufio.NewReaderSize(resp.Body, peekSize)
+		head, _ := body.Peek(peekSize)
+		resp.Body = readCloser{Reader: body, Closer: resp.Body}
+
+		page := string(head)
+		return strings.Contains(page, `name="lt"`) || strings.Contains(page, "/cas/login"), resp
+	}
+
+	return false, resp
+}
+
+// isLoginURL CASもしくはPandAのログインページのURLかどうか
+func isLoginURL(u *url.URL) bool {
+	if u.Host == casHost {
+		return true
+	}
+
+	for _, prefix := range []string{"/sakai-login-tool", "/portal/login", "/portal/relogin", "/portal/xlogin"} {
+		if strings.HasPrefix(u.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readCloser 一部を読み込んだレスポンスボディ
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,170 @@
+package pandaapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useSessionFile テストの間だけログイン状態の保存先を一時ファイルにする
+func useSessionFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := sessionPath
+	sessionPath = func() string { return filepath.Join(tmp, sessionFile) }
+	t.Cleanup(func() {
+		sessionPath = old
+		os.RemoveAll(tmp)
+	})
+}
+
+func TestSaveSession(t *testing.T) {
+	useSessionFile(t)
+
+	jar := newJar()
+	panda, _ := url.Parse(pandaDomain + "/portal")
+	jar.SetCookies(panda, []*http.Cookie{{Name: "JSESSIONID", Value: "abc"}})
+
+	if err := saveSession(jar, &CASForm{ECSID: "a0123456", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(sessionPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "abc") {
+		t.Error("the session is saved in plain text")
+	}
+
+	restored := newJar()
+	if !loadSession(restored, &CASForm{ECSID: "a0123456", Password: "password"}) {
+		t.Fatal("cannot load the saved session")
+	}
+	if c := restored.Cookies(panda); len(c) != 1 || c[0].Value != "abc" {
+		t.Errorf("cookies: %v", c)
+	}
+
+	// パスワードや利用者が変わった場合は用いない
+	if loadSession(newJar(), &CASForm{ECSID: "a0123456", Password: "changed"}) {
+		t.Error("loaded with a wrong password")
+	}
+	if loadSession(newJar(), &CASForm{ECSID: "b0123456", Password: "password"}) {
+		t.Error("loaded for another account")
+	}
+}
+
+func TestCheckExpired(t *testing.T) {
+	tests := []struct {
+		name        string
+		uri         string
+		status      int
+		location    string
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"ok", "/direct/site.json", 200, "", "application/json", `{"site_collection":[]}`, false},
+		{"cas redirect", "/access/content/x.pdf", 302, casDomain + "/cas/login?service=x", "", "", true},
+		{"login tool", "/direct/site.json", 302, pandaDomain + "/sakai-login-tool/container", "", "", true},
+		{"relogin", "/access/content/x.pdf", 302, "/portal/relogin", "", "", true},
+		{"copyright", "/access/content/x.pdf", 302, pandaDomain + "/access/accept?ref=x", "", "", false},
+		{"unauthorized", "/direct/site.json", 401, "", "", "", true},
+		{"login page", "/direct/site.json", 200, "", "text/html; charset=UTF-8", `<form action="/cas/login"><input type="hidden" name="lt" value="LT-1"></form>`, true},
+		{"html file", "/access/content/index.html", 200, "", "text/html", `<form action="/cas/login"></form>`, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", pandaDomain+tt.uri, nil)
+		resp := &http.Response{
+			StatusCode: tt.status,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader(tt.body)),
+			Request:    req,
+		}
+		if tt.location != "" {
+			resp.Header.Set("Location", tt.location)
+		}
+		if tt.contentType != "" {
+			resp.Header.Set("Content-Type", tt.contentType)
+		}
+
+		got, resp := checkExpired(resp)
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+
+		// 確認のために読み込んだ本文も失われない
+		if body, _ := ioutil.ReadAll(resp.Body); string(body) != tt.body {
+			t.Errorf("%s: body is %q", tt.name, body)
+		}
+	}
+}
+
+// セッションが切れていた場合は一度だけログインし直し、失敗したリクエストを送り直す
+func TestRelogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("JSESSIONID"); err != nil || c.Value != "fresh" {
+			http.Redirect(w, r, "/sakai-login-tool/container", http.StatusFound)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	jar := newJar()
+	var (
+		mu     sync.Mutex
+		logins int
+	)
+	lic := &LoggedInClient{
+		c: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		login: func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			logins++
+
+			u, _ := url.Parse(server.URL)
+			jar.SetCookies(u, []*http.Cookie{{Name: "JSESSIONID", Value: "fresh"}})
+			return nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := lic.get(context.Background(), server.URL+"/access/content/x.pdf")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if body, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != 200 || string(body) != "content" {
+				t.Errorf("status %d: %s", resp.StatusCode, body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if logins != 1 {
+		t.Errorf("logged in %d times", logins)
+	}
+}
@@ -0,0 +1,46 @@
+package pandaapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ワンタイムパスワードが切り替わる間隔
+	totpPeriod = 30
+	// ワンタイムパスワードの桁数
+	totpDigits = 6
+)
+
+// 現在時刻 テストで差し替える
+var now = time.Now
+
+// totp RFC 6238 のワンタイムパスワードを生成する
+// secretは認証アプリに登録するBase32の文字列で、空白や小文字を含んでいてもよい
+func totp(secret string, t time.Time) (string, error) {
+	s := strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	s = strings.TrimRight(s, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return "", errors.New("invalid TOTP secret")
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/totpPeriod))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// RFC 4226 の動的切り捨て
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
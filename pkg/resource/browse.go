@@ -0,0 +1,189 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"pandora/pkg/config"
+	"pandora/pkg/dir"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/state"
+	"strings"
+)
+
+const (
+	// サイトのリソースのURLに含まれる、サイトIDの直前までの部分
+	contentGroupPath = "/access/content/group/"
+)
+
+// LessonSite リソースが登録されている授業サイトを返す
+func (r Resource) LessonSite() Site {
+	return r.lessonSite
+}
+
+// Path 授業サイト内でのリソースのパスを返す
+// URLから判別できない場合は資料名を返す
+func (r Resource) Path() string {
+	prefix := contentGroupPath + r.lessonSite.ID + "/"
+
+	i := strings.Index(r.URL, prefix)
+	if i < 0 {
+		return r.Title
+	}
+
+	path, err := url.PathUnescape(r.URL[i+len(prefix):])
+	if err != nil || path == "" {
+		return r.Title
+	}
+
+	return path
+}
+
+// Sites 授業サイトの一覧を取得する allがfalseの場合は現在受講中のもののみを返す
+func Sites(lic *pandaapi.LoggedInClient, all bool) ([]Site, error) {
+	if all {
+		return fetchAllSites(lic)
+	}
+
+	return collectSites(lic, nil)
+}
+
+// SiteResources 授業サイトに登録されているリソースの一覧を取得する
+func SiteResources(lic *pandaapi.LoggedInClient, s Site) ([]Resource, error) {
+	return fetchSiteResources(lic, s)
+}
+
+// Get 一つのリソースをダウンロードしてwに書き込む
+func Get(lic *pandaapi.LoggedInClient, res Resource, w io.Writer) error {
+	body, _, err := lic.Open(context.Background(), pandaapi.Resource{URL: res.URL})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// Save 一つのリソースをテンプレートから決まる保存先へダウンロードして記録し、保存したファイルのパスを返す
+// 既にダウンロードしたことがある場合は以前と同じ場所に保存する
+func Save(lic *pandaapi.LoggedInClient, res Resource, opts *Options) (string, error) {
+	store, err := state.Default()
+	if err != nil {
+		return "", err
+	}
+
+	rec, ok := store.Lookup(res.URL, res.lessonSite.ID, res.Title)
+	if ok && rec.Path != "" {
+		res.target = rec.Path
+	} else {
+		t := newTargets(dir.PandorAPath(), opts.layout(), store)
+		res.target, _ = t.assign(t.render(res.vars()), res.URL)
+	}
+
+	c, action := decide(res, store, opts)
+	switch action {
+	case config.ConflictSkip:
+		return "", fmt.Errorf("%s already exists", c.Path)
+	case config.ConflictOverwrite:
+		res.overwrite = true
+	case config.ConflictKeepBoth:
+		if ok && rec.LastModified != res.LastModified {
+			res.target = dir.Suffixed(res.target, "updated "+res.updatedDate())
+		}
+	}
+
+	body, _, err := lic.Open(context.Background(), pandaapi.Resource{URL: res.URL})
+	if err != nil {
+		return "", err
+	}
+
+	f, err := saveBody(body, body, res)
+	if err != nil {
+		return "", err
+	}
+
+	store.Put(newRecord(res, f))
+	return f.path, store.Save()
+}
+
+// PruneResult 不要になったダウンロードの記録を削除した結果を表す構造体
+type PruneResult struct {
+	Sites     int `json:"sites"`
+	Resources int `json:"resources"`
+}
+
+// Prune ダウンロードの対象とする授業サイトに存在しなくなった資料の記録を削除する
+// ダウンロードしたファイルは削除しない
+// dryRunがtrueの場合は削除される件数を数えるだけでファイルには書き込まない
+func Prune(lic *pandaapi.LoggedInClient, opts *Options, dryRun bool) (result PruneResult, err error) {
+	store, err := state.Default()
+	if err != nil {
+		return result, err
+	}
+
+	sites, err := collectSites(lic, opts.sites())
+	if err != nil {
+		return result, err
+	}
+
+	current := make(map[string]Site, len(sites))
+	for _, s := range sites {
+		current[s.ID] = s
+	}
+
+	for _, siteID := range store.SiteIDs() {
+		records := store.SiteRecords(siteID)
+
+		s, ok := current[siteID]
+		if !ok {
+			// 対象でなくなった授業サイトの記録はまるごと削除する
+			result.Sites++
+			result.Resources += len(records)
+			for _, rec := range records {
+				store.Delete(rec)
+			}
+			continue
+		}
+
+		resources, err := fetchSiteResources(lic, s)
+		if err != nil {
+			return result, err
+		}
+
+		onServer := make(map[string]bool, len(resources)*2)
+		for _, res := range resources {
+			onServer[res.URL] = true
+			onServer[legacyTitle(res.Title)] = true
+		}
+
+		for _, rec := range records {
+			key := rec.URL
+			if rec.Legacy() {
+				key = legacyTitle(rec.Title)
+			}
+			if !onServer[key] {
+				// サーバー上から削除された資料
+				result.Resources++
+				store.Delete(rec)
+			}
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	return result, store.Save()
+}
+
+// TrackedCount 記録されている授業サイトとリソースの数を返す
+func TrackedCount() (sites, resources int) {
+	store, err := state.Default()
+	if err != nil {
+		return 0, 0
+	}
+
+	return len(store.SiteIDs()), store.Len()
+}
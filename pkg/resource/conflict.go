@@ -0,0 +1,146 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"pandora/pkg/config"
+	"pandora/pkg/dir"
+	"pandora/pkg/state"
+)
+
+// Conflict 保存先に既にファイルがある資料
+type Conflict struct {
+	Resource Resource
+	// 既にあるファイルのパス
+	Path string
+	// PandorAが保存し、その後ユーザーが変更していないファイルの場合にtrue
+	Owned bool
+	// on_conflict: askだが尋ねる手段がなかったため、尋ねずに両方残した場合にtrue
+	Unasked bool
+}
+
+// AskFunc 保存先に既にファイルがある場合の対応を尋ねる関数
+// config.ConflictOverwrite, config.ConflictKeepBoth, config.ConflictSkip のいずれかを返す
+type AskFunc func(c Conflict) string
+
+// updatedDate サーバー上で資料が更新された日付を返す 分からない場合は今日の日付を返す
+// PandAの更新時刻は 20201018123456789 の形式
+func (r Resource) updatedDate() string {
+	if len(r.LastModified) >= 8 {
+		if t, err := time.Parse("20060102", r.LastModified[:8]); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+
+	return time.Now().Format("2006-01-02")
+}
+
+// localFile 保存したファイルの情報
+type localFile struct {
+	path    string
+	size    int64
+	sha256  string
+	modTime time.Time
+}
+
+// decide 保存先に既にファイルがある場合の対応を決める ファイルがない場合は空文字列を返す
+// ユーザーが作成もしくは変更したファイルは、どの設定でも上書きしない
+func decide(res Resource, store *state.Store, opts *Options) (Conflict, string) {
+	if !dir.Exists(res.target) {
+		return Conflict{}, ""
+	}
+
+	rec, ok := store.Lookup(res.URL, res.lessonSite.ID, res.Title)
+	c := Conflict{Resource: res, Path: res.target, Owned: ok && owned(rec, res.target)}
+
+	action := opts.onConflict()
+	if action == config.ConflictAsk {
+		if opts.Ask != nil {
+			action = opts.Ask(c)
+		} else {
+			// 黙って両方残すとaskの設定が無視されたことに気づけないため、レポートで知らせる
+			action = config.ConflictKeepBoth
+			c.Unasked = true
+		}
+	}
+
+	if action == config.ConflictOverwrite && !c.Owned {
+		action = config.ConflictKeepBoth
+	}
+
+	return c, action
+}
+
+// owned pathのファイルがPandorAの保存したもので、その後変更されていないかどうかを判定する
+// 更新時刻とサイズが記録と同じ場合はハッシュの計算を省く
+func owned(rec state.Record, path string) bool {
+	if rec.Path == "" || rec.SHA256 == "" || state.PathKey(rec.Path) != state.PathKey(path) {
+		return false
+	}
+
+	info, err := dir.Stat(path)
+	if err != nil || info.IsDir() || info.Size() != rec.Size {
+		return false
+	}
+	if info.ModTime().Equal(rec.ModTime) {
+		return true
+	}
+
+	sum, err := fileSHA256(path)
+	return err == nil && sum == rec.SHA256
+}
+
+// fileSHA256 ファイルのSHA-256を16進数で返す
+func fileSHA256(path string) (string, error) {
+	file, err := dir.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeTarget bodyの内容を資料の保存先に書き込む
+// 上書きしない場合に同名のファイルがあれば名前に日時をつけて保存する 書き込みに失敗した場合はファイルを削除する
+func writeTarget(res Resource, body io.Reader) (localFile, error) {
+	var (
+		file dir.File
+		path string
+		err  error
+	)
+	if res.overwrite {
+		path = res.target
+		file, err = dir.OverwriteFile(path)
+	} else {
+		file, path, err = dir.CreateFile(res.target)
+	}
+	if err != nil {
+		return localFile{}, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, h), body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		dir.Remove(path)
+		return localFile{}, err
+	}
+
+	info, err := dir.Stat(path)
+	if err != nil {
+		return localFile{}, err
+	}
+
+	return localFile{path: path, size: n, sha256: hex.EncodeToString(h.Sum(nil)), modTime: info.ModTime()}, nil
+}
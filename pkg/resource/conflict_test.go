@@ -0,0 +1,103 @@
+package resource
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pandora/pkg/config"
+	"pandora/pkg/dir"
+	"pandora/pkg/state"
+)
+
+func TestDecide(t *testing.T) {
+	m := dir.NewMemFS()
+	dir.SetFS(m)
+	defer dir.SetFS(nil)
+
+	s := Site{ID: "site1", Title: "線形代数学"}
+	root := filepath.FromSlash("/root/PandorA Box/線形代数学")
+	store := state.New()
+
+	// PandorAが保存したファイル
+	download := func(name, content string) Resource {
+		res := testResource(s, name, "application/pdf", "1", int64(len(content)))
+		res.target = filepath.Join(root, name)
+		res.overwrite = true
+		f, err := writeTarget(res, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Put(newRecord(res, f))
+
+		res.overwrite = false
+		return res
+	}
+
+	clean := download("clean.pdf", "server")
+	edited := download("edited.pdf", "server")
+	if err := m.WriteFile(edited.target, []byte("annotated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 旧形式の記録しかないファイル
+	legacy := testResource(s, "legacy.pdf", "application/pdf", "1", 6)
+	legacy.target = filepath.Join(root, "legacy.pdf")
+	m.WriteFile(legacy.target, []byte("server"), 0644)
+	store.Put(state.Record{SiteID: s.ID, Title: "legacy.pdf", LastModified: "1"})
+	// ユーザーが作成したファイル
+	mine := testResource(s, "mine.pdf", "application/pdf", "1", 4)
+	mine.target = filepath.Join(root, "mine.pdf")
+	m.WriteFile(mine.target, []byte("mine"), 0644)
+	// まだ存在しないファイル
+	absent := testResource(s, "absent.pdf", "application/pdf", "1", 4)
+	absent.target = filepath.Join(root, "absent.pdf")
+
+	alwaysOverwrite := func(Conflict) string { return config.ConflictOverwrite }
+
+	tests := []struct {
+		name   string
+		res    Resource
+		opts   *Options
+		action string
+		owned  bool
+	}{
+		{"unmodified file is overwritten", clean, nil, config.ConflictOverwrite, true},
+		{"edited file is kept", edited, nil, config.ConflictKeepBoth, false},
+		{"legacy file is kept", legacy, nil, config.ConflictKeepBoth, false},
+		{"user file is kept", mine, nil, config.ConflictKeepBoth, false},
+		{"no file", absent, nil, "", false},
+		{"keep both", clean, &Options{OnConflict: config.ConflictKeepBoth}, config.ConflictKeepBoth, true},
+		{"skip", edited, &Options{OnConflict: config.ConflictSkip}, config.ConflictSkip, false},
+		{"ask without ui", clean, &Options{OnConflict: config.ConflictAsk}, config.ConflictKeepBoth, true},
+		{"ask allows overwriting own file", clean, &Options{OnConflict: config.ConflictAsk, Ask: alwaysOverwrite}, config.ConflictOverwrite, true},
+		{"ask never overwrites user file", mine, &Options{OnConflict: config.ConflictAsk, Ask: alwaysOverwrite}, config.ConflictKeepBoth, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, action := decide(tt.res, store, tt.opts)
+			if action != tt.action {
+				t.Errorf("action: got %q, want %q", action, tt.action)
+			}
+			if c.Owned != tt.owned {
+				t.Errorf("owned: got %v, want %v", c.Owned, tt.owned)
+			}
+			// 尋ねる関数がない場合は尋ねなかったことを記録する
+			if unasked := tt.opts != nil && tt.opts.OnConflict == config.ConflictAsk && tt.opts.Ask == nil; c.Unasked != unasked {
+				t.Errorf("unasked: got %v, want %v", c.Unasked, unasked)
+			}
+		})
+	}
+
+	// 両方残す場合は既存のファイルをそのままにして別の名前で保存する
+	f, err := writeTarget(edited, strings.NewReader("server v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.path == edited.target || !strings.HasPrefix(filepath.Base(f.path), "edited (") {
+		t.Errorf("unexpected path: %s", f.path)
+	}
+	if data, _ := m.ReadFile(edited.target); string(data) != "annotated" {
+		t.Errorf("edited file is overwritten: %s", data)
+	}
+}
@@ -1,12 +1,14 @@
 package resource
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
-	"net/http"
+	"pandora/pkg/config"
 	"pandora/pkg/dir"
 	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/secret"
+	"pandora/pkg/state"
 	"strings"
 	"sync"
 	"time"
@@ -29,20 +31,24 @@ const (
 	urlType = "text/url"
 )
 
-// site PandAのサイト情報を取得するための構造体
-type site struct {
+// Site PandAのサイト情報を取得するための構造体
+type Site struct {
 	Title string `json:"title"`
 	ID    string `json:"id"`
 }
 
-// resource リソースの情報を表す構造体
-type resource struct {
+// Resource リソースの情報を表す構造体
+type Resource struct {
 	Size         int64  `json:"size"`
 	Type         string `json:"type"`
 	Title        string `json:"title"`
 	URL          string `json:"url"`
 	LastModified string `json:"modifiedDate"`
-	lessonSite   site
+	lessonSite   Site
+	// 計画で決めた保存先のパス
+	target string
+	// 保存先のファイルを上書きする
+	overwrite bool
 }
 
 // RejectableType ダウンロードしないファイル形式を指定する構造体
@@ -101,197 +107,264 @@ func DecodeRejectableType(code uint) (r *RejectableType) {
 	return
 }
 
-// Download 資料をダウンロード
-func Download(ecsID, password string, reject *RejectableType) []error {
-	lic, err := pandaapi.NewLoggedInClient(ecsID, password)
-	if err != nil {
-		return []error{err}
-	}
+// Download ECS-IDとパスワードでCASにログインして資料をダウンロードし、結果をレポートにまとめて返す
+func Download(ecsID string, password secret.String, reject *RejectableType, opts *Options) (*SyncReport, error) {
+	secret.Register(password.Reveal())
 
-	sites, err := collectSites(lic)
-	if err != nil {
-		return []error{err}
-	}
+	return Sync(&pandaapi.CASForm{ECSID: ecsID, Password: password}, reject, opts)
+}
 
-	resources, err := collectUnacquiredResouceInfo(lic, sites, reject)
+// Sync authでログインして資料をダウンロードし、結果をレポートにまとめて返す
+// ログインや授業サイトの一覧の取得に失敗した場合はダウンロードを行わずにエラーを返す
+// 一部の授業サイトの資料の一覧を取得できなかった場合は、残りのサイトについてダウンロードしてレポートに記録する
+func Sync(auth pandaapi.Authenticator, reject *RejectableType, opts *Options) (*SyncReport, error) {
+	started := time.Now()
+
+	lic, err := pandaapi.NewClient(auth)
 	if err != nil {
-		return []error{err}
+		return nil, err
 	}
 
-	if errors := paraDownload(lic, resources); len(errors) > 0 {
-		return errors
+	plan, err := MakePlan(lic, reject, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return execute(lic, plan, opts, started), nil
 }
 
-// paraDownload 未取得のリソースを並列にダウンロードする関数
-func paraDownload(lic *pandaapi.LoggedInClient, resources []resource) (errors []error) {
-	// HTTPレスポンスとエラーをどちらも呼び出し側で扱うための構造体
-	type result struct {
-		response *http.Response
-		info     resource
-		err      error
-	}
+// Execute 計画に従って資料をダウンロードし、ダウンロードに成功したものを記録する
+func Execute(lic *pandaapi.LoggedInClient, plan *Plan, opts *Options) *SyncReport {
+	return execute(lic, plan, opts, time.Now())
+}
 
-	errors = make([]error, 0)
+func execute(lic *pandaapi.LoggedInClient, plan *Plan, opts *Options, started time.Time) *SyncReport {
+	report := newReport(plan, started)
+	defer report.finish()
 
-	var wg sync.WaitGroup
-	resultChan := make(chan result, len(resources))
+	store := plan.store
+	if store == nil {
+		var err error
+		if store, err = state.Default(); err != nil {
+			report.addError(err, "")
+			return report
+		}
+	}
 
-	for _, res := range resources {
-		wg.Add(1)
-		go func(lic *pandaapi.LoggedInClient, info resource) {
-			defer wg.Done()
+	updated := make(map[string]bool, len(plan.Updated))
+	for _, res := range plan.Updated {
+		updated[res.URL] = true
+	}
 
-			// リソースをダウンロード
-			resp, err := lic.FetchResource(info.URL)
-			resultChan <- result{response: resp, info: info, err: err}
-		}(lic, res)
+	// 保存先に既にファイルがある資料の対応を先に決めておく
+	resources := make([]Resource, 0, len(plan.New)+len(plan.Updated))
+	conflicts := make(map[string]Conflict)
+	for _, res := range plan.Downloads() {
+		c, action := decide(res, store, opts)
+		switch action {
+		case config.ConflictSkip:
+			report.addConflict(c, action, "", updated[res.URL])
+			continue
+		case config.ConflictOverwrite:
+			res.overwrite = true
+		case config.ConflictKeepBoth:
+			// サーバー上で更新された資料は、既存のファイルの隣に更新日をつけて保存する
+			if updated[res.URL] {
+				res.target = dir.Suffixed(res.target, "updated "+res.updatedDate())
+			}
+			conflicts[res.URL] = c
+		}
+		resources = append(resources, res)
 	}
 
-	// 送信するものがなくなったらチャネルをクローズする
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+	tracker := newProgressTracker(opts, resources)
+	defer tracker.finished()
 
-	for result := range resultChan {
-		defer result.response.Body.Close()
+	for _, res := range plan.adopted {
+		store.Put(newRecord(res, localFile{path: res.target}))
+	}
 
-		if result.err != nil {
-			errors = append(errors, result.err)
+	for _, o := range paraDownload(lic, resources, tracker, opts.concurrency()) {
+		if o.err != nil {
+			report.addFailed(o.info, o.err)
 			continue
 		}
 
-		file, err := dir.FetchFile(result.info.Title, result.info.lessonSite.Title)
-		if err != nil {
-			errors = append(errors, err)
-			continue
+		report.addDownloaded(o.info, o.file.path, o.bytes, updated[o.info.URL])
+		if c, ok := conflicts[o.info.URL]; ok {
+			report.addConflict(c, config.ConflictKeepBoth, o.file.path, updated[o.info.URL])
 		}
+		store.Put(newRecord(o.info, o.file))
+	}
 
-		if _, err := io.Copy(file, result.response.Body); err != nil {
-			errors = append(errors, err)
-		}
+	if err := store.Save(); err != nil {
+		report.addError(err, "")
 	}
-	return
+
+	return report
 }
 
-// collectUnacquiredResouceInfo 未取得のリソースの情報を取得
-func collectUnacquiredResouceInfo(lic *pandaapi.LoggedInClient, sites []site, reject *RejectableType) (resources []resource, err error) {
-	type (
-		// APIの返すJSONと形を合わせるための構造体
-		wrapper struct {
-			Collection []resource `json:"content_collection"`
-		}
-		// HTTPレスポンスとエラーをどちらも呼び出し側で扱うための構造体
-		result struct {
-			resources []resource
-			s         site
-			err       error
-		}
-	)
+// newRecord ダウンロードしたリソースの記録を作成する
+func newRecord(res Resource, f localFile) state.Record {
+	return state.Record{
+		URL:          res.URL,
+		SiteID:       res.lessonSite.ID,
+		SiteTitle:    res.lessonSite.Title,
+		Title:        res.Title,
+		SitePath:     res.Path(),
+		LastModified: res.LastModified,
+		Path:         f.path,
+		Size:         f.size,
+		DownloadedAt: time.Now(),
+		SHA256:       f.sha256,
+		ModTime:      f.modTime,
+	}
+}
+
+// outcome 一つのリソースのダウンロードの結果
+type outcome struct {
+	info Resource
+	// 保存したファイル
+	file  localFile
+	bytes int64
+	err   error
+}
+
+// downloadEvent ワーカーからダウンロードの進捗と結果を伝えるメッセージ
+type downloadEvent struct {
+	kind EventKind
+	info Resource
+	// 対象のファイルについて受信済みのバイト数
+	bytes int64
+	// 前回のイベントから増えた受信バイト数
+	delta int64
+	// FileCompleted, FileFailedの場合の結果
+	outcome outcome
+}
+
+// paraDownload 未取得のリソースを最大concurrency個ずつ並列にダウンロードする関数
+// 各ワーカーはファイルへの書き込みまで行い、進捗と結果のみをチャネルで送る
+func paraDownload(lic *pandaapi.LoggedInClient, resources []Resource, tracker *progressTracker, concurrency int) (outcomes []outcome) {
+	outcomes = make([]outcome, 0, len(resources))
 
 	var wg sync.WaitGroup
-	resultChan := make(chan result, len(sites))
+	events := make(chan downloadEvent, len(resources))
+	// 同時に行うダウンロードの数を制限する 枠はファイルを書き込み終えるまで保持する
+	sem := make(chan struct{}, concurrency)
 
-	for _, s := range sites {
+	for _, res := range resources {
 		wg.Add(1)
-		go func(s site) {
+		go func(lic *pandaapi.LoggedInClient, info Resource) {
 			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
 
-			resp, err := lic.FetchSiteResources(s.ID)
-			if err != nil {
-				resultChan <- result{resources: nil, s: s, err: err}
-				return
-			}
-			defer resp.Body.Close()
-
-			var w wrapper
-			if err := json.NewDecoder(resp.Body).Decode(&w); err != nil {
-				resultChan <- result{resources: nil, s: s, err: err}
-				return
-			}
-
-			resultChan <- result{resources: w.Collection, s: s, err: nil}
-		}(s)
+			events <- downloadEvent{kind: FileStarted, info: info}
+			events <- downloadOne(lic, info, events)
+		}(lic, res)
 	}
 
 	// 送信するものがなくなったらチャネルをクローズする
 	go func() {
 		wg.Wait()
-		close(resultChan)
+		close(events)
 	}()
 
-	dmap := readDownloadMap()
-	resources = make([]resource, 0, len(sites))
+	// ProgressFuncが一つのゴルーチンから呼ばれるよう、進捗の反映はここでのみ行う
+	for e := range events {
+		tracker.apply(e)
+		if e.kind == FileCompleted || e.kind == FileFailed {
+			outcomes = append(outcomes, e.outcome)
+		}
+	}
+	return
+}
 
-	for result := range resultChan {
+// downloadOne リソースをダウンロードして保存し、結果をFileCompletedもしくはFileFailedのイベントとして返す
+// 途中の進捗はeventsに送る
+func downloadOne(lic *pandaapi.LoggedInClient, info Resource, events chan<- downloadEvent) downloadEvent {
+	rc, _, err := lic.Open(context.Background(), pandaapi.Resource{URL: info.URL})
+	if err != nil {
+		return downloadEvent{kind: FileFailed, info: info, outcome: outcome{info: info, err: err}}
+	}
 
-		if result.err != nil {
-			return resources, err
-		}
-		for _, res := range result.resources {
-			if isRejectable(res.Type, reject) {
-				continue
-			}
-			res.lessonSite = result.s
-
-			resourceMap, ok := dmap[result.s.ID]
-			// ダウンロードしていない資料もしくは最終編集時刻が変更されているもののみダウンロード候補へ追加する
-			if !ok {
-				// サイトIDがダウンロードマップに存在しない場合(= その講義にはじめて資料が追加された)
-				resources = append(resources, res)
-				dmap[result.s.ID] = map[string]string{res.Title: res.LastModified}
-				continue
-			}
+	body := &countingReader{r: rc, res: info, events: events}
+	file, err := saveBody(rc, body, info)
+	if err != nil {
+		return downloadEvent{kind: FileFailed, info: info, bytes: body.n, delta: body.unreported(), outcome: outcome{info: info, bytes: body.n, err: err}}
+	}
 
-			if lastModified, ok := resourceMap[res.Title]; !ok || lastModified != res.LastModified {
-				// 資料名がダウンロードマップに登録されていない場合(= いままでにダウンロードされたことがない)
-				// もしくは最終編集時刻が過去のものと異なっている場合
-				resources = append(resources, res)
-				dmap[result.s.ID][res.Title] = res.LastModified
-			}
-		}
+	return downloadEvent{kind: FileCompleted, info: info, bytes: body.n, delta: body.unreported(), outcome: outcome{info: info, file: file, bytes: body.n}}
+}
+
+// saveBody bodyから読み込んだ内容を計画で決めた保存先に書き込み、rcを閉じる
+func saveBody(rc io.Closer, body io.Reader, info Resource) (localFile, error) {
+	defer rc.Close()
+
+	return writeTarget(info, body)
+}
+
+// fetchSiteResources 授業サイトに登録されているリソースの情報を取得する
+func fetchSiteResources(lic *pandaapi.LoggedInClient, s Site) ([]Resource, error) {
+	collection, err := lic.Resources(context.Background(), s.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := dmap.writeToFile(); err != nil {
-		return resources, err
+	resources := make([]Resource, 0, len(collection))
+	for _, r := range collection {
+		resources = append(resources, Resource{
+			Size:  r.Size,
+			Type:  r.Type,
+			Title: r.Title,
+			URL:   r.URL,
+			// 記録との比較にはPandAの返した表記をそのまま用いる
+			LastModified: r.Modified.Raw,
+			lessonSite:   s,
+		})
 	}
 
-	return
+	return resources, nil
 }
 
-// collectSites 現在受講中の講義の授業サイトに関する情報を収集
-func collectSites(lic *pandaapi.LoggedInClient) (sites []site, err error) {
-	// サイトの情報を取り出すための構造体
-	type wrapper struct {
-		Sites []site `json:"site_collection"`
+// collectSites ダウンロードの対象とする授業サイトに関する情報を収集 filterがnilの場合は現在受講中のもの
+func collectSites(lic *pandaapi.LoggedInClient, filter *SiteFilter) (sites []Site, err error) {
+	all, err := fetchAllSites(lic)
+	if err != nil {
+		return make([]Site, 0), err
 	}
 
-	sites = make([]site, 0)
+	return filter.apply(all), nil
+}
 
-	resp, err := lic.FetchAllSites()
+// fetchAllSites 過去のものも含めて全ての授業サイトに関する情報を取得
+func fetchAllSites(lic *pandaapi.LoggedInClient) (sites []Site, err error) {
+	all, err := lic.Sites(context.Background())
 	if err != nil {
-		return sites, err
+		return make([]Site, 0), err
 	}
-	defer resp.Body.Close()
 
-	var w wrapper
-	if err := json.NewDecoder(resp.Body).Decode(&w); err != nil {
-		return sites, err
+	sites = make([]Site, 0, len(all))
+	for _, s := range all {
+		sites = append(sites, Site{Title: s.Title, ID: s.ID})
 	}
 
+	return sites, nil
+}
+
+// filterCurrentSites 現在受講中の講義の授業サイトのみを取り出す
+func filterCurrentSites(all []Site) (sites []Site) {
+	sites = make([]Site, 0)
 	semesterText := makeSemesterDescription()
 
-	for _, s := range w.Sites {
+	for _, s := range all {
 		if strings.Contains(s.Title, semesterText) {
 			// 科目名に含まれる"2020前期"の部分で科目が現在受講中かどうかを判定する
 			sites = append(sites, s)
 		}
 	}
 
-	return sites, nil
+	return sites
 }
 
 // 科目名に含まれる "2020前期" の部分を作成する
@@ -309,39 +382,39 @@ func makeSemesterDescription() string {
 	return fmt.Sprint(year) + "後期"
 }
 
-// 与えられたContent-Typeが除外すべきかどうかを判定する
-func isRejectable(contentType string, reject *RejectableType) bool {
+// 与えられたContent-Typeを除外すべき場合はその理由を返す 除外しない場合は空文字列を返す
+func rejectReason(contentType string, reject *RejectableType) string {
 	if contentType == urlType {
 		// URLは必ず除外
-		return true
+		return ReasonURL
 	}
 
 	// MIMEタイプをtype/subtypeで分ける
 	s := strings.Split(contentType, "/")
 	if len(s) != 2 {
-		return true
+		return ReasonUnknownType
 	}
 	group, sub := s[0], s[1]
 
 	if reject.Video && group == "video" {
-		return true
+		return ReasonVideo
 	}
 
 	if reject.Audio && group == "audio" {
-		return true
+		return ReasonAudio
 	}
 
 	if reject.Excel && (sub == xls || sub == xlsx) {
-		return true
+		return ReasonExcel
 	}
 
 	if reject.PowerPoint && (sub == ppt || sub == pptx) {
-		return true
+		return ReasonPowerPoint
 	}
 
 	if reject.Word && (sub == doc || sub == docx) {
-		return true
+		return ReasonWord
 	}
 
-	return false
+	return ""
 }
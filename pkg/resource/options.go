@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"strings"
+
+	"pandora/pkg/config"
+	"pandora/pkg/layout"
+)
+
+const (
+	// 同時にダウンロードするファイル数の既定値
+	defaultConcurrency = 4
+)
+
+// Options ダウンロードの実行方法を指定する構造体 nilの場合は既定値を用いる
+type Options struct {
+	// 進捗イベントを受け取る関数
+	Progress ProgressFunc
+	// 同時にダウンロードするファイル数 0の場合は既定値を用いる
+	Concurrency int
+	// 対象とする授業サイト nilの場合は現在の学期の授業サイトを対象とする
+	Sites *SiteFilter
+	// 資料の保存先のテンプレート nilの場合はlayout.Defaultを用いる
+	Layout *layout.Template
+	// 保存先に既にファイルがある場合の対応 config.Conflict から始まる定数のいずれか 空の場合は上書きできるもののみ上書きする
+	OnConflict string
+	// OnConflictがconfig.ConflictAskの場合に対応を尋ねる関数 nilの場合は両方残し、尋ねなかったことをレポートに記録する
+	Ask AskFunc
+}
+
+// SiteFilter ダウンロードの対象とする授業サイトの指定
+// Include, ExcludeにはサイトのIDもしくはタイトルの一部を指定する
+type SiteFilter struct {
+	// 過去の学期の授業サイトも対象とする
+	AllTerms bool
+	// 学期に関わらず対象とする授業サイト
+	Include []string
+	// 対象としない授業サイト
+	Exclude []string
+}
+
+// NewOptions 設定ファイルの内容からOptionsを作成する
+func NewOptions(c *config.Config, progress ProgressFunc) *Options {
+	// 設定ファイルの読み込み時に検証されているため、失敗した場合は既定のテンプレートを用いる
+	tmpl, err := layout.Parse(c.Download.Template)
+	if err != nil {
+		tmpl = layout.MustParse(layout.Default)
+	}
+
+	return &Options{
+		Layout:      tmpl,
+		Progress:    progress,
+		Concurrency: c.Download.Concurrency,
+		OnConflict:  c.Download.OnConflict,
+		Sites: &SiteFilter{
+			AllTerms: c.Sites.Terms == config.TermsAll,
+			Include:  c.Sites.Include,
+			Exclude:  c.Sites.Exclude,
+		},
+	}
+}
+
+func (o *Options) concurrency() int {
+	if o == nil || o.Concurrency <= 0 {
+		return defaultConcurrency
+	}
+
+	return o.Concurrency
+}
+
+func (o *Options) layout() *layout.Template {
+	if o == nil || o.Layout == nil {
+		return layout.MustParse(layout.Default)
+	}
+
+	return o.Layout
+}
+
+func (o *Options) onConflict() string {
+	if o == nil || o.OnConflict == "" {
+		return config.ConflictOverwrite
+	}
+
+	return o.OnConflict
+}
+
+func (o *Options) sites() *SiteFilter {
+	if o == nil {
+		return nil
+	}
+
+	return o.Sites
+}
+
+// apply 全ての授業サイトから対象とするものを取り出す
+func (f *SiteFilter) apply(all []Site) []Site {
+	if f == nil {
+		return filterCurrentSites(all)
+	}
+
+	current := make(map[string]bool)
+	for _, s := range filterCurrentSites(all) {
+		current[s.ID] = true
+	}
+
+	sites := make([]Site, 0)
+	for _, s := range all {
+		if matchSite(s, f.Exclude) {
+			continue
+		}
+		if f.AllTerms || current[s.ID] || matchSite(s, f.Include) {
+			sites = append(sites, s)
+		}
+	}
+
+	return sites
+}
+
+// matchSite 授業サイトがIDもしくはタイトルの一部で指定されているかを判定する
+func matchSite(s Site, patterns []string) bool {
+	for _, p := range patterns {
+		if p == s.ID || (p != "" && strings.Contains(s.Title, p)) {
+			return true
+		}
+	}
+
+	return false
+}
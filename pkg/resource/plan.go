@@ -0,0 +1,299 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"pandora/pkg/dir"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/state"
+)
+
+// リソースがダウンロード対象から除外された理由
+const (
+	// URLへのリンク
+	ReasonURL = "url"
+	// 動画ファイル
+	ReasonVideo = "video"
+	// 音声ファイル
+	ReasonAudio = "audio"
+	// Excelファイル
+	ReasonExcel = "excel"
+	// PowerPointファイル
+	ReasonPowerPoint = "powerpoint"
+	// Wordファイル
+	ReasonWord = "word"
+	// Content-Typeが判別できない
+	ReasonUnknownType = "unknown type"
+)
+
+// Plan ダウンロードを実行した場合に行われる処理を表す構造体
+type Plan struct {
+	// 新たにダウンロードされるリソース
+	New []Resource
+	// サーバー上で更新されたため再度ダウンロードされるリソース
+	Updated []Resource
+	// 除外設定によってダウンロードされないリソース
+	Skipped []SkippedResource
+	// ダウンロード済みだがサーバー上から削除されたリソース
+	Removed []RemovedResource
+	// ダウンロード済みで変更のないリソースの数
+	Unchanged int
+	// ダウンロードされるリソースの合計サイズ(バイト)
+	TotalBytes int64
+	// 保存先が他の資料と重なったため名前を変えて保存するリソース
+	Collisions []Collision
+	// 資料の一覧を取得できなかったため、今回は対象としない授業サイト
+	SiteErrors []SiteError
+
+	// 計画を立てる際に用いたダウンロードの記録
+	store *state.Store
+	// 旧形式の記録と一致したため、URLと保存先を記録し直すリソース
+	adopted []Resource
+}
+
+// SkippedResource 除外設定によってダウンロードされないリソース
+type SkippedResource struct {
+	Resource
+	// 除外された理由 Reason から始まる定数のいずれか
+	Reason string
+}
+
+// SiteError 授業サイトの資料の一覧を取得できなかったときのエラー
+type SiteError struct {
+	Site Site
+	Err  error
+}
+
+func (s *SiteError) Error() string {
+	return fmt.Sprintf("%s: %s", s.Site.Title, s.Err)
+}
+
+func (s *SiteError) Unwrap() error {
+	return s.Err
+}
+
+// RemovedResource ダウンロード済みだがサーバー上から削除されたリソース
+// ダウンロード済みのファイルは削除せず、記録の削除は state prune で行う
+type RemovedResource struct {
+	Site         Site
+	Title        string
+	LastModified string
+	// 保存したファイルのパス 分からない場合は空
+	Path string
+}
+
+// Downloads 計画の中でダウンロードされるリソースの一覧を返す
+func (p *Plan) Downloads() []Resource {
+	resources := make([]Resource, 0, len(p.New)+len(p.Updated))
+	resources = append(resources, p.New...)
+	return append(resources, p.Updated...)
+}
+
+// IsEmpty ダウンロードされるリソースがない場合にtrueを返す
+func (p *Plan) IsEmpty() bool {
+	return len(p.New) == 0 && len(p.Updated) == 0
+}
+
+// Summary 計画の概要を一行で返す
+func (p *Plan) Summary() string {
+	summary := fmt.Sprintf(
+		"%d new, %d updated, %d skipped, %d removed on server (%s)",
+		len(p.New), len(p.Updated), len(p.Skipped), len(p.Removed), FormatSize(p.TotalBytes),
+	)
+	if len(p.SiteErrors) > 0 {
+		summary += fmt.Sprintf(", %d site(s) could not be checked", len(p.SiteErrors))
+	}
+
+	return summary
+}
+
+// MakePlan 対象とする授業サイトについてダウンロードの計画を立てる
+// ファイルやダウンロードの記録への書き込みは一切行わない
+// 一部の授業サイトの資料の一覧を取得できなかった場合はそのサイトを除いて計画を立て、Plan.SiteErrorsに記録する
+// 全ての授業サイトについて取得できなかった場合はエラーを返す
+func MakePlan(lic *pandaapi.LoggedInClient, reject *RejectableType, opts *Options) (*Plan, error) {
+	store, err := state.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	sites, err := collectSites(lic, opts.sites())
+	if err != nil {
+		return nil, err
+	}
+
+	siteResources, siteErrors := collectSiteResources(sites, func(s Site) ([]Resource, error) {
+		return fetchSiteResources(lic, s)
+	})
+	if len(sites) > 0 && len(siteErrors) == len(sites) {
+		return nil, siteErrors[0].Err
+	}
+
+	plan := makePlan(sites, siteResources, store, reject, newTargets(dir.PandorAPath(), opts.layout(), store))
+	plan.SiteErrors = siteErrors
+
+	return plan, nil
+}
+
+// makePlan 取得したリソースの情報とダウンロードの記録を比較して計画を立てる
+func makePlan(sites []Site, siteResources map[string][]Resource, store *state.Store, reject *RejectableType, t *targets) *Plan {
+	plan := &Plan{
+		New:        make([]Resource, 0),
+		Updated:    make([]Resource, 0),
+		Skipped:    make([]SkippedResource, 0),
+		Removed:    make([]RemovedResource, 0),
+		Collisions: make([]Collision, 0),
+		SiteErrors: make([]SiteError, 0),
+		store:      store,
+		adopted:    make([]Resource, 0),
+	}
+
+	for _, s := range sites {
+		// 資料の一覧を取得できなかった授業サイトは、記録をサーバー上から削除されたものとみなさないよう除く
+		if _, ok := siteResources[s.ID]; !ok {
+			continue
+		}
+
+		onServer := make(map[string]bool, len(siteResources[s.ID]))
+
+		for _, res := range siteResources[s.ID] {
+			onServer[res.URL] = true
+			onServer[legacyTitle(res.Title)] = true
+
+			if reason := rejectReason(res.Type, reject); reason != "" {
+				plan.Skipped = append(plan.Skipped, SkippedResource{Resource: res, Reason: reason})
+				continue
+			}
+
+			// ダウンロードしていない資料もしくは最終編集時刻が変更されているもののみダウンロードする
+			rec, ok := store.Lookup(res.URL, s.ID, res.Title)
+			switch {
+			case !ok:
+				// いままでにダウンロードされたことがない資料
+				plan.assign(res, t, &plan.New)
+			case rec.LastModified != res.LastModified:
+				// 最終編集時刻が過去のものと異なっている場合は以前と同じ場所に保存する
+				if rec.Path != "" {
+					res.target = rec.Path
+					plan.Updated = append(plan.Updated, res)
+				} else {
+					plan.assign(res, t, &plan.Updated)
+				}
+			default:
+				plan.Unchanged++
+				if rec.Legacy() {
+					// 旧形式の記録は、テンプレートから決まる場所にファイルがあればそれを保存先として記録し直す
+					if p, collided := t.assign(t.render(res.vars()), res.URL); collided == "" && dir.Exists(p) {
+						res.target = p
+					}
+					plan.adopted = append(plan.adopted, res)
+				}
+				continue
+			}
+			plan.TotalBytes += res.Size
+		}
+
+		for _, rec := range store.SiteRecords(s.ID) {
+			key := rec.URL
+			if rec.Legacy() {
+				key = legacyTitle(rec.Title)
+			}
+			if !onServer[key] {
+				plan.Removed = append(plan.Removed, RemovedResource{Site: s, Title: rec.Title, LastModified: rec.LastModified, Path: rec.Path})
+			}
+		}
+	}
+
+	sort.Slice(plan.Removed, func(i, j int) bool {
+		if plan.Removed[i].Site.ID != plan.Removed[j].Site.ID {
+			return plan.Removed[i].Site.ID < plan.Removed[j].Site.ID
+		}
+		return plan.Removed[i].Title < plan.Removed[j].Title
+	})
+
+	return plan
+}
+
+// assign リソースの保存先を決めてlistに加える
+func (p *Plan) assign(res Resource, t *targets, list *[]Resource) {
+	rendered := t.render(res.vars())
+	var collided string
+	res.target, collided = t.assign(rendered, res.URL)
+	if collided != "" {
+		p.Collisions = append(p.Collisions, Collision{Resource: res, Path: collided, Renamed: res.target})
+	}
+
+	*list = append(*list, res)
+}
+
+// legacyTitle 旧形式の記録と照合するためのキー URLと重ならないよう接頭辞をつける
+func legacyTitle(title string) string {
+	return "title:" + title
+}
+
+// collectSiteResources 授業サイトごとのリソースの情報をfetchで並列に取得する
+// 取得できなかった授業サイトは結果に含めず、サイトの順にエラーを返す
+func collectSiteResources(sites []Site, fetch func(Site) ([]Resource, error)) (map[string][]Resource, []SiteError) {
+	// 取得したリソースとエラーをどちらも呼び出し側で扱うための構造体
+	type result struct {
+		resources []Resource
+		s         Site
+		err       error
+	}
+
+	var wg sync.WaitGroup
+	resultChan := make(chan result, len(sites))
+
+	for _, s := range sites {
+		wg.Add(1)
+		go func(s Site) {
+			defer wg.Done()
+
+			resources, err := fetch(s)
+			resultChan <- result{resources: resources, s: s, err: err}
+		}(s)
+	}
+
+	// 送信するものがなくなったらチャネルをクローズする
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	siteResources := make(map[string][]Resource, len(sites))
+	failed := make(map[string]error)
+	for result := range resultChan {
+		if result.err != nil {
+			failed[result.s.ID] = result.err
+			continue
+		}
+		siteResources[result.s.ID] = result.resources
+	}
+
+	siteErrors := make([]SiteError, 0, len(failed))
+	for _, s := range sites {
+		if err, ok := failed[s.ID]; ok {
+			siteErrors = append(siteErrors, SiteError{Site: s, Err: err})
+		}
+	}
+
+	return siteResources, siteErrors
+}
+
+// FormatSize バイト数を読みやすい形式に変換する
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,223 @@
+package resource
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pandora/pkg/dir"
+	"pandora/pkg/layout"
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/state"
+)
+
+const testGroupURL = "https://panda.ecs.kyoto-u.ac.jp/access/content/group/"
+
+func testResource(s Site, sitePath, typ, lastModified string, size int64) Resource {
+	return Resource{
+		Title:        filepath.Base(sitePath),
+		URL:          testGroupURL + s.ID + "/" + sitePath,
+		Type:         typ,
+		Size:         size,
+		LastModified: lastModified,
+		lessonSite:   s,
+	}
+}
+
+func TestMakePlan(t *testing.T) {
+	s := Site{ID: "site1", Title: "[2020前期月２]線形代数学"}
+	resources := map[string][]Resource{
+		s.ID: {
+			testResource(s, "new.pdf", "application/pdf", "2", 100),
+			testResource(s, "updated.pdf", "application/pdf", "3", 200),
+			testResource(s, "same.pdf", "application/pdf", "1", 400),
+			testResource(s, "legacy.pdf", "application/pdf", "1", 400),
+			testResource(s, "lecture.mp4", "video/mp4", "1", 800),
+			{Title: "link", Type: urlType, LastModified: "1", lessonSite: s},
+		},
+	}
+
+	store := state.New()
+	store.Put(state.Record{URL: testGroupURL + "site1/updated.pdf", SiteID: s.ID, Title: "updated.pdf", LastModified: "1", Path: "/old/updated.pdf"})
+	store.Put(state.Record{URL: testGroupURL + "site1/same.pdf", SiteID: s.ID, Title: "same.pdf", LastModified: "1"})
+	store.Put(state.Record{URL: testGroupURL + "site1/deleted.pdf", SiteID: s.ID, Title: "deleted.pdf", LastModified: "1"})
+	// 旧バージョンのダウンロードマップから移行した記録
+	store.Put(state.Record{SiteID: s.ID, Title: "legacy.pdf", LastModified: "1"})
+	store.Put(state.Record{SiteID: s.ID, Title: "legacy-deleted.pdf", LastModified: "1"})
+	reject := &RejectableType{Video: true}
+
+	root := filepath.FromSlash("/root/PandorA Box")
+	plan := makePlan([]Site{s}, resources, store, reject, newTargets(root, layout.MustParse(layout.Default), store))
+
+	if len(plan.New) != 1 || plan.New[0].Title != "new.pdf" {
+		t.Errorf("new: %+v", plan.New)
+	}
+	if want := filepath.Join(root, s.Title, "new.pdf"); plan.New[0].Target() != want {
+		t.Errorf("target: got %s, want %s", plan.New[0].Target(), want)
+	}
+	if len(plan.Updated) != 1 || plan.Updated[0].Title != "updated.pdf" || plan.Updated[0].Target() != "/old/updated.pdf" {
+		t.Errorf("updated: %+v", plan.Updated)
+	}
+	if len(plan.Skipped) != 2 || plan.Skipped[0].Reason != ReasonVideo || plan.Skipped[1].Reason != ReasonURL {
+		t.Errorf("skipped: %+v", plan.Skipped)
+	}
+	if len(plan.Removed) != 2 || plan.Removed[0].Title != "deleted.pdf" || plan.Removed[1].Title != "legacy-deleted.pdf" {
+		t.Errorf("removed: %+v", plan.Removed)
+	}
+	if plan.Unchanged != 2 || len(plan.adopted) != 1 || plan.adopted[0].Title != "legacy.pdf" {
+		t.Errorf("unchanged: %d, adopted: %+v", plan.Unchanged, plan.adopted)
+	}
+	if plan.TotalBytes != 300 {
+		t.Errorf("total bytes: %d", plan.TotalBytes)
+	}
+}
+
+// テンプレートから決まる保存先が重なる場合は名前を変える
+func TestMakePlanCollisions(t *testing.T) {
+	s := Site{ID: "site1", Title: "[2020前期月２]線形代数学"}
+	resources := map[string][]Resource{
+		s.ID: {
+			testResource(s, "第1回/slides.pdf", "application/pdf", "1", 1),
+			testResource(s, "第2回/slides.pdf", "application/pdf", "1", 1),
+			testResource(s, "第3回/Slides.pdf", "application/pdf", "1", 1),
+		},
+	}
+
+	root := "/lib"
+	store := state.New()
+	plan := makePlan([]Site{s}, resources, store, &RejectableType{}, newTargets(root, layout.MustParse("{course_title}/{filename}"), store))
+
+	want := []string{"/lib/線形代数学/slides.pdf", "/lib/線形代数学/slides (2).pdf", "/lib/線形代数学/Slides (3).pdf"}
+	for i, res := range plan.New {
+		if res.Target() != filepath.FromSlash(want[i]) {
+			t.Errorf("%d: got %s, want %s", i, res.Target(), want[i])
+		}
+	}
+	if len(plan.Collisions) != 2 {
+		t.Errorf("collisions: %+v", plan.Collisions)
+	}
+
+	// フォルダを含むテンプレートでは重ならない
+	plan = makePlan([]Site{s}, resources, store, &RejectableType{}, newTargets(root, layout.MustParse("{course_title}/{folder}/{filename}"), store))
+	if len(plan.Collisions) != 0 || plan.New[1].Target() != filepath.FromSlash("/lib/線形代数学/第2回/slides.pdf") {
+		t.Errorf("unexpected collisions: %+v", plan.Collisions)
+	}
+}
+
+// 資料の一覧を取得できなかった授業サイトは除いて計画を立て、記録を削除されたものとみなさない
+func TestPartialFailure(t *testing.T) {
+	ok := Site{ID: "site1", Title: "線形代数学"}
+	down := Site{ID: "site2", Title: "微分積分学"}
+	forbidden := Site{ID: "site3", Title: "物理学基礎論"}
+	offline := &pandaapi.NetworkError{Err: errors.New("network is unreachable")}
+
+	siteResources, siteErrors := collectSiteResources([]Site{ok, down, forbidden}, func(s Site) ([]Resource, error) {
+		switch s.ID {
+		case down.ID:
+			return nil, offline
+		case forbidden.ID:
+			return nil, &pandaapi.StatusError{StatusCode: 403, SiteID: s.ID}
+		}
+		return []Resource{testResource(s, "new.pdf", "application/pdf", "1", 100)}, nil
+	})
+
+	if len(siteResources) != 1 || len(siteResources[ok.ID]) != 1 {
+		t.Fatalf("resources: %+v", siteResources)
+	}
+	if len(siteErrors) != 2 || siteErrors[0].Site.ID != down.ID || siteErrors[1].Site.ID != forbidden.ID {
+		t.Fatalf("site errors: %+v", siteErrors)
+	}
+	if !errors.Is(&siteErrors[0], pandaapi.ClassNetwork) || !errors.Is(&siteErrors[1], pandaapi.ClassForbidden) {
+		t.Errorf("errors are not classified: %v, %v", &siteErrors[0], &siteErrors[1])
+	}
+
+	store := state.New()
+	store.Put(state.Record{URL: testGroupURL + "site2/slides.pdf", SiteID: down.ID, Title: "slides.pdf", LastModified: "1"})
+	plan := makePlan([]Site{ok, down, forbidden}, siteResources, store, &RejectableType{}, newTargets("/lib", layout.MustParse(layout.Default), store))
+	plan.SiteErrors = siteErrors
+
+	if len(plan.New) != 1 || len(plan.Removed) != 0 {
+		t.Errorf("new: %+v, removed: %+v", plan.New, plan.Removed)
+	}
+
+	r := newReport(plan, time.Now())
+	r.finish()
+	if len(r.Errors) != 2 || r.Errors[0].Kind != ErrorKindNetwork || r.Errors[1].Kind != ErrorKindPandA {
+		t.Errorf("errors: %+v", r.Errors)
+	}
+	for _, s := range r.Sites {
+		if s.Error == "" {
+			t.Errorf("site error is not reported: %+v", s)
+		}
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-relocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	oldRoot := filepath.Join(tmp, "PandorA Box")
+	newRoot := filepath.Join(tmp, "Library")
+	site := "[2020前期月２]線形代数学"
+
+	write := func(p string) {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := state.New()
+	for _, name := range []string{"slides.pdf", "notes.pdf"} {
+		p := filepath.Join(oldRoot, site, name)
+		write(p)
+		store.Put(state.Record{URL: testGroupURL + "2020-110-7081-000/第1回/" + name, SiteID: "2020-110-7081-000", SiteTitle: site, Title: name, SitePath: "第1回/" + name, Path: p})
+	}
+	store.Put(state.Record{URL: testGroupURL + "x/missing.pdf", SiteID: "x", SiteTitle: "x", Title: "missing.pdf", Path: filepath.Join(oldRoot, "x", "missing.pdf")})
+	store.Put(state.Record{SiteID: "x", Title: "legacy.pdf"})
+
+	tmpl := layout.MustParse("{year}/{term}/{course_code} {course_title}/{folder}/{filename}")
+
+	dry := relocate(store, newRoot, tmpl, true)
+	if len(dry.Moves) != 2 || dry.Missing != 1 || dry.Unknown != 1 {
+		t.Fatalf("dry run: %+v", dry)
+	}
+	if !dir.Exists(filepath.Join(oldRoot, site, "slides.pdf")) {
+		t.Fatal("dry run moved a file")
+	}
+
+	result := relocate(store, newRoot, tmpl, false)
+	if result.Failed() != 0 {
+		t.Fatalf("moves failed: %+v", result.Moves)
+	}
+	for _, m := range result.Moves {
+		removeEmptyDirs(filepath.Dir(m.From), oldRoot)
+	}
+
+	want := filepath.Join(newRoot, "2020", "前期", "110-7081 線形代数学", "第1回", "slides.pdf")
+	if !dir.Exists(want) {
+		t.Errorf("%s does not exist", want)
+	}
+	if rec, _ := store.Lookup(testGroupURL+"2020-110-7081-000/第1回/slides.pdf", "", ""); rec.Path != want {
+		t.Errorf("record is not updated: %s", rec.Path)
+	}
+	if dir.Exists(filepath.Join(oldRoot, site)) {
+		t.Error("empty course folder is left")
+	}
+	if !dir.Exists(oldRoot) {
+		t.Error("the old root should not be removed")
+	}
+
+	// もう一度実行しても何も移動しない
+	if again := relocate(store, newRoot, tmpl, false); len(again.Moves) != 0 || again.Unchanged != 2 {
+		t.Errorf("second run: %+v", again)
+	}
+}
@@ -0,0 +1,172 @@
+package resource
+
+import (
+	"io"
+	"time"
+)
+
+// EventKind 進捗イベントの種類
+type EventKind int
+
+const (
+	// FileStarted ファイルのダウンロードを開始した
+	FileStarted EventKind = iota
+	// FileProgress ファイルのデータを受信した
+	FileProgress
+	// FileCompleted ファイルのダウンロードが完了した
+	FileCompleted
+	// FileFailed ファイルのダウンロードに失敗した
+	FileFailed
+	// Finished 全てのダウンロードが終了した
+	Finished
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case FileStarted:
+		return "started"
+	case FileProgress:
+		return "progress"
+	case FileCompleted:
+		return "completed"
+	case FileFailed:
+		return "failed"
+	case Finished:
+		return "finished"
+	}
+
+	return "unknown"
+}
+
+// Totals ダウンロード全体の進捗
+type Totals struct {
+	// ダウンロードするファイルの数
+	Files int
+	// ダウンロードが完了したファイルの数
+	Completed int
+	// ダウンロードに失敗したファイルの数
+	Failed int
+	// ダウンロードするファイルの合計サイズ(バイト) PandAの返すサイズによるため目安
+	Bytes int64
+	// 受信済みのバイト数
+	Transferred int64
+}
+
+// Done 完了もしくは失敗したファイルの数を返す
+func (t Totals) Done() int {
+	return t.Completed + t.Failed
+}
+
+// ProgressEvent ダウンロードの進捗を表すイベント
+type ProgressEvent struct {
+	Kind EventKind
+	// イベントの対象となるリソース Finishedの場合はゼロ値
+	Resource Resource
+	// 対象のファイルについて受信済みのバイト数
+	Bytes int64
+	// FileFailedの場合の失敗の原因
+	Err error
+	// イベント発生時点での全体の進捗
+	Totals Totals
+}
+
+// ProgressFunc 進捗イベントを受け取る関数
+// 一回のダウンロードの中では一つのゴルーチンから順番に呼び出される
+type ProgressFunc func(ProgressEvent)
+
+const (
+	// FileProgressイベントを送る最短の間隔
+	progressInterval = 200 * time.Millisecond
+)
+
+// progressTracker 全体の進捗を保持してイベントを送る
+type progressTracker struct {
+	fn     ProgressFunc
+	totals Totals
+}
+
+func newProgressTracker(opts *Options, resources []Resource) *progressTracker {
+	t := &progressTracker{totals: Totals{Files: len(resources)}}
+	for _, res := range resources {
+		t.totals.Bytes += res.Size
+	}
+
+	if opts != nil {
+		t.fn = opts.Progress
+	}
+
+	return t
+}
+
+func (t *progressTracker) send(kind EventKind, res Resource, bytes int64, err error) {
+	if t.fn == nil {
+		return
+	}
+
+	t.fn(ProgressEvent{Kind: kind, Resource: res, Bytes: bytes, Err: err, Totals: t.totals})
+}
+
+// apply ワーカーから届いたイベントを全体の進捗に反映して送る
+func (t *progressTracker) apply(e downloadEvent) {
+	t.totals.Transferred += e.delta
+
+	switch e.kind {
+	case FileStarted:
+		t.started(e.info)
+	case FileProgress:
+		t.send(FileProgress, e.info, e.bytes, nil)
+	case FileCompleted:
+		t.completed(e.info, e.bytes)
+	case FileFailed:
+		t.failed(e.info, e.bytes, e.outcome.err)
+	}
+}
+
+func (t *progressTracker) started(res Resource) {
+	t.send(FileStarted, res, 0, nil)
+}
+
+func (t *progressTracker) completed(res Resource, bytes int64) {
+	t.totals.Completed++
+	t.send(FileCompleted, res, bytes, nil)
+}
+
+func (t *progressTracker) failed(res Resource, bytes int64, err error) {
+	t.totals.Failed++
+	t.send(FileFailed, res, bytes, err)
+}
+
+func (t *progressTracker) finished() {
+	t.send(Finished, Resource{}, 0, nil)
+}
+
+// countingReader 受信したバイト数を数え、一定の間隔でFileProgressイベントをeventsに送るio.Reader
+// ワーカーのゴルーチンで読み込み、全体の進捗への反映はeventsを受け取る側で行う
+type countingReader struct {
+	r      io.Reader
+	res    Resource
+	events chan<- downloadEvent
+	n      int64
+	// イベントで知らせたバイト数
+	reported int64
+	lastSent time.Time
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	if now := time.Now(); n > 0 && now.Sub(c.lastSent) >= progressInterval {
+		c.lastSent = now
+		c.events <- downloadEvent{kind: FileProgress, info: c.res, bytes: c.n, delta: c.unreported()}
+	}
+
+	return n, err
+}
+
+// unreported まだイベントで知らせていない受信バイト数を返し、知らせたものとして扱う
+func (c *countingReader) unreported() int64 {
+	delta := c.n - c.reported
+	c.reported = c.n
+	return delta
+}
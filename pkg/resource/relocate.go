@@ -0,0 +1,147 @@
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pandora/pkg/dir"
+	"pandora/pkg/layout"
+	"pandora/pkg/state"
+)
+
+// Move 資料のファイルの移動
+type Move struct {
+	SiteTitle string `json:"siteTitle"`
+	Title     string `json:"title"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	// 移動に失敗した理由 成功した場合は空
+	Error string `json:"error,omitempty"`
+}
+
+// RelocateResult 資料の保存先を移動した結果
+type RelocateResult struct {
+	Moves []Move `json:"moves"`
+	// 既に新しい保存先にある資料の数
+	Unchanged int `json:"unchanged"`
+	// 保存先が記録されていないため移動できない資料の数
+	Unknown int `json:"unknown"`
+	// 記録された保存先にファイルが存在しない資料の数
+	Missing int `json:"missing"`
+}
+
+// Failed 移動に失敗したファイルの数を返す
+func (r *RelocateResult) Failed() int {
+	n := 0
+	for _, m := range r.Moves {
+		if m.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Relocate 記録されている資料を、新しい保存先のフォルダrootとテンプレートから決まる場所へ移動し、記録を書き換える
+// oldRootは移動後に空になったフォルダを削除する範囲 移動先に別のファイルがある場合は移動しない
+// dryRunがtrueの場合は移動先を計算するだけでファイルの移動や記録の書き換えは行わない
+func Relocate(oldRoot, root string, tmpl *layout.Template, dryRun bool) (*RelocateResult, error) {
+	store, err := state.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	result := relocate(store, root, tmpl, dryRun)
+	if dryRun {
+		return result, nil
+	}
+
+	for _, m := range result.Moves {
+		if m.Error == "" {
+			removeEmptyDirs(filepath.Dir(m.From), oldRoot)
+		}
+	}
+
+	return result, store.Save()
+}
+
+func relocate(store *state.Store, root string, tmpl *layout.Template, dryRun bool) *RelocateResult {
+	result := &RelocateResult{Moves: make([]Move, 0)}
+
+	// 移動しない資料のパスを先に使用中にしておく
+	t := &targets{root: root, tmpl: tmpl, taken: make(map[string]string)}
+	records := make([]state.Record, 0)
+	for _, rec := range store.Records() {
+		switch {
+		case rec.Path == "" || rec.SiteTitle == "":
+			result.Unknown++
+		case !dir.Exists(rec.Path):
+			result.Missing++
+			t.taken[state.PathKey(rec.Path)] = rec.URL
+		default:
+			records = append(records, rec)
+		}
+	}
+
+	for _, rec := range records {
+		to, _ := t.assign(t.render(recordVars(rec)), rec.URL)
+		if state.PathKey(to) == state.PathKey(rec.Path) {
+			result.Unchanged++
+			continue
+		}
+
+		m := Move{SiteTitle: rec.SiteTitle, Title: rec.Title, From: rec.Path, To: to}
+		switch {
+		case dir.Exists(to) && !sameFile(rec.Path, to):
+			m.Error = "destination already exists"
+		case !dryRun:
+			if err := dir.MoveFile(rec.Path, to); err != nil {
+				m.Error = err.Error()
+			} else {
+				rec.Path = to
+				store.Put(rec)
+			}
+		}
+
+		result.Moves = append(result.Moves, m)
+	}
+
+	sort.SliceStable(result.Moves, func(i, j int) bool {
+		return result.Moves[i].From < result.Moves[j].From
+	})
+
+	return result
+}
+
+// sameFile 大文字と小文字だけが異なるパスなど、二つのパスが同じファイルを指しているかを判定する
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(ai, bi)
+}
+
+// removeEmptyDirs folderからrootの直下まで、空になったフォルダを削除する rootの外のフォルダには触れない
+func removeEmptyDirs(folder, root string) {
+	root = filepath.Clean(root)
+	for {
+		folder = filepath.Clean(folder)
+		rel, err := filepath.Rel(root, folder)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+
+		// 空でないフォルダの削除は失敗する
+		if err := os.Remove(folder); err != nil {
+			return
+		}
+		folder = filepath.Dir(folder)
+	}
+}
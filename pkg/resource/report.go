@@ -0,0 +1,459 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pandaapi "pandora/pkg/pandaAPI"
+	"pandora/pkg/secret"
+)
+
+const (
+	// レポートを保存するファイルの名前(拡張子を除く)
+	reportFilename = "last-report"
+)
+
+// エラーの分類
+const (
+	// ネットワークの接続状態のエラー
+	ErrorKindNetwork = "network"
+	// PandAのサーバーのエラー
+	ErrorKindPandA = "panda"
+	// ログインの失敗
+	ErrorKindLogin = "login"
+	// ファイルの書き込みのエラー
+	ErrorKindFile = "file"
+	// その他のエラー
+	ErrorKindOther = "other"
+)
+
+// SyncReport 一回のダウンロードの結果をまとめたレポート
+type SyncReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// 新たにダウンロードしたファイルの数
+	New int `json:"new"`
+	// 更新されたため再度ダウンロードしたファイルの数
+	Updated int `json:"updated"`
+	// 除外設定によってダウンロードしなかったファイルの数
+	Skipped int `json:"skipped"`
+	// ダウンロードに失敗したファイルの数
+	Failed int `json:"failed"`
+	// サーバー上から削除されたファイルの数
+	Removed int `json:"removed"`
+	// ダウンロードしたバイト数
+	Bytes int64 `json:"bytes"`
+	// 授業サイトごとの内訳
+	Sites []SiteReport `json:"sites"`
+	// ダウンロードしたファイルの一覧
+	Files []FileReport `json:"files"`
+	// 保存先に既にファイルがあったため、上書きしなかったファイルの一覧
+	Conflicts []ConflictReport `json:"conflicts"`
+	// 種類ごとにまとめたエラー
+	Errors []ErrorGroup `json:"errors"`
+}
+
+// SiteReport 授業サイトごとのダウンロード結果
+type SiteReport struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	New     int    `json:"new"`
+	Updated int    `json:"updated"`
+	Skipped int    `json:"skipped"`
+	Failed  int    `json:"failed"`
+	Removed int    `json:"removed"`
+	Bytes   int64  `json:"bytes"`
+	// 資料の一覧を取得できなかった場合のエラー
+	Error string `json:"error,omitempty"`
+}
+
+// FileReport ダウンロードしたファイルの情報
+type FileReport struct {
+	SiteID    string `json:"siteID"`
+	SiteTitle string `json:"siteTitle"`
+	Title     string `json:"title"`
+	Path      string `json:"path"`
+	// 保存したファイルのパス
+	Local   string `json:"local"`
+	Size    int64  `json:"size"`
+	Updated bool   `json:"updated"`
+}
+
+// ConflictReport 保存先に既にファイルがあったため、上書きしなかったファイルの情報
+type ConflictReport struct {
+	SiteID    string `json:"siteID"`
+	SiteTitle string `json:"siteTitle"`
+	Title     string `json:"title"`
+	Path      string `json:"path"`
+	// 既にあったファイルのパス
+	Existing string `json:"existing"`
+	// 新しく保存したファイルのパス ダウンロードしなかった場合は空
+	Saved string `json:"saved,omitempty"`
+	// 行った対応 config.ConflictKeepBoth もしくは config.ConflictSkip
+	Action string `json:"action"`
+	// 既にあったファイルがユーザーによって作成もしくは変更されたものの場合にtrue
+	Modified bool `json:"modified"`
+	// サーバー上で資料が更新された場合にtrue
+	Updated bool `json:"updated"`
+	// on_conflict: askだが尋ねる手段がなかったため、尋ねずに両方残した場合にtrue
+	Unasked bool `json:"unasked,omitempty"`
+}
+
+// IsEditConflict 手元で書き込みなどをしたファイルがサーバー上で更新されたかどうか
+func (c *ConflictReport) IsEditConflict() bool {
+	return c.Modified && c.Updated
+}
+
+// ErrorGroup 同じ種類のエラーをまとめたもの
+type ErrorGroup struct {
+	// ErrorKind から始まる定数のいずれか
+	Kind string `json:"kind"`
+	// 代表的なエラーメッセージ
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	// エラーが起きたファイル(授業サイト名/資料名)
+	Files []string `json:"files"`
+}
+
+// HasErrors ダウンロードに失敗したファイルもしくはその他のエラーがある場合にtrueを返す
+func (r *SyncReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// Unasked on_conflict: askだが尋ねる手段がなかったため、尋ねずに両方残した数を返す
+func (r *SyncReport) Unasked() int {
+	n := 0
+	for i := range r.Conflicts {
+		if r.Conflicts[i].Unasked {
+			n++
+		}
+	}
+	return n
+}
+
+// EditConflicts 手元で変更したファイルがサーバー上で更新された数を返す
+func (r *SyncReport) EditConflicts() int {
+	n := 0
+	for i := range r.Conflicts {
+		if r.Conflicts[i].IsEditConflict() {
+			n++
+		}
+	}
+	return n
+}
+
+// Downloaded ダウンロードしたファイルの数を返す
+func (r *SyncReport) Downloaded() int {
+	return r.New + r.Updated
+}
+
+// Summary 通知に用いるレポートの概要を返す
+func (r *SyncReport) Summary() string {
+	var b strings.Builder
+
+	switch {
+	case r.Downloaded() == 0 && r.Failed == 0:
+		b.WriteString("Everything is up to date.")
+	case r.Downloaded() == 0:
+		b.WriteString("No files were downloaded.")
+	default:
+		courses := 0
+		for _, s := range r.Sites {
+			if s.New+s.Updated > 0 {
+				courses++
+			}
+		}
+		fmt.Fprintf(&b, "%d new and %d updated file(s) in %d course(s) (%s).", r.New, r.Updated, courses, FormatSize(r.Bytes))
+	}
+
+	if r.Failed > 0 {
+		fmt.Fprintf(&b, "\n%d file(s) failed", r.Failed)
+		kinds := make([]string, 0, len(r.Errors))
+		for _, g := range r.Errors {
+			kinds = append(kinds, fmt.Sprintf("%s: %d", g.Kind, g.Count))
+		}
+		fmt.Fprintf(&b, " (%s).", strings.Join(kinds, ", "))
+	} else if r.HasErrors() {
+		b.WriteString("\n" + r.Errors[0].Message)
+	}
+
+	if n := r.EditConflicts(); n > 0 {
+		fmt.Fprintf(&b, "\n%d file(s) you edited were updated on the server; the new versions were saved alongside.", n)
+	} else if len(r.Conflicts) > 0 {
+		fmt.Fprintf(&b, "\n%d existing file(s) were not overwritten.", len(r.Conflicts))
+	}
+	if n := r.Unasked(); n > 0 {
+		fmt.Fprintf(&b, "\non_conflict is \"ask\" but there was no way to ask; both versions of %d file(s) were kept.", n)
+	}
+
+	return b.String()
+}
+
+// newReport 計画をもとにレポートを作成する
+func newReport(plan *Plan, started time.Time) *SyncReport {
+	r := &SyncReport{
+		StartedAt: started,
+		Skipped:   len(plan.Skipped),
+		Removed:   len(plan.Removed),
+		Sites:     make([]SiteReport, 0),
+		Files:     make([]FileReport, 0),
+		Conflicts: make([]ConflictReport, 0),
+		Errors:    make([]ErrorGroup, 0),
+	}
+
+	for _, s := range plan.Skipped {
+		r.site(s.lessonSite).Skipped++
+	}
+	for _, rm := range plan.Removed {
+		r.site(rm.Site).Removed++
+	}
+	for _, e := range plan.SiteErrors {
+		r.site(e.Site).Error = secret.Redact(e.Err.Error())
+		r.addError(e.Err, e.Site.Title)
+	}
+
+	return r
+}
+
+// site 授業サイトの内訳を返す 存在しない場合は追加する
+func (r *SyncReport) site(s Site) *SiteReport {
+	for i := range r.Sites {
+		if r.Sites[i].ID == s.ID {
+			return &r.Sites[i]
+		}
+	}
+
+	r.Sites = append(r.Sites, SiteReport{ID: s.ID, Title: s.Title})
+	return &r.Sites[len(r.Sites)-1]
+}
+
+// addDownloaded ダウンロードに成功したファイルを記録する
+func (r *SyncReport) addDownloaded(res Resource, local string, bytes int64, updated bool) {
+	s := r.site(res.lessonSite)
+	if updated {
+		r.Updated++
+		s.Updated++
+	} else {
+		r.New++
+		s.New++
+	}
+	r.Bytes += bytes
+	s.Bytes += bytes
+
+	r.Files = append(r.Files, FileReport{
+		SiteID:    res.lessonSite.ID,
+		SiteTitle: res.lessonSite.Title,
+		Title:     res.Title,
+		Path:      res.Path(),
+		Local:     local,
+		Size:      bytes,
+		Updated:   updated,
+	})
+}
+
+// addConflict 保存先に既にファイルがあったため上書きしなかったファイルを記録する
+// ダウンロードしなかった場合はsavedを空にし、スキップしたものとして数える
+func (r *SyncReport) addConflict(c Conflict, action, saved string, updated bool) {
+	res := c.Resource
+	if saved == "" {
+		r.Skipped++
+		r.site(res.lessonSite).Skipped++
+	}
+
+	r.Conflicts = append(r.Conflicts, ConflictReport{
+		SiteID:    res.lessonSite.ID,
+		SiteTitle: res.lessonSite.Title,
+		Title:     res.Title,
+		Path:      res.Path(),
+		Existing:  c.Path,
+		Saved:     saved,
+		Action:    action,
+		Modified:  !c.Owned,
+		Updated:   updated,
+		Unasked:   c.Unasked,
+	})
+}
+
+// addFailed ダウンロードに失敗したファイルを記録する
+func (r *SyncReport) addFailed(res Resource, err error) {
+	r.Failed++
+	r.site(res.lessonSite).Failed++
+	r.addError(err, res.lessonSite.Title+"/"+res.Title)
+}
+
+// addError エラーを種類ごとにまとめて記録する fileが空の場合はファイルに紐付かないエラーとして扱う
+func (r *SyncReport) addError(err error, file string) {
+	kind := classifyError(err)
+
+	for i := range r.Errors {
+		if r.Errors[i].Kind == kind {
+			r.Errors[i].Count++
+			if file != "" {
+				r.Errors[i].Files = append(r.Errors[i].Files, file)
+			}
+			return
+		}
+	}
+
+	g := ErrorGroup{Kind: kind, Message: secret.Redact(err.Error()), Count: 1, Files: make([]string, 0)}
+	if file != "" {
+		g.Files = append(g.Files, file)
+	}
+	r.Errors = append(r.Errors, g)
+}
+
+// finish レポートを完成させる
+func (r *SyncReport) finish() {
+	r.FinishedAt = time.Now()
+
+	sort.Slice(r.Sites, func(i, j int) bool {
+		return r.Sites[i].Title < r.Sites[j].Title
+	})
+	sort.SliceStable(r.Files, func(i, j int) bool {
+		return r.Files[i].SiteTitle < r.Files[j].SiteTitle
+	})
+	sort.SliceStable(r.Conflicts, func(i, j int) bool {
+		return r.Conflicts[i].SiteTitle < r.Conflicts[j].SiteTitle
+	})
+}
+
+// classifyError エラーの種類を判定する
+func classifyError(err error) string {
+	switch pandaapi.ClassOf(err) {
+	case pandaapi.ClassAuth:
+		return ErrorKindLogin
+	case pandaapi.ClassTLS, pandaapi.ClassDNS, pandaapi.ClassTimeout, pandaapi.ClassNetwork:
+		return ErrorKindNetwork
+	case pandaapi.ClassUnknown:
+	default:
+		return ErrorKindPandA
+	}
+
+	var (
+		pathErr *os.PathError
+		linkErr *os.LinkError
+	)
+	if errors.As(err, &pathErr) || errors.As(err, &linkErr) {
+		return ErrorKindFile
+	}
+
+	return ErrorKindOther
+}
+
+// Markdown レポートをMarkdown形式で返す
+func (r *SyncReport) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# PandorA Sync Report\n\n")
+	fmt.Fprintf(&b, "- Started: %s\n", r.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "- Finished: %s\n", r.FinishedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "- New: %d / Updated: %d / Skipped: %d / Failed: %d / Removed on server: %d\n", r.New, r.Updated, r.Skipped, r.Failed, r.Removed)
+	fmt.Fprintf(&b, "- Downloaded: %s\n", FormatSize(r.Bytes))
+
+	if len(r.Sites) > 0 {
+		b.WriteString("\n## Courses\n\n")
+		b.WriteString("| Course | New | Updated | Skipped | Failed | Removed | Size |\n")
+		b.WriteString("| --- | ---: | ---: | ---: | ---: | ---: | ---: |\n")
+		for _, s := range r.Sites {
+			fmt.Fprintf(&b, "| %s | %d | %d | %d | %d | %d | %s |\n", escapeMarkdown(s.Title), s.New, s.Updated, s.Skipped, s.Failed, s.Removed, FormatSize(s.Bytes))
+		}
+	}
+
+	if len(r.Files) > 0 {
+		b.WriteString("\n## Downloaded Files\n\n")
+		for _, f := range r.Files {
+			mark := ""
+			if f.Updated {
+				mark = " (updated)"
+			}
+			fmt.Fprintf(&b, "- %s / %s%s — %s\n", escapeMarkdown(f.SiteTitle), escapeMarkdown(f.Path), mark, FormatSize(f.Size))
+		}
+	}
+
+	if len(r.Conflicts) > 0 {
+		b.WriteString("\n## Existing Files Not Overwritten\n\n")
+		for _, c := range r.Conflicts {
+			reason := "a file with the same name already exists"
+			switch {
+			case c.IsEditConflict():
+				reason = "**updated on the server after you edited the local file**"
+			case c.Modified:
+				reason = "the local file was created or edited by you"
+			}
+			result := "skipped"
+			if c.Saved != "" {
+				result = "saved as " + escapeMarkdown(c.Saved)
+			}
+			if c.Unasked {
+				reason += "; not asked because no prompt was available"
+			}
+			fmt.Fprintf(&b, "- %s / %s — %s (%s)\n", escapeMarkdown(c.SiteTitle), escapeMarkdown(c.Path), result, reason)
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		b.WriteString("\n## Errors\n")
+		for _, g := range r.Errors {
+			fmt.Fprintf(&b, "\n### %s (%d)\n\n", g.Kind, g.Count)
+			fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimSpace(g.Message))
+			for _, f := range g.Files {
+				fmt.Fprintf(&b, "- %s\n", escapeMarkdown(f))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// escapeMarkdown 表や箇条書きを壊す文字をエスケープする
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// Save レポートをJSON形式とMarkdown形式でディレクトリに保存し、それぞれのパスを返す
+func (r *SyncReport) Save(dirname string) (jsonPath, markdownPath string, err error) {
+	jsonPath = filepath.Join(dirname, reportFilename+".json")
+	markdownPath = filepath.Join(dirname, reportFilename+".md")
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := ioutil.WriteFile(jsonPath, data, 0666); err != nil {
+		return "", "", err
+	}
+
+	if err := ioutil.WriteFile(markdownPath, []byte(r.Markdown()), 0666); err != nil {
+		return "", "", err
+	}
+
+	return jsonPath, markdownPath, nil
+}
+
+// ReportPath 保存されたMarkdown形式のレポートのパスを返す
+func ReportPath(dirname string) string {
+	return filepath.Join(dirname, reportFilename+".md")
+}
+
+// ReadReport 保存されたレポートを読み出す
+func ReadReport(dirname string) (*SyncReport, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dirname, reportFilename+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(SyncReport)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,71 @@
+package resource
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	pandaapi "pandora/pkg/pandaAPI"
+)
+
+func TestReportGroupsErrors(t *testing.T) {
+	s := Site{ID: "site1", Title: "線形代数学"}
+	res := func(title string) Resource {
+		return Resource{Title: title, URL: "https://example.com/" + title, lessonSite: s}
+	}
+
+	plan := &Plan{Skipped: []SkippedResource{{Resource: res("movie.mp4"), Reason: ReasonVideo}}}
+	r := newReport(plan, time.Now())
+	r.addDownloaded(res("a.pdf"), "/tmp/a.pdf", 100, false)
+	r.addDownloaded(res("b.pdf"), "/tmp/b.pdf", 50, true)
+	for _, title := range []string{"c.pdf", "d.pdf", "e.pdf"} {
+		r.addFailed(res(title), &pandaapi.DeadPandAError{})
+	}
+	r.addFailed(res("f.pdf"), &os.PathError{Op: "open", Path: "f.pdf", Err: errors.New("denied")})
+	r.finish()
+
+	if r.New != 1 || r.Updated != 1 || r.Failed != 4 || r.Skipped != 1 || r.Bytes != 150 {
+		t.Errorf("unexpected counts: %+v", r)
+	}
+	if len(r.Sites) != 1 || r.Sites[0].Failed != 4 || r.Sites[0].Skipped != 1 {
+		t.Errorf("unexpected site breakdown: %+v", r.Sites)
+	}
+	if len(r.Errors) != 2 || r.Errors[0].Kind != ErrorKindPandA || r.Errors[0].Count != 3 || len(r.Errors[0].Files) != 3 {
+		t.Errorf("errors are not grouped: %+v", r.Errors)
+	}
+	if summary := r.Summary(); !strings.Contains(summary, "panda: 3") || !strings.Contains(summary, "file: 1") {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+}
+
+// 手元で変更したファイルがサーバー上で更新された場合はレポートで知らせる
+func TestReportEditConflicts(t *testing.T) {
+	s := Site{ID: "site1", Title: "線形代数学"}
+	res := Resource{Title: "slides.pdf", URL: "https://example.com/slides.pdf", LastModified: "20261018093000000", lessonSite: s}
+
+	r := newReport(&Plan{}, time.Now())
+	r.addDownloaded(res, "/pandora/slides (updated 2026-10-18).pdf", 100, true)
+	r.addConflict(Conflict{Resource: res, Path: "/pandora/slides.pdf"}, "keep-both", "/pandora/slides (updated 2026-10-18).pdf", true)
+	r.addConflict(Conflict{Resource: res, Path: "/pandora/mine.pdf", Owned: true}, "skip", "", false)
+	r.addConflict(Conflict{Resource: res, Path: "/pandora/notes.pdf", Owned: true, Unasked: true}, "keep-both", "/pandora/notes (1).pdf", false)
+	r.finish()
+
+	if r.EditConflicts() != 1 || !r.Conflicts[0].IsEditConflict() || r.Conflicts[1].IsEditConflict() || r.Unasked() != 1 {
+		t.Errorf("unexpected conflicts: %+v", r.Conflicts)
+	}
+	if r.Skipped != 1 {
+		t.Errorf("skipped conflict is not counted: %d", r.Skipped)
+	}
+	if summary := r.Summary(); !strings.Contains(summary, "1 file(s) you edited were updated on the server") || !strings.Contains(summary, "no way to ask") {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+	if md := r.Markdown(); !strings.Contains(md, "saved as /pandora/slides (updated 2026-10-18).pdf") {
+		t.Errorf("conflict is not in the markdown report:\n%s", md)
+	}
+
+	if d := res.updatedDate(); d != "2026-10-18" {
+		t.Errorf("updated date: %s", d)
+	}
+}
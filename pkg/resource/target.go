@@ -0,0 +1,99 @@
+package resource
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"pandora/pkg/layout"
+	"pandora/pkg/state"
+)
+
+// Collision テンプレートから決めた保存先が他の資料と重なったため、名前を変えて保存する資料
+type Collision struct {
+	Resource Resource
+	// テンプレートから決めた保存先
+	Path string
+	// 実際の保存先
+	Renamed string
+}
+
+// Target 資料の保存先のパスを返す 計画を立てる前のリソースでは空
+func (r Resource) Target() string {
+	return r.target
+}
+
+// vars テンプレートに埋め込むリソースの情報
+func (r Resource) vars() layout.Vars {
+	return layout.Vars{
+		SiteID:    r.lessonSite.ID,
+		SiteTitle: r.lessonSite.Title,
+		Folder:    folderOf(r.Path()),
+		Filename:  r.Title,
+	}
+}
+
+// recordVars テンプレートに埋め込む記録の情報
+func recordVars(r state.Record) layout.Vars {
+	return layout.Vars{
+		SiteID:    r.SiteID,
+		SiteTitle: r.SiteTitle,
+		Folder:    folderOf(r.SitePath),
+		Filename:  r.Title,
+	}
+}
+
+// folderOf 授業サイト内でのパスからフォルダの部分を返す
+func folderOf(sitePath string) string {
+	if folder := path.Dir(sitePath); folder != "." {
+		return folder
+	}
+	return ""
+}
+
+// targets 資料の保存先を決める 保存先が重ならないよう、使用中のパスとその持ち主(URL)を記録する
+type targets struct {
+	root  string
+	tmpl  *layout.Template
+	taken map[string]string
+}
+
+// newTargets 記録されている資料の保存先を使用中として保存先の決定を始める
+func newTargets(root string, tmpl *layout.Template, store *state.Store) *targets {
+	t := &targets{root: root, tmpl: tmpl, taken: make(map[string]string)}
+	for _, r := range store.Records() {
+		if r.Path != "" {
+			t.taken[state.PathKey(r.Path)] = r.URL
+		}
+	}
+
+	return t
+}
+
+// render テンプレートから決まる保存先を返す
+func (t *targets) render(v layout.Vars) string {
+	return filepath.Join(t.root, filepath.FromSlash(t.tmpl.Render(v)))
+}
+
+// assign 保存先のパスを決める 既に他の資料の保存先となっている場合は名前に(n)をつける
+// 重なった場合は変更前のパスも返す
+func (t *targets) assign(p, owner string) (assigned, collided string) {
+	assigned = p
+	for n := 2; ; n++ {
+		if o, ok := t.taken[state.PathKey(assigned)]; !ok || o == owner {
+			break
+		}
+		collided = p
+		assigned = numbered(p, n)
+	}
+
+	t.taken[state.PathKey(assigned)] = owner
+	return assigned, collided
+}
+
+// numbered ファイル名の拡張子の前に (n) をつける
+func numbered(p string, n int) string {
+	ext := filepath.Ext(p)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(p, ext), n, ext)
+}
@@ -0,0 +1,174 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 次の実行時刻を探す範囲 閏年の2月29日のみを指定した場合も見つかるよう5年とする
+const cronSearchYears = 5
+
+// cronの各項目の範囲
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// よく使う指定の別名
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// Error 自動実行の指定が不正な場合のエラー
+type Error struct {
+	Spec    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid schedule %q: %s", e.Spec, e.Message)
+}
+
+// Cron "分 時 日 月 曜日" の5項目で指定した実行時刻
+// 各項目には *, 数値, 範囲(1-5), 間隔(*/15, 9-17/2) とそのカンマ区切りのリストを書ける 曜日は0と7が日曜日
+type Cron struct {
+	expr   string
+	fields [5]uint64
+	// 日と曜日のどちらも指定されている場合はどちらかに一致すればよい
+	anyDay bool
+}
+
+// ParseCron cron形式の指定を読み込む
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if m, ok := cronMacros[spec]; ok {
+		spec = m
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, &Error{Spec: expr, Message: "must have 5 fields: minute hour day-of-month month day-of-week"}
+	}
+
+	c := &Cron{expr: expr}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, &Error{Spec: expr, Message: fmt.Sprintf("%s: %s", cronFields[i].name, err)}
+		}
+		c.fields[i] = bits
+	}
+
+	// 曜日の7は日曜日として扱う
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	c.anyDay = parts[2] != "*" && parts[4] != "*"
+
+	return c, nil
+}
+
+// parseCronField 一つの項目を、一致する値のビットを立てた値に変換する
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", item)
+			}
+			rng, step = item[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			s := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(s[0]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", item)
+			}
+			if hi, err = strconv.Atoi(s[1]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", item)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", item)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", item, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next tより後で最初に一致する時刻を返す 見つからない場合はゼロ値を返す
+func (c *Cron) Next(t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, t.Location())
+	limit := t.AddDate(cronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if !c.match(3, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.match(1, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.match(0, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) match(field, v int) bool {
+	return c.fields[field]&(1<<uint(v)) != 0
+}
+
+// matchDay 日と曜日が一致するかどうか
+func (c *Cron) matchDay(t time.Time) bool {
+	dom, dow := c.match(2, t.Day()), c.match(4, int(t.Weekday()))
+	if c.anyDay {
+		return dom || dow
+	}
+
+	return dom && dow
+}
@@ -0,0 +1,73 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	// 2026-10-19 (月) 12:34
+	base := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 10, 19, 12, 45, 0, 0, time.UTC)},
+		{"0 8,18 * * *", time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * 1-5", time.Date(2026, 10, 19, 13, 30, 0, 0, time.UTC)},
+		{"0 7 * * 6,7", time.Date(2026, 10, 24, 7, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		// 日と曜日のどちらも指定した場合はどちらかに一致すればよい
+		{"0 0 25 * 3", time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "0 0 31 2 8"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q should be invalid", expr)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	q, err := ParseQuietHours("23:00-07:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(h, m int) time.Time {
+		return time.Date(2026, 10, 19, h, m, 0, 0, time.Local)
+	}
+	for _, tt := range []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(23, 0), true}, {at(2, 30), true}, {at(6, 59), true}, {at(7, 0), false}, {at(12, 0), false},
+	} {
+		if got := q.Contains(tt.t); got != tt.want {
+			t.Errorf("%s: got %v", tt.t.Format("15:04"), got)
+		}
+	}
+
+	if q, err := ParseQuietHours(""); q != nil || err != nil || q.Contains(at(0, 0)) {
+		t.Errorf("empty quiet hours: %v, %v", q, err)
+	}
+	for _, spec := range []string{"23:00", "25:00-07:00", "07:00-07:00"} {
+		if _, err := ParseQuietHours(spec); err == nil {
+			t.Errorf("%q should be invalid", spec)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours 通知を行わない時間帯 "23:00-07:00" のように日をまたいでもよい
+type QuietHours struct {
+	// 0時からの経過時間
+	start, end time.Duration
+}
+
+// ParseQuietHours "HH:MM-HH:MM" の形式の時間帯を読み込む 空の場合はnilを返す
+func ParseQuietHours(spec string) (*QuietHours, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	s := strings.SplitN(spec, "-", 2)
+	if len(s) != 2 {
+		return nil, &Error{Spec: spec, Message: "quiet hours must be in the form HH:MM-HH:MM"}
+	}
+
+	var q QuietHours
+	for i, p := range []*time.Duration{&q.start, &q.end} {
+		t, err := time.Parse("15:04", strings.TrimSpace(s[i]))
+		if err != nil {
+			return nil, &Error{Spec: spec, Message: fmt.Sprintf("invalid time %q", strings.TrimSpace(s[i]))}
+		}
+		*p = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if q.start == q.end {
+		return nil, &Error{Spec: spec, Message: "start and end must differ"}
+	}
+
+	return &q, nil
+}
+
+// Contains tが時間帯に含まれるかどうか nilの場合は常にfalse
+func (q *QuietHours) Contains(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.start < q.end {
+		return q.start <= d && d < q.end
+	}
+
+	// 日をまたぐ場合
+	return d >= q.start || d < q.end
+}
@@ -0,0 +1,181 @@
+// Package schedule 自動でダウンロードを行う時刻を決め、その時刻に実行する
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 実行時刻になったかを確認する間隔
+// スリープ中は単調時計が進まない環境があるため、タイマーではなく現在時刻と比較して確かめる
+var checkInterval = 30 * time.Second
+
+// Spec 自動実行の指定
+type Spec struct {
+	// 実行する間隔 Cronを指定した場合は用いない
+	Interval time.Duration
+	// 実行する時刻 nilでない場合はIntervalより優先する
+	Cron *Cron
+	// 起動時に実行する
+	OnStartup bool
+	// 実行時刻を0からJitterの間でランダムに遅らせる 同じ授業の受講者が一斉にPandAにアクセスしないようにする
+	Jitter time.Duration
+	// 通知を行わない時間帯 nilの場合は常に通知する
+	Quiet *QuietHours
+}
+
+// Enabled 自動実行を行うかどうか
+func (s *Spec) Enabled() bool {
+	return s.Cron != nil || s.Interval > 0
+}
+
+// Scheduler 自動実行の時刻を管理する 次の実行時刻はファイルに保存し、再起動後も引き継ぐ
+type Scheduler struct {
+	spec Spec
+	// 次の実行時刻を保存するファイル 空の場合は保存しない
+	path string
+
+	mu   sync.Mutex
+	next time.Time
+
+	// テストで差し替える
+	now  func() time.Time
+	rand *rand.Rand
+}
+
+// saved ファイルに保存する形式
+type saved struct {
+	NextRun time.Time `json:"nextRun"`
+}
+
+// New specに従って実行するSchedulerを返す pathに保存された次の実行時刻があれば引き継ぐ
+func New(spec Spec, path string) *Scheduler {
+	s := &Scheduler{
+		spec: spec,
+		path: path,
+		now:  time.Now,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		var sv saved
+		if json.Unmarshal(data, &sv) == nil {
+			s.next = sv.NextRun
+		}
+	}
+
+	return s
+}
+
+// Next 次の実行時刻を返す 自動実行を行わない場合はゼロ値
+func (s *Scheduler) Next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.next
+}
+
+// Quiet tが通知を行わない時間帯に含まれるかどうか
+func (s *Scheduler) Quiet(t time.Time) bool {
+	return s.spec.Quiet.Contains(t)
+}
+
+// Run ctxが終了するまで、実行時刻になるたびにfireを呼ぶ 次の実行時刻が変わるたびにchangedを呼ぶ
+// 前回の実行時刻を過ぎていた場合(アプリを終了していた間やスリープ中に過ぎた場合)は一度だけすぐに実行する
+func (s *Scheduler) Run(ctx context.Context, fire func(), changed func(next time.Time)) {
+	now := s.now()
+	missed := s.catchUp(now)
+	if missed || s.spec.OnStartup {
+		fire()
+	}
+	changed(s.Next())
+
+	if !s.spec.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// スリープから復帰した直後も、現在時刻と比較することで過ぎた実行を一度だけ行う
+		if now := s.now(); !now.Before(s.Next()) {
+			fire()
+			s.advance(now)
+			changed(s.Next())
+		}
+	}
+}
+
+// catchUp 起動時に次の実行時刻を決める 保存された実行時刻を過ぎていた場合はtrueを返す
+func (s *Scheduler) catchUp(now time.Time) (missed bool) {
+	next := s.Next()
+	if !s.spec.Enabled() {
+		s.set(time.Time{})
+		return false
+	}
+
+	switch {
+	case next.IsZero():
+		s.advance(now)
+	case !now.Before(next):
+		s.advance(now)
+		return true
+	case s.spec.Cron == nil && next.Sub(now) > s.spec.Interval+s.spec.Jitter:
+		// 間隔を短く変更した場合は新しい間隔で数え直す
+		s.advance(now)
+	}
+
+	return false
+}
+
+// advance nowより後の次の実行時刻を決めて保存する
+func (s *Scheduler) advance(now time.Time) {
+	var next time.Time
+	if s.spec.Cron != nil {
+		next = s.spec.Cron.Next(now)
+	} else {
+		next = now.Add(s.spec.Interval)
+	}
+
+	if !next.IsZero() && s.spec.Jitter > 0 {
+		next = next.Add(time.Duration(s.rand.Int63n(int64(s.spec.Jitter))))
+	}
+
+	s.set(next)
+}
+
+// set 次の実行時刻を記録してファイルに保存する
+func (s *Scheduler) set(next time.Time) {
+	// 単調時計の値を除き、スリープ中も進む実時刻で比較する
+	next = next.Round(0)
+
+	s.mu.Lock()
+	s.next = next
+	s.mu.Unlock()
+
+	if s.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(saved{NextRun: next})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return
+	}
+	ioutil.WriteFile(s.path, data, 0644)
+}
@@ -0,0 +1,121 @@
+package schedule
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock テスト用の時計
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	c.t = t
+	c.mu.Unlock()
+}
+
+func newTestScheduler(spec Spec, path string, clock *fakeClock) *Scheduler {
+	s := New(spec, path)
+	s.now = clock.now
+	s.rand = rand.New(rand.NewSource(1))
+	return s
+}
+
+func TestScheduler(t *testing.T) {
+	checkInterval = time.Millisecond
+	defer func() { checkInterval = 30 * time.Second }()
+
+	tmp, err := ioutil.TempDir("", "pandora-schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "schedule.json")
+
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+	spec := Spec{Interval: 4 * time.Hour, Jitter: 10 * time.Minute}
+
+	fired := make(chan struct{}, 10)
+	nexts := make(chan time.Time, 10)
+	run := func(s *Scheduler) context.CancelFunc {
+		ctx, cancel := context.WithCancel(context.Background())
+		go s.Run(ctx, func() { fired <- struct{}{} }, func(next time.Time) { nexts <- next })
+		return cancel
+	}
+	wait := func(what string) time.Time {
+		select {
+		case next := <-nexts:
+			return next
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: next run is not updated", what)
+		}
+		return time.Time{}
+	}
+
+	// 初回の起動では実行せず、次の実行時刻を間隔とずらす時間から決める
+	cancel := run(newTestScheduler(spec, path, clock))
+	next := wait("first start")
+	if next.Before(start.Add(4*time.Hour)) || !next.Before(start.Add(4*time.Hour+10*time.Minute)) {
+		t.Errorf("next: %s", next)
+	}
+	if len(fired) != 0 {
+		t.Error("fired on the first start")
+	}
+
+	// スリープなどで実行時刻を大きく過ぎても、一度だけ実行する
+	clock.set(start.Add(30 * time.Hour))
+	<-fired
+	after := wait("resume")
+	if !after.After(start.Add(34*time.Hour)) || len(fired) != 0 {
+		t.Errorf("next after resume: %s, fired: %d", after, len(fired))
+	}
+	cancel()
+
+	// 次の実行時刻は保存され、再起動後に過ぎていれば一度だけすぐに実行する
+	clock.set(start.Add(40 * time.Hour))
+	cancel = run(newTestScheduler(spec, path, clock))
+	<-fired
+	if next := wait("restart"); !next.After(start.Add(44 * time.Hour)) {
+		t.Errorf("next after restart: %s", next)
+	}
+	cancel()
+
+	// 起動時に実行する設定
+	cancel = run(newTestScheduler(Spec{OnStartup: true}, "", clock))
+	<-fired
+	if next := wait("on startup"); !next.IsZero() {
+		t.Errorf("disabled schedule has the next run: %s", next)
+	}
+	cancel()
+}
+
+func TestSchedulerCron(t *testing.T) {
+	c, err := ParseCron("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &fakeClock{t: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}
+	s := newTestScheduler(Spec{Cron: c}, "", clock)
+	s.catchUp(clock.now())
+
+	if want := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC); !s.Next().Equal(want) {
+		t.Errorf("got %s, want %s", s.Next(), want)
+	}
+}
@@ -0,0 +1,116 @@
+// Package secret パスワードなどの秘密情報がエラーメッセージやログに表示されないようにする
+package secret
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// 秘密情報の代わりに表示する文字列
+	Mask = "****"
+)
+
+// String 書式化やJSONへの変換の際に伏せ字になる文字列
+// 元の文字列が必要な場合はRevealを用いる
+type String string
+
+// Reveal 元の文字列を返す
+func (s String) Reveal() string {
+	return string(s)
+}
+
+// IsEmpty 空文字列かどうかを判定する
+func (s String) IsEmpty() bool {
+	return s == ""
+}
+
+func (s String) String() string {
+	return Mask
+}
+
+// GoString %#v で書式化された場合にも伏せ字にする
+func (s String) GoString() string {
+	return Mask
+}
+
+// Format 全ての書式指定子(%s, %q, %x など)で伏せ字にする
+func (s String) Format(f fmt.State, verb rune) {
+	io.WriteString(f, Mask)
+}
+
+// MarshalText JSONなどに変換された場合にも伏せ字にする
+func (s String) MarshalText() ([]byte, error) {
+	return []byte(Mask), nil
+}
+
+var (
+	mu sync.RWMutex
+	// 登録された秘密情報 長いものから順に置き換えるため長さの降順に並べる
+	registered []string
+)
+
+// Register 秘密情報を登録する 登録されたものはRedactやRedactorで伏せ字になる
+// URLエンコードされた形も合わせて登録する
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, v := range values {
+		for _, form := range []string{v, url.QueryEscape(v), url.PathEscape(v)} {
+			if form != "" && !contains(registered, form) {
+				registered = append(registered, form)
+			}
+		}
+	}
+
+	sort.Slice(registered, func(i, j int) bool {
+		return len(registered[i]) > len(registered[j])
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact 登録された秘密情報を伏せ字に置き換える
+func Redact(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, v := range registered {
+		s = strings.Replace(s, v, Mask, -1)
+	}
+
+	return s
+}
+
+// Redactor 書き込まれた内容の秘密情報を伏せ字に置き換えてから書き込むio.Writer
+// logパッケージは1行ずつ書き込むため、ログの出力先として用いることを想定している
+type Redactor struct {
+	w io.Writer
+}
+
+// NewRedactor wへの書き込みから秘密情報を取り除くRedactorを返す
+func NewRedactor(w io.Writer) *Redactor {
+	return &Redactor{w: w}
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+
+	// 置き換えによって長さが変わっても、呼び出し側には全て書き込んだことを伝える
+	return len(p), nil
+}
@@ -0,0 +1,70 @@
+package secret_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"pandora/pkg/secret"
+	"strings"
+	"testing"
+)
+
+func TestStringIsMasked(t *testing.T) {
+	password := secret.String("p@ss word")
+
+	type credential struct {
+		ECSID    string
+		Password secret.String
+	}
+	cred := credential{ECSID: "a0123456", Password: password}
+
+	outputs := []string{
+		fmt.Sprint(password),
+		fmt.Sprintf("%s %v %q %x %X %d", password, password, password, password, password, password),
+		fmt.Sprintf("%v %+v %#v", cred, cred, cred),
+		fmt.Sprintf("%v", &cred),
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs = append(outputs, string(data))
+
+	for _, out := range outputs {
+		if strings.Contains(out, password.Reveal()) || strings.Contains(out, "p@ss") {
+			t.Errorf("secret leaked: %s", out)
+		}
+	}
+
+	if password.Reveal() != "p@ss word" {
+		t.Errorf("Reveal returned %q", password.Reveal())
+	}
+}
+
+// ログに秘密情報が残らないことを確認する
+func TestLogOutputHasNoSecrets(t *testing.T) {
+	const password = "hunter2:p@ss word"
+	secret.Register(password)
+
+	var buf bytes.Buffer
+	logger := log.New(secret.NewRedactor(&buf), "", 0)
+
+	// 秘密情報がそのまま含まれるエラーや、URLエンコードされた形で含まれるエラーを出力する
+	logger.Println("Download error:", errors.New("login failed for password "+password))
+	logger.Printf("request failed: https://example.com/login?password=%s", "hunter2%3Ap%40ss+word")
+	logger.Printf("credential: %+v", struct{ Password secret.String }{secret.String(password)})
+
+	out := buf.String()
+	for _, known := range []string{password, "hunter2", "hunter2%3Ap%40ss+word"} {
+		if strings.Contains(out, known) {
+			t.Errorf("log output contains a secret %q:\n%s", known, out)
+		}
+	}
+
+	if strings.Count(out, secret.Mask) != 3 {
+		t.Errorf("secrets are not masked:\n%s", out)
+	}
+}
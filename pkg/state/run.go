@@ -0,0 +1,102 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pandora/pkg/dir"
+)
+
+// 実行の記録を保存するファイルの名前
+// 資料の記録とは別のファイルにし、ダウンロード中に書き込んでも資料の記録を上書きしないようにする
+const runFile = "last-run.json"
+
+// 実行の結果
+const (
+	// ResultRunning 実行中もしくは実行中に終了した
+	ResultRunning = "running"
+	// ResultSuccess 全てのファイルをダウンロードできた
+	ResultSuccess = "success"
+	// ResultPartial 一部のファイルや授業サイトでエラーが起きた
+	ResultPartial = "partial"
+	// ResultFailed ログインなどに失敗したためダウンロードを行えなかった
+	ResultFailed = "failed"
+)
+
+// Run 最後に行ったダウンロードの記録
+type Run struct {
+	// 最後に開始した時刻
+	LastStart time.Time `json:"lastStart"`
+	// 最後に成功(一部のエラーを含む)した時刻
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	// 最後の実行にかかった時間
+	Duration time.Duration `json:"duration"`
+	// 最後の実行の結果 Result から始まる定数のいずれか
+	Result string `json:"result"`
+	// 失敗した場合のエラーメッセージ
+	Error string `json:"error,omitempty"`
+	// 手動で実行した場合にtrue
+	Manual bool `json:"manual"`
+	// 最後の実行で新たにダウンロードしたファイルと更新されたファイルの数
+	New     int `json:"new"`
+	Updated int `json:"updated"`
+}
+
+// 同じプロセス内で記録の読み書きが重ならないようにする
+var runMu sync.Mutex
+
+// LastRun 状態のディレクトリに保存された最後の実行の記録を返す 記録がない場合はゼロ値を返す
+func LastRun() (Run, error) {
+	return readRun(dir.StatePath(runFile))
+}
+
+// SaveRun 最後の実行の記録を状態のディレクトリに保存する
+func SaveRun(r Run) error {
+	return writeRun(dir.StatePath(runFile), r)
+}
+
+func readRun(path string) (Run, error) {
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	var r Run
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+
+	return r, json.Unmarshal(data, &r)
+}
+
+func writeRun(path string, r Run) error {
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+// CooldownRemaining 最後に開始してからcooldownが経過するまでの残り時間を返す 経過している場合は0
+// 時計が巻き戻った場合は開始時刻が未来になるため、経過したものとみなす
+func (r *Run) CooldownRemaining(now time.Time, cooldown time.Duration) time.Duration {
+	elapsed := now.Sub(r.LastStart)
+	if r.LastStart.IsZero() || elapsed < 0 || elapsed >= cooldown {
+		return 0
+	}
+
+	return cooldown - elapsed
+}
@@ -0,0 +1,401 @@
+// Package state ダウンロードした資料の記録(保存先、サーバー上の更新時刻など)を管理する
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pandora/pkg/dir"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// 記録を保存するファイルの名前
+	stateFile = "state.json"
+	// 旧バージョンのダウンロードマップのファイルの名前
+	legacyMapFile = "dmap.dat"
+	// 記録の形式のバージョン
+	currentVersion = 1
+)
+
+// Record ダウンロードした資料の記録
+type Record struct {
+	// 資料のURL 旧バージョンのダウンロードマップから移行した記録では空
+	URL       string `json:"url,omitempty"`
+	SiteID    string `json:"siteID"`
+	SiteTitle string `json:"siteTitle,omitempty"`
+	Title     string `json:"title"`
+	// 授業サイト内での資料のパス(フォルダ/資料名)
+	SitePath string `json:"sitePath,omitempty"`
+	// サーバー上での最終更新時刻
+	LastModified string `json:"lastModified"`
+	// 保存したファイルの絶対パス 分からない場合は空
+	Path         string    `json:"path,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	DownloadedAt time.Time `json:"downloadedAt,omitempty"`
+	// 保存した直後のファイルのSHA-256と更新時刻 ユーザーによる変更の検出に用いる
+	SHA256  string    `json:"sha256,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+// Legacy 旧バージョンのダウンロードマップから移行した、URLと保存先が分からない記録かどうか
+func (r *Record) Legacy() bool {
+	return r.URL == ""
+}
+
+// key 記録を識別するキー URLが分からない記録は授業サイトのIDと資料名で識別する
+func (r *Record) key() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	return legacyKey(r.SiteID, r.Title)
+}
+
+func legacyKey(siteID, title string) string {
+	return "legacy:" + siteID + "/" + title
+}
+
+// Store ダウンロードした資料の記録の集まり 複数のゴルーチンから同時に用いてよい
+type Store struct {
+	mu      sync.RWMutex
+	path    string
+	records map[string]*Record
+}
+
+// stored ファイルに保存する形式
+type stored struct {
+	Version int       `json:"version"`
+	Records []*Record `json:"records"`
+}
+
+// New ファイルに保存しない空のStoreを返す
+func New() *Store {
+	return &Store{records: make(map[string]*Record)}
+}
+
+// Open pathに保存された記録を読み込む ファイルが存在しない場合は空のStoreを返す
+func Open(path string) (*Store, error) {
+	s := New()
+	s.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var st stored
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+
+	for _, r := range st.Records {
+		s.records[r.key()] = r
+	}
+
+	return s, nil
+}
+
+// Default 状態のディレクトリに保存された記録を読み込む
+// 記録がなく旧バージョンのダウンロードマップが残っている場合はそれを移行する
+func Default() (*Store, error) {
+	path := dir.StatePath(stateFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return migrateLegacyMap(path, dir.StatePath(legacyMapFile))
+	}
+
+	return Open(path)
+}
+
+// migrateLegacyMap 旧バージョンのダウンロードマップ(授業サイトのID→資料名→最終更新時刻)を読み込んで保存し、旧ファイルを削除する
+func migrateLegacyMap(path, legacy string) (*Store, error) {
+	s := New()
+	s.path = path
+
+	data, err := ioutil.ReadFile(legacy)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dmap := make(map[string]map[string]string)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &dmap); err != nil {
+			return nil, err
+		}
+	}
+
+	for siteID, resources := range dmap {
+		for title, lastModified := range resources {
+			s.Put(Record{SiteID: siteID, Title: title, LastModified: lastModified})
+		}
+	}
+
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+
+	return s, os.Remove(legacy)
+}
+
+// Path 記録を保存するファイルのパスを返す
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Save 記録をファイルに保存する 書き込み途中の状態が残らないよう一時ファイルを経由する
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	st := stored{Version: currentVersion, Records: make([]*Record, 0, len(s.records))}
+	for _, r := range s.Records() {
+		r := r
+		st.Records = append(st.Records, &r)
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.path, data)
+}
+
+// writeFile 書き込み途中の状態が残らないよう一時ファイルを経由してpathに書き込む
+func writeFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Lookup 資料の記録を探す URLで見つからない場合は旧形式の記録を授業サイトのIDと資料名で探す
+func (s *Store) Lookup(url, siteID, title string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if r, ok := s.records[url]; ok && url != "" {
+		return *r, true
+	}
+	if r, ok := s.records[legacyKey(siteID, title)]; ok {
+		return *r, true
+	}
+
+	return Record{}, false
+}
+
+// LookupPath 保存したファイルのパスから資料の記録を探す
+// 保存先の名前は無害化されているため、元の授業サイト名や資料名は記録から得る
+func (s *Store) LookupPath(path string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := PathKey(path)
+	for _, r := range s.records {
+		if r.Path != "" && PathKey(r.Path) == key {
+			return *r, true
+		}
+	}
+
+	return Record{}, false
+}
+
+// PathKey 大文字と小文字やUnicodeの正規化形式を区別しないファイルシステムでも同じファイルを指すパスが一致するよう、比較に用いるキーを返す
+// NFDで返すファイルシステムがあるためNFCに揃え、大文字と小文字を区別しないファイルシステムのため小文字にする
+func PathKey(path string) string {
+	return strings.ToLower(norm.NFC.String(filepath.Clean(path)))
+}
+
+// Put 記録を追加する 同じ資料の記録があれば置き換え、同じ資料の旧形式の記録は削除する
+func (s *Store) Put(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL != "" {
+		delete(s.records, legacyKey(r.SiteID, r.Title))
+	}
+	s.records[r.key()] = &r
+}
+
+// Delete 記録を削除する
+func (s *Store) Delete(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, r.key())
+}
+
+// Records 全ての記録を授業サイト、資料の順に並べて返す
+func (s *Store) Records() []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, *r)
+	}
+	sortRecords(records)
+
+	return records
+}
+
+// SiteRecords 授業サイトの記録を返す
+func (s *Store) SiteRecords(siteID string) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]Record, 0)
+	for _, r := range s.records {
+		if r.SiteID == siteID {
+			records = append(records, *r)
+		}
+	}
+	sortRecords(records)
+
+	return records
+}
+
+// SiteIDs 記録のある授業サイトのIDを返す
+func (s *Store) SiteIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, r := range s.records {
+		if !seen[r.SiteID] {
+			seen[r.SiteID] = true
+			ids = append(ids, r.SiteID)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Site 記録のある授業サイトの概要
+type Site struct {
+	ID    string
+	Title string
+	// 資料を保存したフォルダ 保存先の分かる記録がない場合は空
+	Folder string
+	// 記録のある資料の数
+	Files int
+	// 最後に資料をダウンロードした日時
+	LastDownload time.Time
+}
+
+// Sites 記録のある授業サイトの概要をIDの順に返す
+// 保存したフォルダは、授業サイトの資料を保存したパスに共通するフォルダとする
+func (s *Store) Sites() []Site {
+	sites := make([]Site, 0)
+	for _, id := range s.SiteIDs() {
+		site := Site{ID: id, Title: id}
+		for _, r := range s.SiteRecords(id) {
+			if r.SiteTitle != "" {
+				site.Title = r.SiteTitle
+			}
+			if r.DownloadedAt.After(site.LastDownload) {
+				site.LastDownload = r.DownloadedAt
+			}
+			if r.Path != "" {
+				site.Folder = commonDir(site.Folder, filepath.Dir(r.Path))
+			}
+			site.Files++
+		}
+		sites = append(sites, site)
+	}
+
+	return sites
+}
+
+// commonDir 二つのフォルダに共通する最も深いフォルダを返す aが空の場合はbを返す
+func commonDir(a, b string) string {
+	if a == "" {
+		return b
+	}
+
+	for a != b {
+		if len(a) > len(b) {
+			a, b = b, a
+		}
+		if rel, err := filepath.Rel(a, b); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return a
+		}
+		parent := filepath.Dir(a)
+		if parent == a {
+			return a
+		}
+		a = parent
+	}
+
+	return a
+}
+
+// Recent 保存先の分かる記録をダウンロードした日時の新しい順にn件まで返す
+func (s *Store) Recent(n int) []Record {
+	s.mu.RLock()
+	records := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		if r.Path != "" && !r.DownloadedAt.IsZero() {
+			records = append(records, *r)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].DownloadedAt.Equal(records[j].DownloadedAt) {
+			return records[i].DownloadedAt.After(records[j].DownloadedAt)
+		}
+		return records[i].Path < records[j].Path
+	})
+	if len(records) > n {
+		records = records[:n]
+	}
+
+	return records
+}
+
+// Len 記録の数を返す
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.records)
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].SiteID != records[j].SiteID {
+			return records[i].SiteID < records[j].SiteID
+		}
+		if records[i].Title != records[j].Title {
+			return records[i].Title < records[j].Title
+		}
+		return records[i].URL < records[j].URL
+	})
+}
@@ -0,0 +1,148 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateLegacyMap(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	legacy := filepath.Join(tmp, legacyMapFile)
+	if err := ioutil.WriteFile(legacy, []byte(`{"site1":{"a.pdf":"1","b.pdf":"2"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmp, stateFile)
+	s, err := migrateLegacyMap(path, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("legacy map is not removed")
+	}
+
+	// ファイルから読み直しても同じ記録が得られる
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := s.Lookup("https://example.com/a.pdf", "site1", "a.pdf")
+	if !ok || !rec.Legacy() || rec.LastModified != "1" {
+		t.Fatalf("legacy record: %+v, %v", rec, ok)
+	}
+
+	// URLのわかる記録を追加すると旧形式の記録は置き換えられる
+	s.Put(Record{URL: "https://example.com/a.pdf", SiteID: "site1", Title: "a.pdf", LastModified: "3", Path: "/tmp/a.pdf"})
+	if s.Len() != 2 {
+		t.Errorf("records: %+v", s.Records())
+	}
+	if rec, _ := s.Lookup("https://example.com/a.pdf", "site1", "a.pdf"); rec.Legacy() || rec.LastModified != "3" {
+		t.Errorf("record is not replaced: %+v", rec)
+	}
+	if ids := s.SiteIDs(); len(ids) != 1 || ids[0] != "site1" {
+		t.Errorf("site ids: %v", ids)
+	}
+}
+
+// 保存先のパスから元の資料名をたどれる
+func TestLookupPath(t *testing.T) {
+	s := New()
+	s.Put(Record{
+		URL:       "https://example.com/group/site1/%E7%AC%AC1%E5%9B%9E%3A%E5%B0%8E%E5%85%A5.pdf",
+		SiteID:    "site1",
+		SiteTitle: "[2020前期月２]データ構造とアルゴリズム",
+		Title:     "第1回:導入.pdf",
+		Path:      "/home/user/PandorA Box/[2020前期月２]データ構造とアルゴリズム/第1回_導入.pdf",
+	})
+
+	// macOSなどではNFDでパスが返される
+	rec, ok := s.LookupPath("/home/user/PandorA Box/[2020前期月２]テ\u3099ータ構造とアルコ\u3099リス\u3099ム/第1回_導入.pdf")
+	if !ok || rec.Title != "第1回:導入.pdf" {
+		t.Errorf("record is not found: %+v", rec)
+	}
+
+	// 大文字と小文字を区別しないファイルシステムで名前の大文字と小文字だけを変えた場合
+	if _, ok := s.LookupPath("/home/user/pandora box/[2020前期月２]データ構造とアルゴリズム/第1回_導入.PDF"); !ok {
+		t.Error("record is not found by a path that differs only in case")
+	}
+
+	if _, ok := s.LookupPath("/home/user/PandorA Box/other.pdf"); ok {
+		t.Error("unexpected record")
+	}
+}
+
+func TestSitesAndRecent(t *testing.T) {
+	root := filepath.FromSlash("/home/user/PandorA Box")
+	at := func(h int) time.Time { return time.Date(2020, 4, 10, h, 0, 0, 0, time.UTC) }
+
+	s := New()
+	s.Put(Record{URL: "u1", SiteID: "site1", SiteTitle: "線形代数学", Title: "slides.pdf", Path: filepath.Join(root, "線形代数学", "第1回", "slides.pdf"), DownloadedAt: at(1)})
+	s.Put(Record{URL: "u2", SiteID: "site1", SiteTitle: "線形代数学", Title: "notes.pdf", Path: filepath.Join(root, "線形代数学", "第2回", "notes.pdf"), DownloadedAt: at(3)})
+	s.Put(Record{URL: "u3", SiteID: "site2", SiteTitle: "物理学基礎論", Title: "a.pdf", Path: filepath.Join(root, "物理学基礎論", "a.pdf"), DownloadedAt: at(2)})
+	s.Put(Record{SiteID: "site3", Title: "legacy.pdf"})
+
+	sites := s.Sites()
+	if len(sites) != 3 {
+		t.Fatalf("sites: %+v", sites)
+	}
+	if sites[0].Folder != filepath.Join(root, "線形代数学") || sites[0].Files != 2 || !sites[0].LastDownload.Equal(at(3)) {
+		t.Errorf("site1: %+v", sites[0])
+	}
+	if sites[1].Folder != filepath.Join(root, "物理学基礎論") || sites[1].Title != "物理学基礎論" {
+		t.Errorf("site2: %+v", sites[1])
+	}
+	if sites[2].Folder != "" || sites[2].Title != "site3" {
+		t.Errorf("legacy site: %+v", sites[2])
+	}
+
+	recent := s.Recent(2)
+	if len(recent) != 2 || recent[0].Title != "notes.pdf" || recent[1].Title != "a.pdf" {
+		t.Errorf("recent: %+v", recent)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pandora-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "state", runFile)
+	if r, err := readRun(path); err != nil || !r.LastStart.IsZero() {
+		t.Fatalf("no record: %+v, %v", r, err)
+	}
+
+	started := time.Date(2026, 10, 19, 12, 4, 0, 0, time.UTC)
+	want := Run{LastStart: started, LastSuccess: started, Duration: 42 * time.Second, Result: ResultSuccess, New: 3}
+	if err := writeRun(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRun(path)
+	if err != nil || !got.LastStart.Equal(want.LastStart) || got.Duration != want.Duration || got.Result != ResultSuccess || got.New != 3 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	// 再起動しても最後に開始した時刻からクールダウンを数える
+	cooldown := 10 * time.Minute
+	if d := got.CooldownRemaining(started.Add(4*time.Minute), cooldown); d != 6*time.Minute {
+		t.Errorf("remaining: %s", d)
+	}
+	if d := got.CooldownRemaining(started.Add(10*time.Minute), cooldown); d != 0 {
+		t.Errorf("after cooldown: %s", d)
+	}
+	if d := got.CooldownRemaining(started.Add(-time.Hour), cooldown); d != 0 {
+		t.Errorf("clock moved back: %s", d)
+	}
+	if d := (&Run{}).CooldownRemaining(started, cooldown); d != 0 {
+		t.Errorf("first run: %s", d)
+	}
+}